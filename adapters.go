@@ -0,0 +1,270 @@
+// File: quantest/adapters.go
+
+package quantest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+const (
+	// adapterBytes is the size of an adapter weight, as llama.cpp and vLLM hold them in 16-bit.
+	adapterBytes = 2
+
+	// vLLM's defaults for --max-loras and --max-lora-rank.
+	defaultMaxLoRAs    = 1
+	defaultMaxLoRARank = 16
+
+	// safetensorsMaxHeader is the largest header the safetensors format allows, 100 MB.
+	safetensorsMaxHeader = 100_000_000
+)
+
+// adapterConfig holds the adapter_config.json fields PEFT writes
+type adapterConfig struct {
+	Rank          int             `json:"r"`
+	TargetModules json.RawMessage `json:"target_modules"`
+	ModulesToSave []string        `json:"modules_to_save"`
+}
+
+// LoadLoRAAdapter reads a LoRA adapter from a PEFT adapter directory or a GGUF file
+//
+// PEFT adapters are sized from the tensor shapes in adapter_model.safetensors,
+// falling back to the rank and target modules in adapter_config.json. GGUF
+// adapters are sized from the file itself.
+//
+// Parameters:
+//   - path: The adapter directory or GGUF file.
+//
+// Returns:
+//   - LoRAAdapter: A LoRAAdapter struct containing the rank, targets and, when known, the size.
+//   - error: An error if the adapter can't be read.
+//
+// Example:
+//
+//	adapter, err := LoadLoRAAdapter("./adapters/customer-a")
+func LoadLoRAAdapter(path string) (LoRAAdapter, error) {
+	adapter := LoRAAdapter{Name: strings.TrimSuffix(filepath.Base(path), ".gguf"), Path: path}
+
+	if strings.HasSuffix(strings.ToLower(path), ".gguf") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return adapter, err
+		}
+		adapter.Size = bitsToGB(float64(info.Size()))
+		return adapter, nil
+	}
+
+	configFile, err := os.ReadFile(filepath.Join(path, "adapter_config.json"))
+	if err != nil {
+		return adapter, fmt.Errorf("error reading adapter config: %w", err)
+	}
+	var config adapterConfig
+	if err := json.Unmarshal(configFile, &config); err != nil {
+		return adapter, fmt.Errorf("error parsing adapter config: %w", err)
+	}
+	adapter.Rank = config.Rank
+
+	// target_modules is a list of names, or a single name or regex
+	var targets []string
+	if err := json.Unmarshal(config.TargetModules, &targets); err != nil {
+		var target string
+		if err := json.Unmarshal(config.TargetModules, &target); err == nil && target != "" {
+			targets = []string{target}
+		}
+	}
+	adapter.Targets = targets
+	adapter.ModulesToSave = config.ModulesToSave
+
+	params, err := safetensorsParams(filepath.Join(path, "adapter_model.safetensors"))
+	if err == nil {
+		adapter.Params = params
+	} else if !os.IsNotExist(err) {
+		return adapter, fmt.Errorf("error reading adapter weights: %w", err)
+	}
+
+	return adapter, nil
+}
+
+// safetensorsParams counts the parameters in a safetensors file from its header
+func safetensorsParams(path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// A git-lfs pointer left by a clone without LFS decodes to a huge header length
+	var headerLength uint64
+	if err := binary.Read(file, binary.LittleEndian, &headerLength); err != nil {
+		return 0, err
+	}
+	if headerLength > safetensorsMaxHeader || headerLength > uint64(info.Size()) {
+		return 0, fmt.Errorf("invalid safetensors header length %d in %s, is it a git-lfs pointer?", headerLength, path)
+	}
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, err
+	}
+
+	var tensors map[string]struct {
+		Shape []uint64 `json:"shape"`
+	}
+	if err := json.Unmarshal(header, &tensors); err != nil {
+		return 0, err
+	}
+
+	var params float64
+	for name, tensor := range tensors {
+		if name == "__metadata__" {
+			continue
+		}
+		params += tensorParams(OllamaTensor{Shape: tensor.Shape})
+	}
+	return params, nil
+}
+
+// EstimateAdapters estimates the memory used to serve LoRA adapters with a base model
+//
+// llama-server keeps every adapter it's started with loaded. vLLM instead
+// preallocates --max-loras slots sized for --max-lora-rank on every linear
+// module, whatever the adapters target, and keeps up to --max-cpu-loras
+// adapters cached in system RAM to swap into them.
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the base model's configuration.
+//   - opts: An AdapterOptions struct containing the adapters and serving settings.
+//
+// Returns:
+//   - *AdapterEstimate: A pointer to an AdapterEstimate struct containing the adapters' VRAM and RAM.
+//   - error: An error if an adapter can't be resolved.
+//
+// Example:
+//
+//	estimate, err := EstimateAdapters(config, AdapterOptions{
+//		Adapters: []LoRAAdapter{{Name: "customer-a", Rank: 16, Targets: []string{"all-linear"}}},
+//		Serving:  AdapterServingVLLM,
+//		MaxLoRAs: 4,
+//	})
+func EstimateAdapters(config ModelConfig, opts AdapterOptions) (*AdapterEstimate, error) {
+	logging.DebugLogger.Println("Estimating LoRA adapters...")
+
+	estimate := &AdapterEstimate{Serving: opts.Serving}
+	if estimate.Serving == "" {
+		estimate.Serving = AdapterServingLlamaCpp
+	}
+
+	maxRank := 0
+	for _, adapter := range opts.Adapters {
+		resolved, err := resolveAdapter(config, adapter)
+		if err != nil {
+			return nil, err
+		}
+		maxRank = max(maxRank, resolved.Rank)
+		estimate.Adapters = append(estimate.Adapters, resolved)
+	}
+
+	switch estimate.Serving {
+	case AdapterServingLlamaCpp:
+		estimate.Slots = len(estimate.Adapters)
+		for _, adapter := range estimate.Adapters {
+			estimate.VRAM += adapter.Size
+		}
+
+	case AdapterServingVLLM:
+		maxLoRAs, maxLoRARank := opts.MaxLoRAs, opts.MaxLoRARank
+		if maxLoRAs == 0 {
+			maxLoRAs = defaultMaxLoRAs
+		}
+		if maxLoRARank == 0 {
+			maxLoRARank = defaultMaxLoRARank
+		}
+		if maxRank > maxLoRARank {
+			estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("an adapter has rank %d, above --max-lora-rank %d, vLLM will refuse to load it", maxRank, maxLoRARank))
+		}
+
+		slotParams, _, err := config.loraParams(maxLoRARank, []string{"all-linear"})
+		if err != nil {
+			return nil, err
+		}
+		estimate.Slots = maxLoRAs
+		estimate.VRAM = bitsToGB(float64(maxLoRAs) * slotParams * adapterBytes)
+
+		// The CPU cache holds up to --max-cpu-loras adapters, budget for the largest
+		maxCPULoRAs := max(opts.MaxCPULoRAs, maxLoRAs)
+		sizes := make([]float64, len(estimate.Adapters))
+		for i, adapter := range estimate.Adapters {
+			sizes[i] = adapter.Size
+		}
+		sort.Sort(sort.Reverse(sort.Float64Slice(sizes)))
+		for i := 0; i < len(sizes) && i < maxCPULoRAs; i++ {
+			estimate.RAM += sizes[i]
+		}
+
+		if len(estimate.Adapters) > maxLoRAs {
+			estimate.Warnings = append(estimate.Warnings, fmt.Sprintf(
+				"%d adapters share %d GPU slots, batches mixing more than %d adapters wait for a slot", len(estimate.Adapters), maxLoRAs, maxLoRAs))
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown adapter serving %q, expected llama.cpp or vllm", opts.Serving)
+	}
+
+	return estimate, nil
+}
+
+// resolveAdapter loads an adapter from its path and sizes it
+func resolveAdapter(config ModelConfig, adapter LoRAAdapter) (LoRAAdapter, error) {
+	if adapter.Path != "" && adapter.Params == 0 && adapter.Size == 0 {
+		loaded, err := LoadLoRAAdapter(adapter.Path)
+		if err != nil {
+			return adapter, fmt.Errorf("error loading adapter %s: %w", adapter.Path, err)
+		}
+		if adapter.Name != "" {
+			loaded.Name = adapter.Name
+		}
+		adapter = loaded
+	}
+
+	if adapter.Params == 0 && adapter.Size == 0 {
+		rank, targets := adapter.Rank, adapter.Targets
+		if rank == 0 {
+			rank = DefaultLoRARank
+		}
+		if len(targets) == 0 {
+			targets = DefaultLoRATargets
+		}
+		params, _, err := config.loraParams(rank, targets)
+		if err != nil {
+			return adapter, fmt.Errorf("error sizing adapter %s: %w", adapter.Name, err)
+		}
+
+		// Fully trained modules are saved whole alongside the adapter
+		for _, module := range adapter.ModulesToSave {
+			switch module {
+			case "embed_tokens":
+				params += config.embeddingParams()
+			case "lm_head":
+				params += config.outputParams()
+			}
+		}
+		adapter.Rank, adapter.Targets, adapter.Params = rank, targets, params
+	}
+
+	if adapter.Size == 0 {
+		adapter.Size = bitsToGB(adapter.Params * adapterBytes)
+	}
+	return adapter, nil
+}
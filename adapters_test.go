@@ -0,0 +1,128 @@
+// File: quantest/adapters_test.go
+
+package quantest
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSafetensors writes a safetensors file with the given header and no tensor data
+func writeSafetensors(t *testing.T, path, header string) {
+	t.Helper()
+	data := binary.LittleEndian.AppendUint64(nil, uint64(len(header)))
+	if err := os.WriteFile(path, append(data, header...), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEstimateAdapters(t *testing.T) {
+	const gib = 1 << 30
+	// Rank 16 on q_proj and v_proj, and on every linear module, across 32 layers
+	qv := 32 * 16 * (4096 + 4096 + 4096 + 1024.0)
+	allLinear := 32 * 16 * (2*(4096+4096) + 2*(4096+1024) + 3*(4096+14336.0))
+
+	adapters := []LoRAAdapter{
+		{Name: "a"},
+		{Name: "b", Targets: []string{"all-linear"}},
+		{Name: "c", Rank: 8},
+	}
+	tests := []struct {
+		name      string
+		opts      AdapterOptions
+		wantSlots int
+		// Bytes, before converting to GB
+		wantVRAM, wantRAM float64
+		wantWarnings      int
+	}{
+		{
+			// Every adapter is loaded at its own size
+			"llama.cpp", AdapterOptions{Adapters: adapters},
+			3, (qv + allLinear + qv/2) * 2, 0, 0,
+		},
+		{
+			// One slot at rank 16 on every linear module, whatever the adapters target
+			"vllm defaults", AdapterOptions{Adapters: adapters, Serving: AdapterServingVLLM},
+			1, allLinear * 2, allLinear * 2, 1,
+		},
+		{
+			// The CPU cache holds the largest two adapters
+			"vllm slots", AdapterOptions{Adapters: adapters, Serving: AdapterServingVLLM, MaxLoRAs: 2, MaxLoRARank: 32},
+			2, 2 * 2 * allLinear * 2, (allLinear + qv) * 2, 1,
+		},
+		{
+			"vllm cpu loras", AdapterOptions{Adapters: adapters, Serving: AdapterServingVLLM, MaxLoRAs: 4, MaxCPULoRAs: 8},
+			4, 4 * allLinear * 2, (qv + allLinear + qv/2) * 2, 0,
+		},
+		{
+			// A rank 64 adapter can't fit a rank 16 slot
+			"vllm max rank", AdapterOptions{Adapters: []LoRAAdapter{{Name: "d", Rank: 64}}, Serving: AdapterServingVLLM},
+			1, allLinear * 2, 4 * qv * 2, 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			estimate, err := EstimateAdapters(llama8B, test.opts)
+			if err != nil {
+				t.Fatalf("EstimateAdapters returned error: %v", err)
+			}
+			if estimate.Slots != test.wantSlots || len(estimate.Warnings) != test.wantWarnings {
+				t.Errorf("EstimateAdapters = %d slots with warnings %v, want %d slots and %d warnings",
+					estimate.Slots, estimate.Warnings, test.wantSlots, test.wantWarnings)
+			}
+			if math.Abs(estimate.VRAM-test.wantVRAM/gib) > 1e-9 || math.Abs(estimate.RAM-test.wantRAM/gib) > 1e-9 {
+				t.Errorf("EstimateAdapters = %v GB VRAM and %v GB RAM, want %v and %v",
+					estimate.VRAM, estimate.RAM, test.wantVRAM/gib, test.wantRAM/gib)
+			}
+		})
+	}
+
+	if _, err := EstimateAdapters(llama8B, AdapterOptions{Serving: "tgi"}); err == nil {
+		t.Error("EstimateAdapters with unknown serving returned no error")
+	}
+}
+
+func TestLoadLoRAAdapter(t *testing.T) {
+	dir := t.TempDir()
+	config := `{"r": 8, "target_modules": ["q_proj", "v_proj"], "modules_to_save": ["lm_head"]}`
+	if err := os.WriteFile(filepath.Join(dir, "adapter_config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeSafetensors(t, filepath.Join(dir, "adapter_model.safetensors"), `{"__metadata__": {"format": "pt"},
+		"q_proj.lora_A.weight": {"dtype": "F16", "shape": [8, 4096], "data_offsets": [0, 0]},
+		"q_proj.lora_B.weight": {"dtype": "F16", "shape": [4096, 8], "data_offsets": [0, 0]}}`)
+
+	adapter, err := LoadLoRAAdapter(dir)
+	if err != nil {
+		t.Fatalf("LoadLoRAAdapter returned error: %v", err)
+	}
+	// The tensors' shapes size the adapter rather than its config
+	if adapter.Rank != 8 || len(adapter.Targets) != 2 || adapter.Params != 2*8*4096 {
+		t.Errorf("LoadLoRAAdapter = rank %d targeting %v with %v params, want rank 8 targeting 2 modules with %d params",
+			adapter.Rank, adapter.Targets, adapter.Params, 2*8*4096)
+	}
+}
+
+func TestSafetensorsParamsInvalidHeader(t *testing.T) {
+	dir := t.TempDir()
+	pointer := filepath.Join(dir, "pointer.safetensors")
+	lfs := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a2146\nsize 167832240\n"
+	if err := os.WriteFile(pointer, []byte(lfs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.safetensors")
+	if err := os.WriteFile(truncated, binary.LittleEndian.AppendUint64(nil, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{pointer, truncated} {
+		_, err := safetensorsParams(path)
+		if err == nil || !strings.Contains(err.Error(), "invalid safetensors header length") {
+			t.Errorf("safetensorsParams(%s) = %v, want an invalid header length error", filepath.Base(path), err)
+		}
+	}
+}
@@ -19,6 +19,30 @@ type QuantRecommendations struct {
 
 // CalculateBPW calculates the best BPW for a given memory and context constraint
 func CalculateBPW(config ModelConfig, memory float64, context int, kvCacheQuant KVCacheQuantisation, quantType string) (interface{}, QuantRecommendations, error) {
+	return CalculateBPWWithParams(config, memory, context, kvCacheQuant, quantType, RuntimeParams{})
+}
+
+// CalculateBPWWithParams calculates the best BPW for a given memory and context constraint
+// with the given batching and parallel slot settings
+func CalculateBPWWithParams(config ModelConfig, memory float64, context int, kvCacheQuant KVCacheQuantisation, quantType string, params RuntimeParams) (interface{}, QuantRecommendations, error) {
+	quant, err := ParseQuantType(quantType)
+	if err != nil {
+		return nil, QuantRecommendations{}, err
+	}
+	return CalculateBPWWithQuantType(config, memory, context, kvCacheQuant, quant, params)
+}
+
+// CalculateBPWWithQuantType calculates the best quant of the given type for a memory and
+// context constraint, GGUF recommendations are quant names and ExLlama's are BPW steps
+//
+// Example:
+//
+//	best, recommendations, err := CalculateBPWWithQuantType(config, 24, 32768, KVCacheQ6, QuantType{Format: QuantFormatEXL2}, RuntimeParams{})
+//	fmt.Println(best) // e.g. 5.85bpw
+func CalculateBPWWithQuantType(config ModelConfig, memory float64, context int, kvCacheQuant KVCacheQuantisation, quant QuantType, params RuntimeParams) (interface{}, QuantRecommendations, error) {
+	if err := quant.validate(); err != nil {
+		return nil, QuantRecommendations{}, err
+	}
 
 	contextSizes := []int{2048, 8192, 16384, 32768, 49152, 65536}
 	if !slices.Contains(contextSizes, context) {
@@ -26,21 +50,27 @@ func CalculateBPW(config ModelConfig, memory float64, context int, kvCacheQuant
 		sort.Ints(contextSizes)
 	}
 	bestQuants := make(map[int]string)
+	candidates := quant.candidates()
 
 	// Find best quantisation for a given context size
 	findBestQuant := func(ctxSize int) string {
 		var bestQuant string
 		maxBPW := 0.0
 
-		for quantName, bpw := range GGUFMapping {
-			vram, err := CalculateVRAM(config, bpw, ctxSize, kvCacheQuant)
+		for _, candidate := range candidates {
+			candidateQuant := quant
+			if quant.Format == QuantFormatGGUF {
+				candidateQuant.Recipe = candidate.name
+			}
+			vram, err := CalculateVRAMWithQuantType(config, candidate.bpw, ctxSize, kvCacheQuant, candidateQuant, params)
 			if err != nil {
 				continue
 			}
 
-			if vram <= memory && bpw > maxBPW {
-				maxBPW = bpw
-				bestQuant = quantName
+			// Candidates of the same BPW are ordered by quality, so take the later
+			if vram <= memory && candidate.bpw >= maxBPW {
+				maxBPW = candidate.bpw
+				bestQuant = candidate.name
 			}
 		}
 
@@ -81,14 +111,41 @@ func CalculateBPW(config ModelConfig, memory float64, context int, kvCacheQuant
 //
 //	vram, _ := CalculateVRAM("llama3.1", 24.0, 8192, KVCacheFP16, nil)
 func CalculateVRAM(config ModelConfig, bpw float64, context int, kvCacheQuant KVCacheQuantisation) (float64, error) {
+	return CalculateVRAMWithParams(config, bpw, context, kvCacheQuant, RuntimeParams{})
+}
+
+// CalculateVRAMWithParams calculates the VRAM usage for a given model and configuration
+// with the given batching and parallel slot settings
+//
+// Example:
+//
+//	vram, _ := CalculateVRAMWithParams(config, 4.85, 8192, KVCacheQ8_0, RuntimeParams{UBatchSize: 512, Parallel: 4})
+func CalculateVRAMWithParams(config ModelConfig, bpw float64, context int, kvCacheQuant KVCacheQuantisation, params RuntimeParams) (float64, error) {
+	return CalculateVRAMWithQuantType(config, bpw, context, kvCacheQuant, QuantType{Format: QuantFormatGGUF}, params)
+}
 
-	bpwValues := GetBPWValues(bpw, kvCacheQuant)
+// CalculateVRAMWithQuantType calculates the VRAM usage for a model quantised with the given quant type
+//
+// Example:
+//
+//	vram, _ := CalculateVRAMWithQuantType(config, 4.65, 32768, KVCacheQ6, QuantType{Format: QuantFormatEXL2, HeadBits: 8}, RuntimeParams{})
+func CalculateVRAMWithQuantType(config ModelConfig, bpw float64, context int, kvCacheQuant KVCacheQuantisation, quant QuantType, params RuntimeParams) (float64, error) {
+	bpwValues := quant.BPWValues(bpw, kvCacheQuant)
 
 	if context == 0 {
 		context = config.MaxPositionEmbeddings
 	}
 
-	vram := CalculateVRAMRaw(config, bpwValues, context, 1, true)
+	var vram float64
+	if config.IsEncoderDecoder {
+		// The context is the decoder's output length, the encoder input comes from the config
+		vram = CalculateEncoderDecoderVRAM(config, bpwValues, 0, context)
+	} else if config.IsEmbedding {
+		// The context is the length of each embedded sequence
+		vram = CalculateEmbeddingVRAM(config, bpwValues, context, params.EmbedBatch)
+	} else {
+		vram = CalculateVRAMRaw(config, bpwValues, context, 1, true, params)
+	}
 
 	return math.Round(vram*100) / 100, nil
 }
@@ -113,21 +170,37 @@ func CalculateVRAM(config ModelConfig, bpw float64, context int, kvCacheQuant KV
 //	    log.Fatal(err)
 //	}
 func CalculateContext(config ModelConfig, memory, bpw float64, kvCacheQuant KVCacheQuantisation) (int, error) {
-	logging.DebugLogger.Println("Calculating context...")
+	return CalculateContextWithParams(config, memory, bpw, kvCacheQuant, RuntimeParams{})
+}
+
+// CalculateContextWithParams calculates the maximum context for a given memory constraint
+// with the given batching and parallel slot settings
+func CalculateContextWithParams(config ModelConfig, memory, bpw float64, kvCacheQuant KVCacheQuantisation, params RuntimeParams) (int, error) {
+	return CalculateContextWithQuantType(config, memory, bpw, kvCacheQuant, QuantType{Format: QuantFormatGGUF}, params)
+}
 
-	var maxContext int
+// CalculateContextWithQuantType calculates the maximum context for a given memory constraint
+// for a model quantised with the given quant type
+func CalculateContextWithQuantType(config ModelConfig, memory, bpw float64, kvCacheQuant KVCacheQuantisation, quant QuantType, params RuntimeParams) (int, error) {
+	logging.DebugLogger.Println("Calculating context...")
 
-	config, err := GetHFModelConfig(config.ModelName)
-	if err != nil {
-		return 0, err
+	// Only fall back to Huggingface when the caller's config is missing its context length
+	if config.MaxPositionEmbeddings == 0 && !config.IsOllama {
+		hfConfig, err := GetHFModelConfig(config.ModelName)
+		if err != nil {
+			return 0, err
+		}
+		config = hfConfig
 	}
-	maxContext = config.MaxPositionEmbeddings
+
+	// Capped at max_position_embeddings, see ModelConfig.WithScaledContext to extend it
+	maxContext := config.MaxPositionEmbeddings
 
 	minContext := 512
 	low, high := minContext, maxContext
 	for low < high {
 		mid := (low + high + 1) / 2
-		vram, err := CalculateVRAM(config, bpw, mid, kvCacheQuant)
+		vram, err := CalculateVRAMWithQuantType(config, bpw, mid, kvCacheQuant, quant, params)
 		if err != nil {
 			return 0, err
 		}
@@ -140,7 +213,7 @@ func CalculateContext(config ModelConfig, memory, bpw float64, kvCacheQuant KVCa
 
 	context := low
 	for context <= maxContext {
-		vram, err := CalculateVRAM(config, bpw, context, kvCacheQuant)
+		vram, err := CalculateVRAMWithQuantType(config, bpw, context, kvCacheQuant, quant, params)
 		if err != nil {
 			return 0, err
 		}
@@ -161,55 +234,143 @@ func CalculateContext(config ModelConfig, memory, bpw float64, kvCacheQuant KVCa
 //   - context: An integer representing the context size.
 //   - numGPUs: An integer representing the number of GPUs.
 //   - gqa: A boolean indicating whether the model is GQA.
+//   - params: A RuntimeParams struct containing the batch sizes and parallel slots.
 //
 // Returns:
 //   - float64: A float64 representing the VRAM usage in GB.
 //
 // Example:
 //
-//	vram := CalculateVRAMRaw(config, bpwValues, 8192, 1, true)
-func CalculateVRAMRaw(config ModelConfig, bpwValues BPWValues, context int, numGPUs int, gqa bool) float64 {
+//	vram := CalculateVRAMRaw(config, bpwValues, 8192, 1, true, RuntimeParams{})
+func CalculateVRAMRaw(config ModelConfig, bpwValues BPWValues, context int, numGPUs int, gqa bool, params RuntimeParams) float64 {
 	logging.DebugLogger.Println("Calculating VRAM usage...")
 
-	cudaSize := float64(CUDASize * numGPUs)
-	paramsSize := config.NumParams * 1e9 * (bpwValues.BPW / 8)
+	cudaSize := bitsToGB(float64(CUDASize * numGPUs))
+	usage := calculateUsage(config, bpwValues, context, gqa, params)
 
-	kvCacheSize := float64(context*2*config.NumHiddenLayers*config.HiddenSize) * (bpwValues.KVCacheBPW / 8)
+	return cudaSize + usage.weights.Layers + usage.weights.Output + usage.kvCache + usage.activations + usage.logits
+}
+
+// vramUsage holds the components of a VRAM estimate in GB, with the weights and
+// KV cache also broken down per layer for placing layers across devices.
+type vramUsage struct {
+	weights      WeightBreakdown
+	layerWeights []float64
+	layerKVCache []float64
+	kvCache      float64
+	activations  float64
+	logits       float64
+}
+
+// calculateUsage calculates the components of a model's VRAM usage, excluding runtime overhead
+//
+// The KV cache holds the context for every parallel slot, while the compute
+// buffers only ever see a micro-batch of tokens at a time.
+func calculateUsage(config ModelConfig, bpwValues BPWValues, context int, gqa bool, params RuntimeParams) vramUsage {
+	weights := CalculateWeights(config, bpwValues)
+	tokens, outputs := params.tokens(context)
+
+	keyDim := config.KeyHeadDim()
+	valueDim := config.ValueHeadDim()
+
+	kvHeads := config.NumAttentionHeads
 	if gqa {
-		kvCacheSize *= float64(config.NumKeyValueHeads) / float64(config.NumAttentionHeads)
+		kvHeads = config.kvHeads()
+	}
+
+	layerKVCache := config.kvCacheElementsPerLayer(context, gqa)
+	slots := float64(params.slots())
+	var kvCacheSize float64
+	for i := range layerKVCache {
+		layerKVCache[i] = bitsToGB(layerKVCache[i] * slots * (bpwValues.KVCacheBPW / 8))
+		kvCacheSize += layerKVCache[i]
+	}
+
+	layerWeights := config.layerParamsPerLayer()
+	for i := range layerWeights {
+		layerWeights[i] = bitsToGB(layerWeights[i] * (bpwValues.BPW / 8))
+	}
+	if recipe, ok := config.recipeWeights(bpwValues.Registry, bpwValues.Recipe); ok {
+		layerWeights = recipe.layers
 	}
 
 	bytesPerParam := bpwValues.BPW / 8
 	lmHeadBytesPerParam := bpwValues.LMHeadBPW / 8
 
-	headDim := float64(config.HiddenSize) / float64(config.NumAttentionHeads)
-	attentionInput := bytesPerParam * float64(context*config.HiddenSize)
+	attentionInput := bytesPerParam * float64(tokens*config.HiddenSize)
 
-	q := bytesPerParam * float64(context) * headDim * float64(config.NumAttentionHeads)
-	k := bytesPerParam * float64(context) * headDim * float64(config.NumKeyValueHeads)
-	v := bytesPerParam * float64(context) * headDim * float64(config.NumKeyValueHeads)
+	q := bytesPerParam * float64(tokens) * keyDim * float64(config.NumAttentionHeads)
+	k := bytesPerParam * float64(tokens) * keyDim * float64(kvHeads)
+	v := bytesPerParam * float64(tokens) * valueDim * float64(kvHeads)
 
-	softmaxOutput := lmHeadBytesPerParam * float64(config.NumAttentionHeads*context)
-	softmaxDropoutMask := float64(config.NumAttentionHeads * context)
-	dropoutOutput := lmHeadBytesPerParam * float64(config.NumAttentionHeads*context)
+	softmaxOutput := lmHeadBytesPerParam * float64(config.NumAttentionHeads*tokens)
+	softmaxDropoutMask := float64(config.NumAttentionHeads * tokens)
+	dropoutOutput := lmHeadBytesPerParam * float64(config.NumAttentionHeads*tokens)
 
-	outProjInput := lmHeadBytesPerParam * float64(context*config.NumAttentionHeads) * headDim
-	attentionDropout := float64(context * config.HiddenSize)
+	outProjInput := lmHeadBytesPerParam * float64(tokens*config.NumAttentionHeads) * valueDim
+	attentionDropout := float64(tokens * config.HiddenSize)
 
 	attentionBlock := attentionInput + q + k + softmaxOutput + v + outProjInput + softmaxDropoutMask + dropoutOutput + attentionDropout
 
-	mlpInput := bytesPerParam * float64(context*config.HiddenSize)
-	activationInput := bytesPerParam * float64(context*config.IntermediateSize)
-	downProjInput := bytesPerParam * float64(context*config.IntermediateSize)
-	dropoutMask := float64(context * config.HiddenSize)
+	mlpInput := bytesPerParam * float64(tokens*config.HiddenSize)
+	activationInput := bytesPerParam * float64(tokens*config.IntermediateSize)
+	downProjInput := bytesPerParam * float64(tokens*config.IntermediateSize)
+	dropoutMask := float64(tokens * config.HiddenSize)
 	mlpBlock := mlpInput + activationInput + downProjInput + dropoutMask
 
-	layerNorms := bytesPerParam * float64(context*config.HiddenSize*2)
+	layerNorms := bytesPerParam * float64(tokens*config.HiddenSize*2)
 	activationsSize := attentionBlock + mlpBlock + layerNorms
 
-	outputSize := lmHeadBytesPerParam * float64(context*config.VocabSize)
+	outputSize := lmHeadBytesPerParam * float64(outputs*config.VocabSize)
 
-	vramBits := cudaSize + paramsSize + activationsSize + outputSize + kvCacheSize
+	return vramUsage{
+		weights:      weights,
+		layerWeights: layerWeights,
+		layerKVCache: layerKVCache,
+		kvCache:      kvCacheSize,
+		activations:  bitsToGB(activationsSize),
+		logits:       bitsToGB(outputSize),
+	}
+}
 
-	return bitsToGB(vramBits)
+// CalculateWeights calculates the size of a model's weights and where they are placed
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - bpwValues: A BPWValues struct containing the bits per weight values.
+//
+// Returns:
+//   - WeightBreakdown: The token embedding, output head and repeating layer sizes in GB.
+//
+// Example:
+//
+//	weights := CalculateWeights(config, GetBPWValues(4.85, KVCacheFP16))
+func CalculateWeights(config ModelConfig, bpwValues BPWValues) WeightBreakdown {
+	// GGUF recipes size each tensor at the type llama-quantize gives it
+	if recipe, ok := config.recipeWeights(bpwValues.Registry, bpwValues.Recipe); ok {
+		return recipe.breakdown
+	}
+
+	// A tied embedding is quantised as the output head as it doubles as one
+	embeddingBPW := bpwValues.EmbeddingBPW
+	if config.TieWordEmbeddings {
+		embeddingBPW = bpwValues.LMHeadBPW
+	}
+
+	weights := WeightBreakdown{
+		TokenEmbedding: bitsToGB(config.embeddingParams() * embeddingBPW / 8),
+		Output:         bitsToGB(config.outputParams() * bpwValues.LMHeadBPW / 8),
+		Layers:         bitsToGB(config.layerParams() * bpwValues.BPW / 8),
+	}
+
+	// Held on the GPU, a tied embedding is the output head rather than a copy of it
+	if bpwValues.GPUEmbedding {
+		if config.TieWordEmbeddings {
+			weights.Output = weights.TokenEmbedding
+		} else {
+			weights.Output += weights.TokenEmbedding
+		}
+		weights.TokenEmbedding = 0
+	}
+	return weights
 }
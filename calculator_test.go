@@ -0,0 +1,141 @@
+// File: quantest/calculator_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+// llama8B is Llama 3.1 8B's shape
+var llama8B = ModelConfig{
+	ModelName:             "meta-llama/Llama-3.1-8B-Instruct",
+	NumParams:             8.03,
+	MaxPositionEmbeddings: 131072,
+	NumHiddenLayers:       32,
+	HiddenSize:            4096,
+	NumKeyValueHeads:      8,
+	NumAttentionHeads:     32,
+	IntermediateSize:      14336,
+	VocabSize:             128256,
+}
+
+func TestCandidatesDropDominatedQuants(t *testing.T) {
+	candidates := QuantType{Format: QuantFormatGGUF}.candidates()
+	names := make(map[string]bool)
+	for _, candidate := range candidates {
+		names[candidate.name] = true
+	}
+	for _, name := range []string{"Q5_1", "Q4_1", "Q5_0", "Q4_0", "Q3_K_L", "FP8_E5M2"} {
+		if names[name] {
+			t.Errorf("candidates include %s, which a higher quality quant beats at the same or a lower BPW", name)
+		}
+	}
+	for _, name := range []string{"Q5_K_M", "Q5_K_L", "Q4_K_L", "Q4_K_M", "Q6_K", "Q8_0", "F16"} {
+		if !names[name] {
+			t.Errorf("candidates are missing %s", name)
+		}
+	}
+}
+
+func TestCalculateBPWNeverPrefersLegacyQuants(t *testing.T) {
+	quant := QuantType{Format: QuantFormatGGUF}
+	for memory := 6.0; memory <= 24; memory++ {
+		_, recommendations, err := CalculateBPWWithQuantType(llama8B, memory, 8192, KVCacheFP16, quant, RuntimeParams{})
+		if err != nil {
+			t.Fatalf("CalculateBPWWithQuantType(%v GB) returned error: %v", memory, err)
+		}
+		for context, name := range recommendations.Recommendations {
+			if name == "Q5_1" || name == "Q4_1" {
+				t.Errorf("%v GB at context %d recommends %s over the K-quants", memory, context, name)
+			}
+		}
+	}
+
+	best, _, err := CalculateBPWWithQuantType(llama8B, 8, 8192, KVCacheFP16, quant, RuntimeParams{})
+	if err != nil {
+		t.Fatalf("CalculateBPWWithQuantType returned error: %v", err)
+	}
+	if best != "Q5_K_L" {
+		t.Errorf("CalculateBPWWithQuantType(8 GB) = %v, want Q5_K_L", best)
+	}
+}
+
+func TestCalculateWeightsPlacement(t *testing.T) {
+	// 1M parameters with a 1000 x 100 token embedding, i.e. 100K embedding parameters
+	untied := ModelConfig{NumParams: 0.001, VocabSize: 1000, HiddenSize: 100}
+	tied := untied
+	tied.TieWordEmbeddings = true
+	bpwValues := BPWValues{BPW: 4, LMHeadBPW: 8, EmbeddingBPW: 2}
+	gpuEmbedding := bpwValues
+	gpuEmbedding.GPUEmbedding = true
+
+	gb := func(bytes float64) float64 { return bytes / (1 << 30) }
+	tests := []struct {
+		name      string
+		config    ModelConfig
+		bpwValues BPWValues
+		want      WeightBreakdown
+	}{
+		// The output head is its own 100K parameters, leaving 800K in the layers
+		{"untied", untied, bpwValues, WeightBreakdown{TokenEmbedding: gb(100e3 * 2 / 8), Output: gb(100e3 * 8 / 8), Layers: gb(800e3 * 4 / 8)}},
+		// A tied embedding is quantised as the output head and llama.cpp duplicates it on the GPU
+		{"tied", tied, bpwValues, WeightBreakdown{TokenEmbedding: gb(100e3 * 8 / 8), Output: gb(100e3 * 8 / 8), Layers: gb(900e3 * 4 / 8)}},
+		{"untied on the GPU", untied, gpuEmbedding, WeightBreakdown{Output: gb(100e3*8/8 + 100e3*2/8), Layers: gb(800e3 * 4 / 8)}},
+		{"tied on the GPU", tied, gpuEmbedding, WeightBreakdown{Output: gb(100e3 * 8 / 8), Layers: gb(900e3 * 4 / 8)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CalculateWeights(test.config, test.bpwValues)
+			if math.Abs(got.TokenEmbedding-test.want.TokenEmbedding) > 1e-12 || math.Abs(got.Output-test.want.Output) > 1e-12 || math.Abs(got.Layers-test.want.Layers) > 1e-12 {
+				t.Errorf("CalculateWeights() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeParamsTokens(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      RuntimeParams
+		context     int
+		wantTokens  int
+		wantOutputs int
+	}{
+		{"whole context", RuntimeParams{}, 8192, 8192, 8192},
+		{"batch", RuntimeParams{BatchSize: 2048}, 8192, 2048, 2048},
+		// The physical ubatch bounds the compute buffers, the logical batch the logits
+		{"batch and ubatch", RuntimeParams{BatchSize: 2048, UBatchSize: 512}, 8192, 512, 2048},
+		{"ubatch", RuntimeParams{UBatchSize: 512}, 8192, 512, 8192},
+		{"context below the batch", RuntimeParams{BatchSize: 2048, UBatchSize: 512}, 256, 256, 256},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, outputs := test.params.tokens(test.context)
+			if tokens != test.wantTokens || outputs != test.wantOutputs {
+				t.Errorf("tokens(%d) = %d, %d, want %d, %d", test.context, tokens, outputs, test.wantTokens, test.wantOutputs)
+			}
+		})
+	}
+}
+
+func TestCalculateUsageParams(t *testing.T) {
+	bpwValues := GetBPWValues(4.85, KVCacheFP16)
+	single := calculateUsage(llama8B, bpwValues, 8192, true, RuntimeParams{})
+
+	// Each parallel slot gets its own context's worth of KV cache: 32 layers x 8 heads x 256 x 2 bytes per token
+	parallel := calculateUsage(llama8B, bpwValues, 8192, true, RuntimeParams{Parallel: 4})
+	if want := bitsToGB(4 * 8192 * 32 * 8 * 256 * 2); math.Abs(parallel.kvCache-want) > 1e-9 || math.Abs(single.kvCache-want/4) > 1e-9 {
+		t.Errorf("KV cache = %v GB for 1 slot and %v GB for 4, want %v and %v", single.kvCache, parallel.kvCache, want/4, want)
+	}
+
+	// Logits are kept for the logical batch, at the output head's BPW
+	batched := calculateUsage(llama8B, bpwValues, 8192, true, RuntimeParams{BatchSize: 2048, UBatchSize: 512})
+	if want := bitsToGB(bpwValues.LMHeadBPW / 8 * 2048 * 128256); math.Abs(batched.logits-want) > 1e-9 {
+		t.Errorf("logits = %v GB, want %v", batched.logits, want)
+	}
+	// Activations are per token, so a 512 ubatch needs a sixteenth of a whole 8K context's
+	if math.Abs(batched.activations-single.activations/16) > 1e-12 {
+		t.Errorf("activations = %v GB for a 512 ubatch, want %v", batched.activations, single.activations/16)
+	}
+}
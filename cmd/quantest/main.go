@@ -4,18 +4,66 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/sammcj/quantest"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "plan":
+			runPlan(os.Args[2:])
+			return
+		case "simulate":
+			runSimulate(os.Args[2:])
+			return
+		case "train":
+			runTrain(os.Args[2:])
+			return
+		case "quants":
+			runQuants(os.Args[2:])
+			return
+		}
+	}
+
 	var modelName string
 	flag.StringVar(&modelName, "model", "", "Huggingface/ModelID or Ollama:modelName")
 	vram := flag.Float64("vram", quantest.DefaultVRAM, "Available vRAM in GB")
+	ram := flag.Float64("ram", 0, "Optional available system RAM in GB, defaults to the system's total RAM")
+	unifiedMemory := flag.Float64("unified-memory", 0, "Optional Apple Silicon unified memory in GB, sets --vram to the share the GPU can wire (overrides --vram)")
+	wiredLimit := flag.Int("wired-limit", 0, "Optional iogpu.wired_limit_mb sysctl in MB, overriding the GPU's share of --unified-memory")
 	contextSize := flag.Int("context", quantest.DefaultContextSize, "Optional context size")
-	quantLevel := flag.String("quant", quantest.DefaultQuantLevel, "Optional quantisation level")
-	kvQuant := flag.String("kvQuant", "fp16", "Optional KV Cache quantisation level")
+	quantLevel := flag.String("quant", "", "Optional quantisation level, a BPW such as 4.65bpw for EXL2 and EXL3, or e.g. awq-4bit-g128, gptq-8bit-g32, bnb-nf4-dq, mlx-4bit-g64, mlx-mixed-3-6, defaults to the model's own, inferred from its tag, filename or repository name, or "+quantest.DefaultQuantLevel)
+	kvQuant := flag.String("kvQuant", "fp16", "Optional KV Cache quantisation level (fp16, q8_0, q4_0, or ExLlama's q8, q6, q4)")
+	quantType := flag.String("quant-type", "", "Optional quantisation format (gguf, exl2, exl3, awq, gptq, bnb, mlx), detected from AWQ, GPTQ, bitsandbytes and MLX quant names, otherwise gguf")
+	headBits := flag.Int("head-bits", quantest.DefaultHeadBits, "Optional ExLlama output head bits (6 or 8) for EXL2 and EXL3")
+	quantsFile := flag.String("quants-file", "", "Optional JSON file (YAML isn't supported) of user-defined GGUF quant types to add to the built in ones")
+	scaledContext := flag.Bool("scaled-context", false, "Allow contexts beyond the model's max position embeddings using its RoPE scaling")
+	ropeScaling := flag.String("rope-scaling", "", "Optional RoPE scaling to apply (linear, dynamic, yarn, llama3), implies --scaled-context")
+	ropeFactor := flag.Float64("rope-factor", 0, "Optional RoPE scaling factor, implies --scaled-context")
+	gpus := flag.String("gpus", "", "Optional comma separated vRAM of each GPU in GB, e.g. 24,24,12 (overrides --vram)")
+	tensorSplit := flag.String("tensor-split", "", "Optional comma separated proportions of the model to place on each GPU, e.g. 3,3,1")
+	batchSize := flag.Int("batch", 0, "Optional logical batch size (n_batch), defaults to the whole context")
+	ubatchSize := flag.Int("ubatch", 0, "Optional physical micro-batch size (n_ubatch), defaults to the batch size")
+	parallel := flag.Int("parallel", 1, "Optional number of parallel slots (OLLAMA_NUM_PARALLEL, llama-server -np), each with its own KV cache")
+	numGPU := flag.Int("num-gpu", 0, "Optional number of layers to offload to the GPU (Ollama's num_gpu, llama.cpp's -ngl), defaults to the most that fit")
+	inputLength := flag.Int("input-length", 0, "Optional encoder input length for encoder-decoder models (T5, Whisper, BART)")
+	outputLength := flag.Int("output-length", 0, "Optional decoder output length for encoder-decoder models, defaults to --context")
+	workload := flag.String("workload", "", "Optional workload to estimate for (generate, embed, rerank), detected from the model by default")
+	embedBatch := flag.Int("embed-batch", 1, "Optional number of sequences per forward pass for embedding and reranker models, each of --context tokens")
+	loras := flag.String("lora", "", "Optional comma separated LoRA adapters to serve with the model, as PEFT adapter directories or GGUF files")
+	loraCount := flag.Int("lora-count", 0, "Optional number of LoRA adapters sized by --lora-rank and --lora-targets, in addition to --lora")
+	loraRank := flag.Int("lora-rank", quantest.DefaultLoRARank, "LoRA rank for adapters sized by --lora-count")
+	loraTargets := flag.String("lora-targets", strings.Join(quantest.DefaultLoRATargets, ","), "Comma separated LoRA target modules, or all-linear, for adapters sized by --lora-count")
+	loraServing := flag.String("lora-serving", string(quantest.AdapterServingLlamaCpp), "How LoRA adapters are served (llama.cpp keeps all loaded, vllm uses --max-loras GPU slots)")
+	maxLoras := flag.Int("max-loras", 0, "Optional number of vLLM GPU adapter slots (--max-loras), defaults to 1")
+	maxLoraRank := flag.Int("max-lora-rank", 0, "Optional vLLM adapter slot rank (--max-lora-rank), defaults to 16")
+	maxCPULoras := flag.Int("max-cpu-loras", 0, "Optional number of adapters vLLM caches in RAM (--max-cpu-loras), defaults to --max-loras")
+	draftModel := flag.String("draft", "", "Optional draft model for speculative decoding, estimated alongside the model")
+	draftQuant := flag.String("draft-quant", "", "Optional draft model quantisation level, defaults to the draft's own or "+quantest.DefaultQuantLevel)
+	draftMax := flag.Int("draft-max", quantest.DefaultDraftMax, "Optional maximum number of tokens drafted per step (llama.cpp's --draft-max)")
 	versionFlag := flag.Bool("v", false, "Print the version and exit")
 
 	flag.Parse()
@@ -34,15 +82,73 @@ func main() {
 		fmt.Println("Error: Model name is required. Use --model or provide it as the first argument.")
 		os.Exit(1)
 	}
+	gpuList, err := parseFloatList(*gpus)
+	if err != nil {
+		fmt.Printf("Error: invalid --gpus value: %v\n", err)
+		os.Exit(1)
+	}
+	splitList, err := parseFloatList(*tensorSplit)
+	if err != nil {
+		fmt.Printf("Error: invalid --tensor-split value: %v\n", err)
+		os.Exit(1)
+	}
+
+	var adapters []quantest.LoRAAdapter
+	if *loras != "" {
+		for _, path := range strings.Split(*loras, ",") {
+			adapters = append(adapters, quantest.LoRAAdapter{Path: strings.TrimSpace(path)})
+		}
+	}
+	for i := 0; i < *loraCount; i++ {
+		adapters = append(adapters, quantest.LoRAAdapter{
+			Name:    fmt.Sprintf("adapter-%d", i+1),
+			Rank:    *loraRank,
+			Targets: strings.Split(*loraTargets, ","),
+		})
+	}
+
+	registry := loadRegistry(*quantsFile)
+
 	// If this is where GetHFModelConfig or EstimateVRAMForModel is called:
-	estimation, err := quantest.EstimateVRAMForModel(modelName, *vram, *contextSize, *quantLevel, *kvQuant)
+	estimation, err := quantest.EstimateVRAMWithOptions(modelName, quantest.EstimateOptions{
+		VRAM:          *vram,
+		RAM:           *ram,
+		ContextSize:   *contextSize,
+		QuantLevel:    *quantLevel,
+		KVCacheQuant:  *kvQuant,
+		QuantType:     *quantType,
+		HeadBits:      *headBits,
+		Registry:      registry,
+		UnifiedMemory: *unifiedMemory,
+		WiredLimitMB:  *wiredLimit,
+		ScaledContext: *scaledContext,
+		RopeScaling:   *ropeScaling,
+		RopeFactor:    *ropeFactor,
+		InputLength:   *inputLength,
+		OutputLength:  *outputLength,
+		BatchSize:     *batchSize,
+		UBatchSize:    *ubatchSize,
+		Parallel:      *parallel,
+		GPULayers:     *numGPU,
+		GPUs:          gpuList,
+		TensorSplit:   splitList,
+		Workload:      quantest.Workload(strings.ToLower(*workload)),
+		EmbedBatch:    *embedBatch,
+		Adapters: quantest.AdapterOptions{
+			Adapters:    adapters,
+			Serving:     quantest.AdapterServing(strings.ToLower(*loraServing)),
+			MaxLoRAs:    *maxLoras,
+			MaxLoRARank: *maxLoraRank,
+			MaxCPULoRAs: *maxCPULoras,
+		},
+	})
 	if err != nil {
 		handleError(err, modelName)
 		os.Exit(1)
 	}
 
 	// Generate and print the quant estimation table
-	table, err := quantest.GenerateQuantTable(estimation.ModelConfig, *vram)
+	table, err := quantest.GenerateQuantTableWithRegistry(estimation.ModelConfig, estimation.AvailableVRAM, registry)
 	if err != nil {
 		// fmt.Printf("DEBUG: Error generating quant table: %v\n", err)
 		os.Exit(1)
@@ -65,10 +171,138 @@ func main() {
 	// Print the estimation results
 	fmt.Printf("\nEstimation Results:\n")
 	fmt.Printf("Model: %s\n", estimation.ModelName)
-	fmt.Printf("Estimated vRAM Required For A Context Size Of %d: %.2f GB\n", estimation.ContextSize, estimation.EstimatedVRAM)
+	fmt.Printf("Quantisation: %s (%s)\n", estimation.QuantLevel, estimation.QuantSource)
+	if encoder := estimation.ModelConfig.Encoder; estimation.ModelConfig.IsEncoderDecoder && encoder != nil {
+		input := encoder.InputLength
+		if input == 0 {
+			input = encoder.MaxPositions
+		}
+		fmt.Printf("Estimated vRAM Required For An Input Length Of %d And Output Length Of %d: %.2f GB\n", input, estimation.ContextSize, estimation.EstimatedVRAM)
+	} else if estimation.ModelConfig.IsEmbedding {
+		fmt.Printf("Estimated vRAM Required For A Batch Of %d Sequences Of %d Tokens: %.2f GB\n", max(*embedBatch, 1), estimation.ContextSize, estimation.EstimatedVRAM)
+	} else {
+		fmt.Printf("Estimated vRAM Required For A Context Size Of %d: %.2f GB\n", estimation.ContextSize, estimation.EstimatedVRAM)
+	}
+	fmt.Printf("Weights: %.2f GB layers, %.2f GB output head (vRAM), %.2f GB token embeddings (RAM)\n",
+		estimation.Weights.Layers, estimation.Weights.Output, estimation.Weights.TokenEmbedding)
+	for _, device := range estimation.Devices {
+		placement := "unused"
+		if device.Layers > 0 {
+			placement = fmt.Sprintf("layers %d-%d", device.FirstLayer, device.FirstLayer+device.Layers-1)
+		}
+		if device.Output {
+			placement += ", output head"
+		}
+		adapters := ""
+		if device.Adapters > 0 {
+			adapters = fmt.Sprintf(", %.2f GB adapters", device.Adapters)
+		}
+		fmt.Printf("GPU %d: %.2f / %.2f GB (%s) - %.2f GB weights, %.2f GB KV cache, %.2f GB compute, %.2f GB overhead%s\n",
+			device.Index, device.Total, device.Capacity, placement, device.Weights, device.KVCache, device.Compute, device.Overhead, adapters)
+	}
+	if adapters := estimation.Adapters; adapters != nil {
+		fmt.Printf("LoRA Adapters (%s): %d adapters in %d GPU slots - %.2f GB vRAM, %.2f GB RAM\n",
+			adapters.Serving, len(adapters.Adapters), adapters.Slots, adapters.VRAM, adapters.RAM)
+		for _, adapter := range adapters.Adapters {
+			rank := "unknown rank"
+			if adapter.Rank > 0 {
+				rank = fmt.Sprintf("rank %d", adapter.Rank)
+			}
+			fmt.Printf("  %s: %s, %.2fM parameters, %.2f GB\n", adapter.Name, rank, adapter.Params/1e6, adapter.Size)
+		}
+	}
 	fmt.Printf("Fits Available vRAM: %v\n", estimation.FitsAvailable)
+	if offload := estimation.Offload; offload.TotalLayers > 0 && (!estimation.FitsAvailable || *numGPU > 0) {
+		fmt.Printf("GPU Layers (num_gpu / -ngl): %d/%d - %.2f GB vRAM, %.2f GB RAM\n", offload.GPULayers, offload.TotalLayers, offload.VRAM, offload.RAM)
+	}
+	fmt.Printf("Estimated RAM Required: %.2f GB of %.2f GB available\n", estimation.EstimatedRAM, estimation.AvailableRAM)
+	switch estimation.Fit {
+	case quantest.FitGPU:
+		fmt.Println("Fit: entirely on GPU")
+	case quantest.FitCPUSpill:
+		fmt.Println("Fit: with CPU spill, some layers run from system RAM")
+	case quantest.FitNone:
+		fmt.Println("Fit: does not fit in vRAM and RAM combined")
+	}
 	fmt.Printf("Max Context Size: %d\n", estimation.MaxContextSize)
+	if estimation.ModelConfig.IsEmbedding {
+		fmt.Printf("Max Sequences Per Batch At Context %d: %d (%d tokens per forward pass)\n",
+			estimation.ContextSize, estimation.MaxEmbedBatch, estimation.MaxEmbedBatch*estimation.ContextSize)
+	}
 	fmt.Printf("Maximum Quantisation: %s\n", estimation.MaximumQuant)
+
+	for _, warning := range estimation.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+
+	if *draftModel != "" {
+		printSpeculative(estimation, *draftModel, quantest.SpeculativeOptions{
+			VRAM:            estimation.AvailableVRAM,
+			ContextSize:     estimation.ContextSize,
+			KVCacheQuant:    estimation.KVCacheQuant,
+			TargetQuant:     estimation.QuantLevel,
+			TargetQuantType: string(estimation.QuantFormat),
+			DraftQuant:      *draftQuant,
+			DraftMax:        *draftMax,
+			Params:          quantest.RuntimeParams{BatchSize: *batchSize, UBatchSize: *ubatchSize, Parallel: *parallel},
+			Registry:        registry,
+		})
+	}
+}
+
+// printSpeculative prints the estimate for running the model with a draft model
+func printSpeculative(estimation *quantest.VRAMEstimation, draftModel string, opts quantest.SpeculativeOptions) {
+	draftConfig, err := quantest.GetModelConfig(draftModel)
+	if err != nil {
+		handleError(err, draftModel)
+		os.Exit(1)
+	}
+
+	estimate, err := quantest.EstimateSpeculative(estimation.ModelConfig, draftConfig, opts)
+	if err != nil {
+		fmt.Printf("Error estimating speculative decoding: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\nSpeculative Decoding With %s (draft-max %d):\n---\n", draftModel, estimate.DraftMax)
+	for _, model := range []struct {
+		name  string
+		usage quantest.SpeculativeModelUsage
+	}{{"Target", estimate.Target}, {"Draft", estimate.Draft}} {
+		fmt.Printf("%s (%s): %.2f GB - %.2f GB weights, %.2f GB KV cache, %.2f GB compute, %.2f GB overhead\n", model.name,
+			model.usage.Quant, model.usage.Total, model.usage.Weights, model.usage.KVCache, model.usage.Compute, model.usage.Overhead)
+	}
+	fmt.Printf("Draft Buffers: %.2f GB\n", estimate.DraftBuffers)
+	fmt.Printf("Estimated vRAM Required For Both: %.2f GB of %.2f GB available\n", estimate.Total, estimate.AvailableVRAM)
+	fmt.Printf("Fits Available vRAM: %v\n", estimate.Fits)
+
+	// Search every combination, keeping only a draft quant the user asked for
+	opts.TargetQuant = ""
+	if best, err := quantest.BestSpeculativeQuants(estimation.ModelConfig, draftConfig, opts); err == nil {
+		fmt.Printf("Best Quant Combination: %s target + %s draft (%.2f GB)\n", best.Target.Quant, best.Draft.Quant, best.Total)
+	} else {
+		fmt.Printf("Best Quant Combination: %v\n", err)
+	}
+
+	for _, warning := range estimate.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+}
+
+// parseFloatList parses a comma separated list of numbers
+func parseFloatList(input string) ([]float64, error) {
+	if input == "" {
+		return nil, nil
+	}
+	var values []float64
+	for _, field := range strings.Split(input, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
 }
 
 func handleError(err error, modelName string) {
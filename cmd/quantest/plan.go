@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sammcj/quantest"
+)
+
+// runPlan checks whether a set of models can be loaded at the same time
+func runPlan(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	vram := flags.Float64("vram", quantest.DefaultVRAM, "Available vRAM in GB")
+	gpus := flags.String("gpus", "", "Optional comma separated vRAM of each GPU in GB, e.g. 24,24,12 (overrides --vram)")
+	maxLoaded := flags.Int("max-loaded", 0, "Optional maximum number of loaded models, defaults to OLLAMA_MAX_LOADED_MODELS or 3 per GPU")
+	quantsFile := flags.String("quants-file", "", "Optional JSON file (YAML isn't supported) of user-defined GGUF quant types to add to the built in ones")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of plan: quantest plan [flags] models.json")
+		fmt.Fprintln(flags.Output(), `models.json lists the models to keep loaded, e.g. [{"model": "nomic-embed-text:latest", "context": 2048, "quant": "Q8_0"}, {"model": "qwen2.5:14b", "context": 16384, "quant": "Q4_K_M", "kv_quant": "q8_0", "parallel": 2, "batch_size": 512, "ubatch_size": 512}, {"model": "Qwen/Qwen2.5-7B-Instruct-AWQ", "quant_type": "awq"}]`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	models, err := readResidentModels(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", flags.Arg(0), err)
+		os.Exit(1)
+	}
+	registry := loadRegistry(*quantsFile)
+	for i := range models {
+		models[i].Registry = registry
+	}
+
+	plan, err := quantest.PlanCoResidency(models, gpuCapacities(*vram, *gpus), maxLoadedModels(*maxLoaded))
+	if err != nil {
+		fmt.Printf("Error planning co-residency: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("📦 Co-residency plan for %d models on %d GPU(s), max %d loaded:\n---\n", len(plan.Models), len(plan.GPUs), plan.MaxLoaded)
+	for _, estimate := range plan.Models {
+		placement := "not loaded"
+		if estimate.Loaded {
+			placement = "GPU " + strings.Trim(strings.Join(strings.Fields(fmt.Sprint(estimate.GPUs)), ","), "[]")
+		}
+		fmt.Printf("%s (%s, context %d, KV %s): %.2f GB - %s\n", estimate.Model.Name, estimate.Model.QuantLevel,
+			estimate.Model.ContextSize, estimate.Model.KVCacheQuant, estimate.VRAM, placement)
+	}
+	fmt.Printf("\nTotal vRAM Required: %.2f GB of %.2f GB available\n", plan.TotalVRAM, plan.AvailableVRAM)
+	fmt.Printf("All Models Resident: %v\n", plan.Fits)
+
+	if len(plan.Suggestions) > 0 {
+		fmt.Println("\nSuggested reductions:\n---")
+		for _, suggestion := range plan.Suggestions {
+			fmt.Printf("%s: %s %s -> %s (saves %.2f GB)\n", suggestion.Model, suggestion.Change, suggestion.From, suggestion.To, suggestion.Saving)
+		}
+		fmt.Printf("All Models Resident With Reductions: %v\n", plan.FitsWithSuggestions)
+	}
+}
+
+// readResidentModels reads a JSON list of models, either bare or under a "models" key
+func readResidentModels(path string) ([]quantest.ResidentModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []quantest.ResidentModel
+	if err := json.Unmarshal(data, &models); err == nil {
+		return models, nil
+	}
+
+	var wrapped struct {
+		Models []quantest.ResidentModel `json:"models"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	return wrapped.Models, nil
+}
+
+// gpuCapacities returns the vRAM of each GPU from the --gpus flag, falling back to a single GPU of --vram
+func gpuCapacities(vram float64, gpus string) []float64 {
+	gpuList, err := parseFloatList(gpus)
+	if err != nil {
+		fmt.Printf("Error: invalid --gpus value: %v\n", err)
+		os.Exit(1)
+	}
+	if len(gpuList) == 0 {
+		gpuList = []float64{vram}
+	}
+	return gpuList
+}
+
+// maxLoadedModels returns the --max-loaded flag, falling back to OLLAMA_MAX_LOADED_MODELS
+func maxLoadedModels(maxLoaded int) int {
+	if maxLoaded == 0 {
+		if env, err := strconv.Atoi(os.Getenv("OLLAMA_MAX_LOADED_MODELS")); err == nil {
+			return env
+		}
+	}
+	return maxLoaded
+}
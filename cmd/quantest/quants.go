@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sammcj/quantest"
+)
+
+// runQuants lists the quant types quantest knows, or explains the named ones
+func runQuants(args []string) {
+	flags := flag.NewFlagSet("quants", flag.ExitOnError)
+	family := flags.String("family", "", "Optional family to list (float, microscaled, legacy, k-quant, i-quant, ternary, repacked, dynamic)")
+	gpuOnly := flags.Bool("gpu", false, "Only list quants with GPU kernels")
+	cpuOnly := flags.Bool("cpu", false, "Only list quants with CPU kernels")
+	quantsFile := flags.String("quants-file", "", "Optional JSON file (YAML isn't supported) of user-defined quant types to list with the built in ones")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of quants: quantest quants [flags] [quant...]")
+		fmt.Fprintln(flags.Output(), "Lists the GGUF quant types from the lowest BPW to the highest, or explains the named ones, e.g. quantest quants Q4_K_M IQ3_S")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	registry := loadRegistry(*quantsFile)
+	if flags.NArg() > 0 {
+		for i, name := range flags.Args() {
+			quant, err := registry.Resolve(name)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			explainQuant(quant)
+		}
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "QUANT\tFAMILY\tBPW\tBLOCK\tIMATRIX\tRUNS ON\tQUALITY\tALIASES\tNOTE")
+	for _, quant := range registry.Quants() {
+		if (*family != "" && string(quant.Family) != strings.ToLower(*family)) || (*gpuOnly && !quant.GPU) || (*cpuOnly && !quant.CPU) {
+			continue
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%.2f\t%d\t%s\t%s\t%d\t%s\t%s\n", quant.Name, quant.Family, quant.BPW, quant.BlockSize,
+			orDash(string(quant.Imatrix)), runsOn(quant), quant.Quality, orDash(strings.Join(quant.Aliases, ", ")), quant.Note)
+	}
+	writer.Flush()
+}
+
+// explainQuant prints what a quant type is and where it runs
+func explainQuant(quant quantest.QuantSpec) {
+	fmt.Printf("🧮 %s: %.2f BPW, %s\n---\n", quant.Name, quant.BPW, quant.Family)
+	fmt.Printf("Family: %s\n", quant.Family.Description())
+	if quant.BlockSize > 0 {
+		fmt.Printf("Block Size: %d weights\n", quant.BlockSize)
+	}
+	fmt.Printf("Runs On: %s\n", runsOn(quant))
+	switch quant.Imatrix {
+	case quantest.ImatrixRequired:
+		fmt.Println("Importance Matrix: required, llama-quantize refuses to make it without one")
+	case quantest.ImatrixRecommended:
+		fmt.Println("Importance Matrix: recommended")
+	default:
+		fmt.Println("Importance Matrix: not needed")
+	}
+	fmt.Printf("Quality Rank: %d (higher is better)\n", quant.Quality)
+	if len(quant.Aliases) > 0 {
+		fmt.Printf("Aliases: %s\n", strings.Join(quant.Aliases, ", "))
+	}
+	if quant.Note != "" {
+		fmt.Printf("Note: %s\n", quant.Note)
+	}
+	if recipe := quant.Recipe; recipe != nil {
+		fmt.Printf("Recipe: %s", recipe.Base)
+		if recipe.TokenEmbeddingType != "" {
+			fmt.Printf(", token embedding %s", recipe.TokenEmbeddingType)
+		}
+		if recipe.OutputType != "" {
+			fmt.Printf(", output %s", recipe.OutputType)
+		}
+		if len(recipe.TensorTypes) > 0 {
+			fmt.Printf(", %s", strings.Join(recipe.TensorTypes, ", "))
+		}
+		fmt.Println()
+	}
+	if quant.KVCache != "" {
+		fmt.Printf("KV Cache: always %s\n", quant.KVCache)
+	}
+}
+
+// loadRegistry returns the built in quant types, with any from the --quants-file added
+func loadRegistry(path string) *quantest.Registry {
+	if path == "" {
+		return quantest.DefaultRegistry()
+	}
+	quants, err := quantest.LoadQuants(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	registry, err := quantest.DefaultRegistry().With(quants...)
+	if err != nil {
+		fmt.Printf("Error in %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	return registry
+}
+
+// runsOn describes where a quant has efficient kernels
+func runsOn(quant quantest.QuantSpec) string {
+	switch {
+	case quant.CPU && quant.GPU:
+		return "CPU, GPU"
+	case quant.GPU:
+		return "GPU"
+	case quant.CPU:
+		return "CPU"
+	}
+	return "-"
+}
+
+// orDash returns the value, or a dash when it's empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
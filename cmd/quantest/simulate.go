@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sammcj/quantest"
+)
+
+// runSimulate replays a request trace, or a synthetic mix, through Ollama's scheduler
+func runSimulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	vram := flags.Float64("vram", quantest.DefaultVRAM, "Available vRAM in GB")
+	gpus := flags.String("gpus", "", "Optional comma separated vRAM of each GPU in GB, e.g. 24,24,12 (overrides --vram)")
+	maxLoaded := flags.Int("max-loaded", 0, "Optional maximum number of loaded models, defaults to OLLAMA_MAX_LOADED_MODELS or 3 per GPU")
+	keepAlive := flags.String("keep-alive", os.Getenv("OLLAMA_KEEP_ALIVE"), "Optional keep_alive for idle models, defaults to OLLAMA_KEEP_ALIVE or 5m")
+	requestDuration := flags.Duration("request-duration", 10*time.Second, "How long each request keeps its model busy, unless the trace sets a duration")
+	mixFile := flags.String("mix", "", "Optional JSON file of models and weights to generate a synthetic trace from, instead of a trace file")
+	rate := flags.Float64("rate", 60, "Requests per hour for a synthetic trace")
+	length := flags.Duration("length", 8*time.Hour, "Length of a synthetic trace")
+	seed := flags.Int64("seed", 1, "Random seed for a synthetic trace")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of simulate: quantest simulate [flags] trace.jsonl | quantest simulate --mix mix.json [flags]")
+		fmt.Fprintln(flags.Output(), `trace.jsonl holds one request per line (or a JSON array), e.g. {"timestamp": "2024-06-01T09:00:00Z", "model": "qwen2.5:14b", "context": 8192, "duration": 12, "keep_alive": "10m"}`)
+		fmt.Fprintln(flags.Output(), `mix.json lists the models to generate requests for, e.g. [{"model": "qwen2.5:14b", "context": 8192, "weight": 3}, {"model": "llama3.1:8b", "weight": 1}]`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var trace []quantest.SimRequest
+	var err error
+	switch {
+	case *mixFile != "" && flags.NArg() == 0:
+		var mix []quantest.SimMixEntry
+		if err = readJSONFile(*mixFile, &mix); err == nil {
+			trace, err = quantest.SyntheticTrace(mix, *rate, *length, *seed)
+		}
+	case *mixFile == "" && flags.NArg() == 1:
+		trace, err = readTrace(flags.Arg(0))
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error reading requests: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := quantest.SimulateScheduler(trace, quantest.SimulationOptions{
+		GPUs:            gpuCapacities(*vram, *gpus),
+		MaxLoaded:       maxLoadedModels(*maxLoaded),
+		KeepAlive:       *keepAlive,
+		RequestDuration: *requestDuration,
+	})
+	if err != nil {
+		fmt.Printf("Error simulating scheduler: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔁 Simulated %d requests over %s:\n---\n", result.Requests, result.Span.Round(time.Second))
+	for _, model := range result.Models {
+		fmt.Printf("%s (%.2f GB): %d requests, %d cold loads, %d reloads, %d evictions\n",
+			model.Model, model.VRAM, model.Requests, model.ColdLoads, model.Reloads, model.Evictions)
+	}
+	fmt.Printf("\nCold Loads: %d (%.1f%% of requests)\n", result.ColdLoads, result.ColdLoadRate*100)
+	if hours := result.Span.Hours(); hours > 0 {
+		fmt.Printf("Cold Loads Per Hour: %.1f\n", float64(result.ColdLoads)/hours)
+	}
+	fmt.Printf("Swaps: %d (%d models evicted)\n", result.Swaps, result.Evictions)
+	fmt.Printf("Reloads For Changed Options: %d\n", result.Reloads)
+	fmt.Printf("Keep Alive Expiries: %d\n", result.Expiries)
+	fmt.Printf("Requests Queued Behind Busy Models: %d (%s total)\n", result.Waits, result.WaitTime.Round(time.Second))
+	if result.Spills > 0 {
+		fmt.Printf("Loads Too Large For vRAM: %d\n", result.Spills)
+	}
+	fmt.Printf("Peak vRAM: %.2f GB with %d models loaded\n", result.PeakVRAM, result.PeakLoaded)
+}
+
+// readTrace reads requests from a JSON array or one JSON object per line
+func readTrace(path string) ([]quantest.SimRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var trace []quantest.SimRequest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = decoder.Decode(&trace)
+		return trace, err
+	}
+	for decoder.More() {
+		var request quantest.SimRequest
+		if err := decoder.Decode(&request); err != nil {
+			return nil, fmt.Errorf("request %d: %w", len(trace)+1, err)
+		}
+		trace = append(trace, request)
+	}
+	return trace, nil
+}
+
+// readJSONFile decodes a JSON file into v
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sammcj/quantest"
+)
+
+// runTrain estimates the memory needed to fine-tune a model
+func runTrain(args []string) {
+	flags := flag.NewFlagSet("train", flag.ExitOnError)
+	var modelName string
+	flags.StringVar(&modelName, "model", "", "Huggingface/ModelID or Ollama:modelName")
+	vram := flags.Float64("vram", quantest.DefaultVRAM, "Available vRAM per GPU in GB")
+	method := flags.String("method", string(quantest.TrainingFull), "Fine-tuning method (full, lora, qlora)")
+	optimizer := flags.String("optimizer", string(quantest.OptimizerAdamW), "Optimizer (adamw, adamw-8bit, adafactor, sgd), HF Trainer optim names are accepted")
+	precision := flags.String("precision", string(quantest.PrecisionMixed), "Training precision (mixed, bf16, fp32)")
+	batchSize := flags.Int("batch", 1, "Micro-batch size per GPU")
+	sequenceLength := flags.Int("seq", quantest.DefaultTrainingSequenceLength, "Sequence length")
+	checkpointing := flags.Bool("checkpointing", false, "Use gradient checkpointing")
+	eagerAttention := flags.Bool("eager-attention", false, "Use eager attention, which stores the attention scores, instead of flash attention or SDPA")
+	rank := flags.Int("rank", quantest.DefaultLoRARank, "LoRA rank")
+	targets := flags.String("targets", strings.Join(quantest.DefaultLoRATargets, ","), "Comma separated LoRA target modules, or all-linear")
+	quantBits := flags.Int("quant-bits", 4, "QLoRA base model quantisation in bits (4 or 8)")
+	numGPUs := flags.Int("num-gpus", 1, "Number of GPUs training data parallel")
+	zeroStage := flags.Int("zero", 0, "ZeRO stage (0-3) sharding optimizer states, gradients and weights across GPUs")
+	flags.Parse(args)
+
+	if modelName == "" && flags.NArg() > 0 {
+		modelName = flags.Arg(0)
+	}
+	if modelName == "" {
+		fmt.Println("Error: Model name is required. Use --model or provide it as the first argument.")
+		os.Exit(1)
+	}
+
+	config, err := quantest.GetModelConfig(modelName)
+	if err != nil {
+		fmt.Printf("Error getting model config: %v\n", err)
+		os.Exit(1)
+	}
+
+	estimate, err := quantest.EstimateTrainingMemory(config, quantest.TrainingOptions{
+		Method:                quantest.TrainingMethod(strings.ToLower(*method)),
+		Optimizer:             quantest.Optimizer(*optimizer),
+		Precision:             quantest.TrainingPrecision(strings.ToLower(*precision)),
+		MicroBatchSize:        *batchSize,
+		SequenceLength:        *sequenceLength,
+		GradientCheckpointing: *checkpointing,
+		EagerAttention:        *eagerAttention,
+		LoRARank:              *rank,
+		LoRATargets:           strings.Split(*targets, ","),
+		QuantBits:             *quantBits,
+		NumGPUs:               *numGPUs,
+		ZeROStage:             *zeroStage,
+	})
+	if err != nil {
+		fmt.Printf("Error estimating training memory: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := estimate.Options
+	fmt.Printf("🏋️ Fine-tuning memory for %s (%s, %s, %s precision):\n---\n", modelName, opts.Method, opts.Optimizer, opts.Precision)
+	fmt.Printf("Micro-Batch: %d x %d tokens, Gradient Checkpointing: %v\n", opts.MicroBatchSize, opts.SequenceLength, opts.GradientCheckpointing)
+	if opts.Method != quantest.TrainingFull {
+		fmt.Printf("LoRA: rank %d on %s\n", opts.LoRARank, strings.Join(opts.LoRATargets, ", "))
+	}
+	if opts.NumGPUs > 1 {
+		fmt.Printf("GPUs: %d, ZeRO Stage %d\n", opts.NumGPUs, opts.ZeROStage)
+	}
+	fmt.Printf("Parameters: %.2fB total, %.2fM trainable (%.2f%%)\n\n", estimate.TotalParams/1e9, estimate.TrainableParams/1e6,
+		estimate.TrainableParams/estimate.TotalParams*100)
+
+	fmt.Printf("Weights: %.2f GB\n", estimate.Weights)
+	fmt.Printf("Gradients: %.2f GB\n", estimate.Gradients)
+	fmt.Printf("Optimizer States: %.2f GB\n", estimate.OptimizerStates)
+	fmt.Printf("Activations: %.2f GB\n", estimate.Activations)
+	fmt.Printf("Logits: %.2f GB\n", estimate.Logits)
+	fmt.Printf("CUDA Overhead: %.2f GB\n", estimate.Overhead)
+	fmt.Printf("\nPer GPU: %.2f GB of %.2f GB available\n", estimate.PerGPU, *vram)
+	fmt.Printf("Fits: %v\n", estimate.PerGPU <= *vram)
+}
@@ -0,0 +1,346 @@
+// File: quantest/config.go
+
+package quantest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// KeyHeadDim returns the per-head dimension of the attention keys.
+//
+// An explicit GGUF key length or HF head_dim takes precedence over the
+// hidden_size / num_attention_heads derivation, which is wrong for families
+// such as Gemma and Qwen3 that decouple the head size from the hidden size.
+func (c ModelConfig) KeyHeadDim() float64 {
+	if c.KeyLength > 0 {
+		return float64(c.KeyLength)
+	}
+	return c.headDim()
+}
+
+// ValueHeadDim returns the per-head dimension of the attention values.
+func (c ModelConfig) ValueHeadDim() float64 {
+	if c.ValueLength > 0 {
+		return float64(c.ValueLength)
+	}
+	return c.headDim()
+}
+
+// headDim returns the shared head dimension when keys and values are not sized separately.
+func (c ModelConfig) headDim() float64 {
+	if c.HeadDim > 0 {
+		return float64(c.HeadDim)
+	}
+	if c.NumAttentionHeads == 0 {
+		return 0
+	}
+	return float64(c.HiddenSize) / float64(c.NumAttentionHeads)
+}
+
+// kvHeads returns the number of key/value heads, treating configs that omit
+// num_key_value_heads as plain multi-head attention.
+func (c ModelConfig) kvHeads() int {
+	if c.NumKeyValueHeads > 0 {
+		return c.NumKeyValueHeads
+	}
+	return c.NumAttentionHeads
+}
+
+// embeddingParams returns the number of parameters in the token embedding matrix.
+func (c ModelConfig) embeddingParams() float64 {
+	if c.TokenEmbeddingParams > 0 {
+		return c.TokenEmbeddingParams
+	}
+	return float64(c.VocabSize) * float64(c.HiddenSize)
+}
+
+// outputParams returns the number of parameters in the output head. Tied
+// models still get an output tensor on the GPU as llama.cpp duplicates the
+// token embedding for it.
+func (c ModelConfig) outputParams() float64 {
+	if c.OutputParams > 0 {
+		return c.OutputParams
+	}
+	return c.embeddingParams()
+}
+
+// layerParams returns the number of parameters in the repeating layers, i.e.
+// everything that is neither the token embedding nor an untied output head.
+// Without a known parameter count it sums the per-layer shape estimates.
+func (c ModelConfig) layerParams() float64 {
+	if c.NumParams == 0 {
+		var params float64
+		for _, layer := range c.LayerConfigs() {
+			params += c.layerShapeParams(layer)
+		}
+		return params
+	}
+
+	params := c.NumParams*1e9 - c.embeddingParams()
+	if !c.TieWordEmbeddings {
+		params -= c.outputParams()
+	}
+	return math.Max(params, 0)
+}
+
+// shapeParams estimates the model's parameter count from its shape, including
+// an encoder-decoder model's encoder.
+func (c ModelConfig) shapeParams() float64 {
+	params := c.embeddingParams()
+	if !c.TieWordEmbeddings {
+		params += c.outputParams()
+	}
+	for _, layer := range c.LayerConfigs() {
+		params += c.layerShapeParams(layer)
+	}
+	if c.IsEncoderDecoder {
+		encoder := c.encoder()
+		layer := LayerConfig{NumAttentionHeads: encoder.NumAttentionHeads, NumKeyValueHeads: encoder.NumAttentionHeads, IntermediateSize: encoder.IntermediateSize}
+		params += float64(encoder.NumLayers) * c.layerShapeParams(layer)
+	}
+	return params
+}
+
+// Kind returns the RoPE scaling method, e.g. linear, dynamic, yarn or llama3.
+func (r RopeScaling) Kind() string {
+	if r.RopeType != "" {
+		return strings.ToLower(r.RopeType)
+	}
+	return strings.ToLower(r.Type)
+}
+
+// extendsContext reports whether the scaling method stretches the usable context.
+func (r RopeScaling) extendsContext() bool {
+	switch r.Kind() {
+	case "linear", "dynamic", "yarn", "llama3", "longrope", "su":
+		return r.Factor > 1
+	}
+	return false
+}
+
+// TrainedContext returns the context length the model was originally trained on.
+func (c ModelConfig) TrainedContext() int {
+	if c.RopeScaling != nil && c.RopeScaling.OriginalMaxPositionEmbeddings > 0 {
+		return c.RopeScaling.OriginalMaxPositionEmbeddings
+	}
+	return c.MaxPositionEmbeddings
+}
+
+// ScaledContext returns the longest context the model supports with its RoPE scaling applied.
+func (c ModelConfig) ScaledContext() int {
+	if c.RopeScaling == nil || !c.RopeScaling.extendsContext() {
+		return c.MaxPositionEmbeddings
+	}
+	scaled := int(float64(c.TrainedContext()) * c.RopeScaling.Factor)
+	if scaled < c.MaxPositionEmbeddings {
+		return c.MaxPositionEmbeddings
+	}
+	return scaled
+}
+
+// WithScaledContext returns a copy of the config whose maximum context is
+// extended to its RoPE scaled length. A non-empty kind or factor overrides
+// the config's own scaling, which is how YaRN is enabled for models such as
+// Qwen that document but don't declare it.
+func (c ModelConfig) WithScaledContext(kind string, factor float64) ModelConfig {
+	if kind != "" || factor > 0 {
+		scaling := RopeScaling{OriginalMaxPositionEmbeddings: c.TrainedContext()}
+		if c.RopeScaling != nil {
+			scaling = *c.RopeScaling
+			scaling.OriginalMaxPositionEmbeddings = c.TrainedContext()
+		}
+		if kind != "" {
+			scaling.RopeType = kind
+		}
+		if factor > 0 {
+			scaling.Factor = factor
+		}
+		if scaling.Kind() == "" {
+			scaling.RopeType = "yarn"
+		}
+		scaling.enabled = true
+		c.RopeScaling = &scaling
+	}
+	c.MaxPositionEmbeddings = c.ScaledContext()
+	return c
+}
+
+// trainedWithScaling reports whether the model ships RoPE scaling it was trained
+// with, as Llama 3.1's llama3 scaling and YaRN with a factor are, so contexts
+// up to its max position embeddings need no warning.
+func (c ModelConfig) trainedWithScaling() bool {
+	if c.RopeScaling == nil || c.RopeScaling.enabled {
+		return false
+	}
+	switch c.RopeScaling.Kind() {
+	case "llama3":
+		return true
+	case "yarn":
+		return c.RopeScaling.Factor > 0
+	}
+	return false
+}
+
+// contextWarnings flags contexts that exceed what the model was trained or scaled for.
+func contextWarnings(config ModelConfig, context int) []string {
+	var warnings []string
+
+	switch {
+	case config.MaxPositionEmbeddings == 0:
+	case context > config.ScaledContext():
+		warnings = append(warnings, fmt.Sprintf("context %d exceeds the model's maximum context of %d, even with RoPE scaling", context, config.ScaledContext()))
+	case context > config.MaxPositionEmbeddings:
+		warnings = append(warnings, fmt.Sprintf("context %d exceeds max position embeddings of %d, the model's %s RoPE scaling supports up to %d if enabled", context, config.MaxPositionEmbeddings, config.RopeScaling.Kind(), config.ScaledContext()))
+	case context > config.TrainedContext() && !config.trainedWithScaling():
+		warnings = append(warnings, fmt.Sprintf("context %d is beyond the trained context of %d and relies on %s RoPE scaling (x%.1f)", context, config.TrainedContext(), config.RopeScaling.Kind(), config.RopeScaling.Factor))
+	}
+
+	return warnings
+}
+
+// LayerConfigs returns the shape of every layer, expanding uniform models from
+// their top-level fields.
+func (c ModelConfig) LayerConfigs() []LayerConfig {
+	if len(c.Layers) > 0 {
+		return c.Layers
+	}
+
+	layers := make([]LayerConfig, c.NumHiddenLayers)
+	for i := range layers {
+		layers[i] = LayerConfig{
+			NumAttentionHeads: c.NumAttentionHeads,
+			NumKeyValueHeads:  c.kvHeads(),
+			IntermediateSize:  c.IntermediateSize,
+		}
+	}
+	return layers
+}
+
+// layerShapeParams estimates the number of parameters in a layer from its shape.
+func (c ModelConfig) layerShapeParams(layer LayerConfig) float64 {
+	hidden := float64(c.HiddenSize)
+
+	attention := hidden * (float64(layer.NumAttentionHeads+layer.NumKeyValueHeads)*c.KeyHeadDim() +
+		float64(layer.NumKeyValueHeads+layer.NumAttentionHeads)*c.ValueHeadDim())
+	if layer.LinearAttention {
+		attention = hidden * hidden
+	}
+
+	ffn := 3 * hidden * float64(layer.IntermediateSize)
+	if layer.LinearFFN {
+		ffn = hidden * hidden
+	}
+
+	return attention + ffn + 2*hidden
+}
+
+// linearModule represents a linear projection in a layer, named as in the HF checkpoint.
+type linearModule struct {
+	name    string
+	in, out float64
+}
+
+// linearModules returns the linear projections in a layer.
+func (c ModelConfig) linearModules(layer LayerConfig) []linearModule {
+	hidden := float64(c.HiddenSize)
+	keyDim, valueDim := c.KeyHeadDim(), c.ValueHeadDim()
+	heads, kvHeads := float64(layer.NumAttentionHeads), float64(layer.NumKeyValueHeads)
+	intermediate := float64(layer.IntermediateSize)
+
+	var modules []linearModule
+	if layer.LinearAttention {
+		modules = append(modules, linearModule{"linear_attn", hidden, hidden})
+	} else {
+		modules = append(modules,
+			linearModule{"q_proj", hidden, heads * keyDim},
+			linearModule{"k_proj", hidden, kvHeads * keyDim},
+			linearModule{"v_proj", hidden, kvHeads * valueDim},
+			linearModule{"o_proj", heads * valueDim, hidden},
+		)
+	}
+	if layer.LinearFFN {
+		modules = append(modules, linearModule{"linear_mlp", hidden, hidden})
+	} else {
+		modules = append(modules,
+			linearModule{"gate_proj", hidden, intermediate},
+			linearModule{"up_proj", hidden, intermediate},
+			linearModule{"down_proj", intermediate, hidden},
+		)
+	}
+	return modules
+}
+
+// layerParamsPerLayer returns the number of parameters in each repeating layer.
+// Shape estimates are scaled to the model's actual parameter count when known,
+// so that uneven layers still sum to the real total.
+func (c ModelConfig) layerParamsPerLayer() []float64 {
+	layers := c.LayerConfigs()
+	params := make([]float64, len(layers))
+
+	var estimated float64
+	for i, layer := range layers {
+		params[i] = c.layerShapeParams(layer)
+		estimated += params[i]
+	}
+
+	if c.NumParams > 0 && estimated > 0 {
+		scale := c.layerParams() / estimated
+		for i := range params {
+			params[i] *= scale
+		}
+	}
+	return params
+}
+
+// kvCacheElements returns the number of KV cache elements across all layers.
+func (c ModelConfig) kvCacheElements(context int, gqa bool) float64 {
+	var elements float64
+	for _, layerElements := range c.kvCacheElementsPerLayer(context, gqa) {
+		elements += layerElements
+	}
+	return elements
+}
+
+// kvCacheElementsPerLayer returns the number of KV cache elements in each layer,
+// capping sliding window layers at their window.
+func (c ModelConfig) kvCacheElementsPerLayer(context int, gqa bool) []float64 {
+	keyDim, valueDim := c.KeyHeadDim(), c.ValueHeadDim()
+
+	layers := c.LayerConfigs()
+	elements := make([]float64, len(layers))
+	for i, layer := range layers {
+		if layer.LinearAttention {
+			continue
+		}
+		kvHeads := layer.NumAttentionHeads
+		if gqa {
+			kvHeads = layer.NumKeyValueHeads
+		}
+		cells := context
+		if layer.SlidingWindow > 0 && layer.SlidingWindow < cells {
+			cells = layer.SlidingWindow
+		}
+		elements[i] = float64(cells*kvHeads) * (keyDim + valueDim)
+	}
+	return elements
+}
+
+// slots returns the number of parallel sequences the KV cache is sized for.
+func (p RuntimeParams) slots() int {
+	return max(p.Parallel, 1)
+}
+
+// tokens returns the number of tokens the compute buffers and logits are sized for.
+func (p RuntimeParams) tokens(context int) (tokens, outputs int) {
+	tokens, outputs = context, context
+	if p.BatchSize > 0 {
+		tokens = min(tokens, p.BatchSize)
+		outputs = min(outputs, p.BatchSize)
+	}
+	if p.UBatchSize > 0 {
+		tokens = min(tokens, p.UBatchSize)
+	}
+	return tokens, outputs
+}
@@ -0,0 +1,118 @@
+// File: quantest/config_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHeadDims(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    ModelConfig
+		wantKey   float64
+		wantValue float64
+	}{
+		// Gemma 2 2B's 8 heads of 256 are wider than its 2304 hidden size implies
+		{"gemma-2-2b", ModelConfig{HiddenSize: 2304, NumAttentionHeads: 8, HeadDim: 256}, 256, 256},
+		{"llama-3.1-8b", ModelConfig{HiddenSize: 4096, NumAttentionHeads: 32}, 128, 128},
+		// GGUF key_length and value_length override head_dim, e.g. DeepSeek's 192 and 128
+		{"separate key and value", ModelConfig{HiddenSize: 2048, NumAttentionHeads: 16, HeadDim: 128, KeyLength: 192, ValueLength: 128}, 192, 128},
+		{"no heads", ModelConfig{HiddenSize: 2048}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.KeyHeadDim(); got != test.wantKey {
+				t.Errorf("KeyHeadDim() = %v, want %v", got, test.wantKey)
+			}
+			if got := test.config.ValueHeadDim(); got != test.wantValue {
+				t.Errorf("ValueHeadDim() = %v, want %v", got, test.wantValue)
+			}
+		})
+	}
+}
+
+func TestKVCacheElementsHeadDims(t *testing.T) {
+	// Gemma 2 2B: 26 layers x 4 KV heads x (256 + 256) per token
+	gemma := ModelConfig{HiddenSize: 2304, NumAttentionHeads: 8, NumKeyValueHeads: 4, HeadDim: 256, NumHiddenLayers: 26}
+	if got, want := gemma.kvCacheElements(1024, true), 1024.0*26*4*512; got != want {
+		t.Errorf("kvCacheElements(1024) = %v, want %v", got, want)
+	}
+
+	// Keys and values sized separately: 2 layers x 16 heads x (192 + 128) per token
+	separate := ModelConfig{HiddenSize: 2048, NumAttentionHeads: 16, NumKeyValueHeads: 16, KeyLength: 192, ValueLength: 128, NumHiddenLayers: 2}
+	if got, want := separate.kvCacheElements(100, true), 100.0*2*16*320; got != want {
+		t.Errorf("kvCacheElements(100) = %v, want %v", got, want)
+	}
+}
+
+func TestContextWarnings(t *testing.T) {
+	llama31 := ModelConfig{MaxPositionEmbeddings: 131072, RopeScaling: &RopeScaling{RopeType: "llama3", Factor: 8, OriginalMaxPositionEmbeddings: 8192}}
+	qwen := ModelConfig{MaxPositionEmbeddings: 32768, RopeScaling: &RopeScaling{Type: "yarn", Factor: 4, OriginalMaxPositionEmbeddings: 32768}}
+	plain := ModelConfig{MaxPositionEmbeddings: 8192}
+
+	tests := []struct {
+		name    string
+		config  ModelConfig
+		context int
+		want    string
+	}{
+		{"unknown maximum", ModelConfig{}, 1 << 20, ""},
+		{"within the trained context", plain, 4096, ""},
+		{"beyond the maximum without scaling", plain, 16384, "context 16384 exceeds the model's maximum context of 8192, even with RoPE scaling"},
+		{"beyond the scaled maximum", qwen, 200000, "context 200000 exceeds the model's maximum context of 131072, even with RoPE scaling"},
+		{"scaling not enabled", qwen, 65536, "context 65536 exceeds max position embeddings of 32768, the model's yarn RoPE scaling supports up to 131072 if enabled"},
+		{"relies on enabled scaling", plain.WithScaledContext("yarn", 4), 16384, "context 16384 is beyond the trained context of 8192 and relies on yarn RoPE scaling (x4.0)"},
+		// Llama 3.1 ships its llama3 scaling, so its full 128K needs no warning
+		{"trained with scaling", llama31, 65536, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings := contextWarnings(test.config, test.context)
+			got := ""
+			if len(warnings) > 0 {
+				got = warnings[0]
+			}
+			if len(warnings) > 1 || got != test.want {
+				t.Errorf("contextWarnings(%d) = %q, want %q", test.context, warnings, test.want)
+			}
+		})
+	}
+}
+
+func TestPerLayerParams(t *testing.T) {
+	// Heads of 64 / 4 = 16, so full attention is 64 x (6 x 16 + 6 x 16) and the FFN 3 x 64 x 128
+	layers := []LayerConfig{
+		{NumAttentionHeads: 4, NumKeyValueHeads: 2, IntermediateSize: 128, SlidingWindow: 32},
+		{LinearAttention: true, IntermediateSize: 128},
+		{NumAttentionHeads: 4, NumKeyValueHeads: 2, LinearFFN: true},
+	}
+	config := ModelConfig{HiddenSize: 64, NumAttentionHeads: 4, VocabSize: 10, TieWordEmbeddings: true, Layers: layers}
+	want := []float64{12288 + 24576 + 128, 4096 + 24576 + 128, 12288 + 4096 + 128}
+
+	got := config.layerParamsPerLayer()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("layerParamsPerLayer()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// A known parameter count scales the shape estimates to the real total, here twice theirs
+	config.NumParams = (2*(want[0]+want[1]+want[2]) + 640) / 1e9
+	got = config.layerParamsPerLayer()
+	for i := range want {
+		if math.Abs(got[i]-2*want[i]) > 1e-6 {
+			t.Errorf("scaled layerParamsPerLayer()[%d] = %v, want %v", i, got[i], 2*want[i])
+		}
+	}
+
+	// The sliding window layer caches 32 tokens and the linear attention layer none
+	kvCache := config.kvCacheElementsPerLayer(100, true)
+	wantKVCache := []float64{32 * 2 * 32, 0, 100 * 2 * 32}
+	for i := range wantKVCache {
+		if kvCache[i] != wantKVCache[i] {
+			t.Errorf("kvCacheElementsPerLayer(100)[%d] = %v, want %v", i, kvCache[i], wantKVCache[i])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// File: quantest/embedding.go
+
+package quantest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+// maxEmbedBatch bounds the batch size search for embedding models.
+const maxEmbedBatch = 1 << 16
+
+// embeddingModelTypes holds the HF model types and GGUF architectures of
+// encoder-only models, which are only ever run as embedding or reranker models.
+var embeddingModelTypes = map[string]bool{
+	"bert":         true,
+	"roberta":      true,
+	"xlm-roberta":  true,
+	"distilbert":   true,
+	"mpnet":        true,
+	"new":          true,
+	"modernbert":   true,
+	"nomic_bert":   true,
+	"nomic-bert":   true,
+	"jina_bert":    true,
+	"jina-bert-v2": true,
+}
+
+// ollamaPoolingTypes maps GGUF's pooling_type enum onto pooling types.
+var ollamaPoolingTypes = []PoolingType{PoolingNone, PoolingMean, PoolingCLS, PoolingLast, PoolingRank}
+
+// CalculateEmbeddingVRAM calculates the VRAM usage of an embedding or reranker model
+//
+// Embedding models keep no KV cache between requests. Each forward pass runs a
+// batch of whole sequences through the model at once, so memory grows with the
+// batch size times the sequence length, plus the attention scores over every
+// pair of tokens in a sequence and the pooled output. Sequences are truncated
+// to the model's max position embeddings.
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - bpwValues: A BPWValues struct containing the bits per weight values.
+//   - sequenceLength: The number of tokens in each sequence.
+//   - batch: The number of sequences per forward pass.
+//
+// Returns:
+//   - float64: A float64 representing the VRAM usage in GB.
+//
+// Example:
+//
+//	vram := CalculateEmbeddingVRAM(config, GetBPWValues(16, KVCacheFP16), 512, 32)
+func CalculateEmbeddingVRAM(config ModelConfig, bpwValues BPWValues, sequenceLength, batch int) float64 {
+	logging.DebugLogger.Println("Calculating embedding VRAM usage...")
+
+	if config.MaxPositionEmbeddings > 0 && sequenceLength > config.MaxPositionEmbeddings {
+		sequenceLength = config.MaxPositionEmbeddings
+	}
+	batch = max(batch, 1)
+	tokens := sequenceLength * batch
+
+	// The token embeddings stay in system RAM and there's no output head
+	weights := CalculateWeights(config, bpwValues).Layers
+
+	// Peak activations for a single layer, as nothing is kept between layers
+	activations := float64(tokens*(4*config.HiddenSize+config.IntermediateSize)) * activationBytes
+	scores := float64(batch*sequenceLength*sequenceLength*config.NumAttentionHeads) * activationBytes
+
+	// Pooled embeddings are returned as fp32, one per sequence or one per token without pooling
+	var output float64
+	switch config.pooling() {
+	case PoolingNone:
+		output = float64(tokens*config.HiddenSize) * 4
+	case PoolingRank:
+		output = float64(batch) * 4
+	default:
+		output = float64(batch*config.HiddenSize) * 4
+	}
+
+	return bitsToGB(float64(CUDASize)+activations+scores+output) + weights
+}
+
+// MaxEmbeddingBatch finds the most sequences an embedding model can run per forward pass
+//
+// Example:
+//
+//	batch := MaxEmbeddingBatch(config, GetBPWValues(8.5, KVCacheFP16), 512, 8)
+func MaxEmbeddingBatch(config ModelConfig, bpwValues BPWValues, sequenceLength int, memory float64) int {
+	if CalculateEmbeddingVRAM(config, bpwValues, sequenceLength, 1) > memory {
+		return 0
+	}
+
+	low, high := 1, maxEmbedBatch
+	for low < high {
+		mid := (low + high + 1) / 2
+		if CalculateEmbeddingVRAM(config, bpwValues, sequenceLength, mid) > memory {
+			high = mid - 1
+		} else {
+			low = mid
+		}
+	}
+	return low
+}
+
+// pooling returns the model's pooling, defaulting to the last token for
+// decoder based embedding models and the mean for encoder-only models.
+func (c ModelConfig) pooling() PoolingType {
+	if c.Pooling != "" {
+		return c.Pooling
+	}
+	if embeddingModelTypes[c.ModelType] {
+		return PoolingMean
+	}
+	return PoolingLast
+}
+
+// validate checks the workload is one quantest estimates, an empty one being detected
+func (w Workload) validate() error {
+	switch w {
+	case "", WorkloadGenerate, WorkloadEmbed, WorkloadRerank:
+		return nil
+	}
+	return fmt.Errorf("unknown workload %q, expected generate, embed or rerank", string(w))
+}
+
+// WithWorkload returns the config estimated for the given workload, leaving
+// the detected workload in place when it's empty.
+func (c ModelConfig) WithWorkload(workload Workload) ModelConfig {
+	switch workload {
+	case WorkloadGenerate:
+		c.IsEmbedding = false
+	case WorkloadEmbed:
+		c.IsEmbedding = true
+		if c.Pooling == PoolingRank {
+			c.Pooling = ""
+		}
+	case WorkloadRerank:
+		c.IsEmbedding = true
+		c.Pooling = PoolingRank
+	}
+	return c
+}
+
+// normaliseEmbedding detects embedding and reranker models from their config
+// and name, e.g. bge-reranker's XLMRobertaForSequenceClassification or
+// Qwen3-Embedding, which is otherwise a plain Qwen3 model.
+func normaliseEmbedding(extras hfConfigExtras, config *ModelConfig) {
+	// nomic-bert uses GPT-2 style names
+	if extras.NEmbd > 0 && config.HiddenSize == 0 {
+		config.HiddenSize = extras.NEmbd
+		config.NumHiddenLayers = extras.NLayer
+		config.NumAttentionHeads = extras.NHead
+		config.IntermediateSize = extras.NInner
+		config.MaxPositionEmbeddings = extras.NPositions
+	}
+
+	name := strings.ToLower(config.ModelName)
+	reranker := strings.Contains(name, "rerank")
+	for _, architecture := range extras.Architectures {
+		reranker = reranker || strings.HasSuffix(architecture, "ForSequenceClassification")
+	}
+
+	switch {
+	case reranker:
+		config.IsEmbedding = true
+		config.Pooling = PoolingRank
+	case embeddingModelTypes[config.ModelType] || strings.Contains(name, "embed"):
+		config.IsEmbedding = true
+	default:
+		return
+	}
+
+	// Embedding checkpoints have no separate output head
+	config.TieWordEmbeddings = true
+}
@@ -0,0 +1,95 @@
+// File: quantest/embedding_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+// bgeLarge is bge-large-en-v1.5, a 335M parameter BERT embedding model
+var bgeLarge = ModelConfig{
+	NumParams:             0.335,
+	MaxPositionEmbeddings: 512,
+	NumHiddenLayers:       24,
+	HiddenSize:            1024,
+	NumAttentionHeads:     16,
+	IntermediateSize:      4096,
+	VocabSize:             30522,
+	ModelType:             "bert",
+	IsEmbedding:           true,
+}
+
+func TestCalculateEmbeddingVRAM(t *testing.T) {
+	bpwValues := GetBPWValues(16, KVCacheFP16)
+	one := CalculateEmbeddingVRAM(bgeLarge, bpwValues, 512, 1)
+	two := CalculateEmbeddingVRAM(bgeLarge, bpwValues, 512, 2)
+
+	// Each sequence adds 512 x (4 x 1024 + 4096) fp16 activations, 16 heads of
+	// 512 x 512 fp16 attention scores and a mean pooled fp32 embedding
+	want := (512*(4*1024+4096)*2 + 16*512*512*2 + 1024*4.0) / (1 << 30)
+	if math.Abs(two-one-want) > 1e-12 {
+		t.Errorf("CalculateEmbeddingVRAM grows by %v GB per sequence, want %v GB", two-one, want)
+	}
+
+	// Sequences are truncated to the 512 max position embeddings
+	if got := CalculateEmbeddingVRAM(bgeLarge, bpwValues, 8192, 2); got != two {
+		t.Errorf("CalculateEmbeddingVRAM(8192 tokens) = %v, want %v as for 512", got, two)
+	}
+}
+
+func TestMaxEmbeddingBatch(t *testing.T) {
+	bpwValues := GetBPWValues(16, KVCacheFP16)
+	tests := []struct {
+		name           string
+		config         ModelConfig
+		sequenceLength int
+		memory         float64
+	}{
+		{"embed 512 tokens", bgeLarge, 512, 8},
+		{"embed 128 tokens", bgeLarge, 128, 4},
+		{"rerank", bgeLarge.WithWorkload(WorkloadRerank), 512, 8},
+		{"decoder embedding", llama8B.WithWorkload(WorkloadEmbed), 1024, 24},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batch := MaxEmbeddingBatch(test.config, bpwValues, test.sequenceLength, test.memory)
+			if batch < 1 {
+				t.Fatalf("MaxEmbeddingBatch = %d, want at least 1", batch)
+			}
+			if vram := CalculateEmbeddingVRAM(test.config, bpwValues, test.sequenceLength, batch); vram > test.memory {
+				t.Errorf("MaxEmbeddingBatch = %d, which needs %v GB of %v GB", batch, vram, test.memory)
+			}
+			if vram := CalculateEmbeddingVRAM(test.config, bpwValues, test.sequenceLength, batch+1); vram <= test.memory {
+				t.Errorf("MaxEmbeddingBatch = %d, but %d still fits in %v GB", batch, batch+1, vram)
+			}
+		})
+	}
+}
+
+func TestMaxEmbeddingBatchNoFit(t *testing.T) {
+	if batch := MaxEmbeddingBatch(llama8B.WithWorkload(WorkloadEmbed), GetBPWValues(16, KVCacheFP16), 512, 8); batch != 0 {
+		t.Errorf("MaxEmbeddingBatch = %d, want 0 when a single sequence doesn't fit", batch)
+	}
+}
+
+func TestEmbeddingPooling(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ModelConfig
+		want   PoolingType
+	}{
+		{"encoder", bgeLarge, PoolingMean},
+		{"decoder", llama8B, PoolingLast},
+		{"configured", ModelConfig{ModelType: "bert", Pooling: PoolingCLS}, PoolingCLS},
+		{"rerank", bgeLarge.WithWorkload(WorkloadRerank), PoolingRank},
+		{"embed after rerank", bgeLarge.WithWorkload(WorkloadRerank).WithWorkload(WorkloadEmbed), PoolingMean},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.pooling(); got != test.want {
+				t.Errorf("pooling() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// File: quantest/encdec.go
+
+package quantest
+
+import (
+	"github.com/sammcj/gollama/logging"
+)
+
+// activationBytes is the size of an fp16 activation, which encoder-decoder runtimes compute in.
+const activationBytes = 2
+
+// CalculateEncoderDecoderVRAM calculates the VRAM usage of an encoder-decoder model
+//
+// Unlike decoder-only models the whole model lives on the GPU, the encoder
+// runs once over the input and each decoder layer keeps a cross-attention KV
+// cache over the encoder output alongside its self-attention cache.
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - bpwValues: A BPWValues struct containing the bits per weight values.
+//   - inputLength: The number of tokens or audio frames fed to the encoder, 0 for the config's default.
+//   - outputLength: The number of tokens generated by the decoder.
+//
+// Returns:
+//   - float64: A float64 representing the VRAM usage in GB.
+//
+// Example:
+//
+//	vram := CalculateEncoderDecoderVRAM(config, GetBPWValues(16, KVCacheFP16), 1500, 448)
+func CalculateEncoderDecoderVRAM(config ModelConfig, bpwValues BPWValues, inputLength, outputLength int) float64 {
+	logging.DebugLogger.Println("Calculating encoder-decoder VRAM usage...")
+
+	encoder := config.encoder()
+	if inputLength == 0 {
+		inputLength = encoder.InputLength
+	}
+	if inputLength == 0 {
+		inputLength = encoder.MaxPositions
+	}
+
+	weights := CalculateWeights(config, bpwValues)
+	weightsSize := weights.Layers + weights.TokenEmbedding
+	if !config.TieWordEmbeddings {
+		weightsSize += weights.Output
+	}
+
+	keyDim, valueDim := config.KeyHeadDim(), config.ValueHeadDim()
+	kvBytes := bpwValues.KVCacheBPW / 8
+
+	selfAttentionKV := config.kvCacheElements(outputLength, true) * kvBytes
+	crossAttentionKV := float64(inputLength*config.NumHiddenLayers*config.NumAttentionHeads) * (keyDim + valueDim) * kvBytes
+
+	// The encoder output is kept for the cross-attention projections
+	encoderOutput := float64(inputLength*config.HiddenSize) * activationBytes
+
+	// Peak encoder activations for a single layer, including the attention scores
+	encoderActivations := float64(inputLength*(4*config.HiddenSize+encoder.IntermediateSize)) * activationBytes
+	encoderScores := float64(inputLength*inputLength*encoder.NumAttentionHeads) * activationBytes
+
+	// Decoding is a token at a time, attending over the generated tokens and the encoder output
+	decoderActivations := float64(4*config.HiddenSize+config.IntermediateSize) * activationBytes
+	decoderScores := float64((outputLength+inputLength)*config.NumAttentionHeads) * activationBytes
+	logits := float64(config.VocabSize) * 4
+
+	vramBytes := float64(CUDASize) + selfAttentionKV + crossAttentionKV + encoderOutput +
+		encoderActivations + encoderScores + decoderActivations + decoderScores + logits
+
+	return bitsToGB(vramBytes) + weightsSize
+}
+
+// encoder returns the encoder config, defaulting to a mirror of the decoder.
+func (c ModelConfig) encoder() EncoderConfig {
+	if c.Encoder != nil {
+		return *c.Encoder
+	}
+	return EncoderConfig{
+		NumLayers:         c.NumHiddenLayers,
+		NumAttentionHeads: c.NumAttentionHeads,
+		IntermediateSize:  c.IntermediateSize,
+		MaxPositions:      c.MaxPositionEmbeddings,
+	}
+}
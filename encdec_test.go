@@ -0,0 +1,84 @@
+// File: quantest/encdec_test.go
+
+package quantest
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestCalculateEncoderDecoderVRAM(t *testing.T) {
+	config := ModelConfig{
+		HiddenSize:        8,
+		NumAttentionHeads: 2,
+		NumKeyValueHeads:  2,
+		NumHiddenLayers:   2,
+		IntermediateSize:  16,
+		VocabSize:         10,
+		TieWordEmbeddings: true,
+		IsEncoderDecoder:  true,
+		Encoder:           &EncoderConfig{NumLayers: 2, NumAttentionHeads: 2, IntermediateSize: 16, MaxPositions: 100},
+	}
+	bpwValues := BPWValues{BPW: 16, LMHeadBPW: 16, EmbeddingBPW: 16, KVCacheBPW: 16}
+
+	// Bytes at fp16 for 100 input and 50 output tokens, with heads of 8 / 2 = 4
+	weights := 2.0 * (2*(8*(4*4+4*4)+3*8*16+2*8) + 10*8) // decoder layers and the tied embedding
+	selfAttentionKV := 2.0 * 50 * 2 * 2 * 8              // output tokens x layers x heads x (key + value)
+	crossAttentionKV := 2.0 * 100 * 2 * 2 * 8            // the encoder output, cached once per decoder layer
+	encoderOutput := 2.0 * 100 * 8
+	encoderActivations := 2.0 * 100 * (4*8 + 16)
+	encoderScores := 2.0 * 100 * 100 * 2
+	decoderActivations := 2.0 * (4*8 + 16)
+	decoderScores := 2.0 * (50 + 100) * 2
+	logits := 4.0 * 10
+	want := bitsToGB(float64(CUDASize) + weights + selfAttentionKV + crossAttentionKV + encoderOutput +
+		encoderActivations + encoderScores + decoderActivations + decoderScores + logits)
+
+	if got := CalculateEncoderDecoderVRAM(config, bpwValues, 0, 50); math.Abs(got-want) > 1e-12 {
+		t.Errorf("CalculateEncoderDecoderVRAM() = %v, want %v", got, want)
+	}
+
+	// Doubling the input grows the cross-attention KV cache with it
+	longer := CalculateEncoderDecoderVRAM(config, bpwValues, 200, 50)
+	shorter := CalculateEncoderDecoderVRAM(config, bpwValues, 100, 50)
+	if longer-shorter < bitsToGB(crossAttentionKV) {
+		t.Errorf("doubling the input added %v GB, want at least the %v GB cross-attention KV cache", longer-shorter, bitsToGB(crossAttentionKV))
+	}
+}
+
+func TestNormaliseEncoderDecoderConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		configFile  string
+		wantLayers  int
+		wantHeadDim int
+		wantMax     int
+		wantEncoder EncoderConfig
+	}{
+		{"t5-small", `{"is_encoder_decoder": true, "d_model": 512, "d_kv": 64, "d_ff": 2048, "num_layers": 6, "num_heads": 8}`,
+			6, 64, 512, EncoderConfig{NumLayers: 6, NumAttentionHeads: 8, IntermediateSize: 2048, MaxPositions: 512}},
+		{"whisper-small", `{"is_encoder_decoder": true, "d_model": 768, "encoder_layers": 12, "decoder_layers": 12,
+			"encoder_attention_heads": 12, "decoder_attention_heads": 12, "encoder_ffn_dim": 3072, "decoder_ffn_dim": 3072,
+			"max_source_positions": 1500, "max_target_positions": 448}`,
+			12, 0, 448, EncoderConfig{NumLayers: 12, NumAttentionHeads: 12, IntermediateSize: 3072, MaxPositions: 1500}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config ModelConfig
+			if err := json.Unmarshal([]byte(test.configFile), &config); err != nil {
+				t.Fatal(err)
+			}
+			if err := normaliseHFConfig([]byte(test.configFile), &config); err != nil {
+				t.Fatalf("normaliseHFConfig returned error: %v", err)
+			}
+			if config.NumHiddenLayers != test.wantLayers || config.HeadDim != test.wantHeadDim || config.MaxPositionEmbeddings != test.wantMax {
+				t.Errorf("decoder = %d layers, head dim %d, max %d, want %d, %d, %d",
+					config.NumHiddenLayers, config.HeadDim, config.MaxPositionEmbeddings, test.wantLayers, test.wantHeadDim, test.wantMax)
+			}
+			if config.Encoder == nil || *config.Encoder != test.wantEncoder {
+				t.Errorf("encoder = %+v, want %+v", config.Encoder, test.wantEncoder)
+			}
+		})
+	}
+}
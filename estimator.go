@@ -63,28 +63,24 @@ func EstimateVRAM(
 	if availableVRAM == 0 {
 		availableVRAM = DefaultVRAM
 	}
-	if quantLevel == "" {
-		quantLevel = DefaultQuantLevel
-	}
-
-	bpw, err := ParseBPWOrQuant(quantLevel)
+	modelConfig, _ := GetModelConfig(*modelName)
+	resolved, err := resolveQuant(modelConfig, quantLevel, "", 0, nil)
 	if err != nil {
 		return nil, err
 	}
+	quant, bpw := resolved.quant, resolved.bpw
 
-	modelConfig, _ := GetModelConfig(*modelName)
-
-	estimatedVRAM, err := CalculateVRAM(modelConfig, bpw, contextSize, kvCacheQuant)
+	estimatedVRAM, err := CalculateVRAMWithQuantType(modelConfig, bpw, contextSize, kvCacheQuant, quant, RuntimeParams{})
 	if err != nil {
 		return nil, err
 	}
 
-	maxContextSize, err := CalculateContext(modelConfig, availableVRAM, bpw, kvCacheQuant)
+	maxContextSize, err := CalculateContextWithQuantType(modelConfig, availableVRAM, bpw, kvCacheQuant, quant, RuntimeParams{})
 	if err != nil {
 		return nil, err
 	}
 
-	maximumQuant, recommendations, err := CalculateBPW(modelConfig, availableVRAM, contextSize, kvCacheQuant, "gguf")
+	maximumQuant, recommendations, err := CalculateBPWWithQuantType(modelConfig, availableVRAM, contextSize, kvCacheQuant, quant, RuntimeParams{})
 	if err != nil {
 		return nil, err
 	}
@@ -94,12 +90,16 @@ func EstimateVRAM(
 		ContextSize:     contextSize,
 		KVCacheQuant:    kvCacheQuant,
 		AvailableVRAM:   availableVRAM,
-		QuantLevel:      quantLevel,
+		QuantLevel:      resolved.level,
+		QuantFormat:     quant.Format,
+		QuantSource:     resolved.source,
 		EstimatedVRAM:   estimatedVRAM,
+		Weights:         CalculateWeights(modelConfig, quant.BPWValues(bpw, kvCacheQuant)),
 		FitsAvailable:   estimatedVRAM <= availableVRAM,
 		MaxContextSize:  maxContextSize,
 		MaximumQuant:    maximumQuant.(string),
 		Recommendations: recommendations.Recommendations,
+		Warnings:        append(resolved.warnings, contextWarnings(modelConfig, contextSize)...),
 		ollamaModelInfo: ollamaModelInfo,
 	}, nil
 }
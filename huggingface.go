@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/sammcj/gollama/logging"
@@ -101,11 +102,15 @@ func GetHFModelConfig(modelID string) (ModelConfig, error) {
 		return ModelConfig{}, err
 	}
 
-	var config ModelConfig
+	config := ModelConfig{ModelName: modelID}
 	if err := json.Unmarshal(configFile, &config); err != nil {
 		return ModelConfig{}, err
 	}
 
+	if err := normaliseHFConfig(configFile, &config); err != nil {
+		return ModelConfig{}, err
+	}
+
 	// Ensure the modelID is properly URL-encoded
 	encodedModelID := url.PathEscape(modelID)
 	configURL := fmt.Sprintf("https://huggingface.co/%s/raw/main/config.json", encodedModelID)
@@ -123,25 +128,32 @@ func GetHFModelConfig(modelID string) (ModelConfig, error) {
 		return ModelConfig{}, fmt.Errorf("failed to download config.json: %w", err)
 	}
 
-	indexFile, err := os.ReadFile(indexPath)
-	if err != nil {
-		return ModelConfig{}, err
-	}
-
-	var index struct {
-		Metadata struct {
-			TotalSize float64 `json:"total_size"`
-		} `json:"metadata"`
-	}
-	if err := json.Unmarshal(indexFile, &index); err != nil {
-		return ModelConfig{}, err
+	// Only an unquantised checkpoint's size gives its parameter count, quantised
+	// ones pack several weights per byte. Otherwise, or without an index, such as
+	// for a single file model, the parameters are counted from the model's shape.
+	config.NumParams = config.shapeParams() / 1e9
+	if bytesPerParam := checkpointBytesPerParam(modelID, configFile); bytesPerParam > 0 {
+		indexFile, err := os.ReadFile(indexPath)
+		if err != nil && !os.IsNotExist(err) {
+			return ModelConfig{}, err
+		}
+		if err == nil {
+			var index struct {
+				Metadata struct {
+					TotalSize float64 `json:"total_size"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(indexFile, &index); err != nil {
+				return ModelConfig{}, err
+			}
+			if index.Metadata.TotalSize > 0 {
+				config.NumParams = index.Metadata.TotalSize / bytesPerParam / 1e9
+			}
+		}
 	}
 
-	config.NumParams = index.Metadata.TotalSize / 2 / 1e9
-
 	// Set the fields that are not in the JSON
 	config.ModelName = modelID
-	config.NumParams = index.Metadata.TotalSize / 2 / 1e9
 	config.IsOllama = false
 
 	cacheMutex.Lock()
@@ -150,3 +162,251 @@ func GetHFModelConfig(modelID string) (ModelConfig, error) {
 
 	return config, nil
 }
+
+// checkpointBytesPerParam returns the bytes each parameter takes in a model's
+// safetensors, or 0 when the checkpoint is quantised, as the config's
+// quantization_config (or MLX's quantization) or the repository's name says.
+func checkpointBytesPerParam(modelID string, configFile []byte) float64 {
+	var checkpoint struct {
+		TorchDType         string         `json:"torch_dtype"`
+		DType              string         `json:"dtype"`
+		QuantizationConfig map[string]any `json:"quantization_config"`
+		Quantization       map[string]any `json:"quantization"`
+	}
+	if err := json.Unmarshal(configFile, &checkpoint); err != nil || checkpoint.QuantizationConfig != nil || checkpoint.Quantization != nil {
+		return 0
+	}
+	if inferred := InferQuant(ModelConfig{ModelName: modelID}); inferred.Source == QuantSourceRepository {
+		if quant, ok := defaultRegistry.Lookup(inferred.QuantLevel); !ok || quant.BPW < 16 {
+			return 0
+		}
+	}
+
+	dtype := checkpoint.TorchDType
+	if dtype == "" {
+		dtype = checkpoint.DType
+	}
+	switch strings.ToLower(dtype) {
+	case "", "float16", "bfloat16", "half":
+		return 2
+	case "float32", "float":
+		return 4
+	}
+	return 0
+}
+
+// hfConfigExtras holds config.json fields that don't map directly onto ModelConfig
+type hfConfigExtras struct {
+	Architectures        []string `json:"architectures"`
+	TieWordEmbeddings    *bool    `json:"tie_word_embeddings"`
+	LayerTypes           []string `json:"layer_types"`
+	SlidingWindowPattern int      `json:"sliding_window_pattern"`
+
+	// OpenELM
+	NumTransformerLayers   int       `json:"num_transformer_layers"`
+	ModelDim               int       `json:"model_dim"`
+	MaxContextLength       int       `json:"max_context_length"`
+	NumQueryHeads          []int     `json:"num_query_heads"`
+	NumKVHeads             []int     `json:"num_kv_heads"`
+	FFNMultipliers         []float64 `json:"ffn_multipliers"`
+	FFNDimDivisor          int       `json:"ffn_dim_divisor"`
+	ShareInputOutputLayers *bool     `json:"share_input_output_layers"`
+
+	// nomic-bert
+	NEmbd  int `json:"n_embd"`
+	NLayer int `json:"n_layer"`
+	NHead  int `json:"n_head"`
+	NInner int `json:"n_inner"`
+
+	// Encoder-decoder models, T5 style
+	DModel           int `json:"d_model"`
+	DKV              int `json:"d_kv"`
+	DFF              int `json:"d_ff"`
+	NumLayers        int `json:"num_layers"`
+	NumDecoderLayers int `json:"num_decoder_layers"`
+	NumHeads         int `json:"num_heads"`
+	NPositions       int `json:"n_positions"`
+
+	// Encoder-decoder models, Whisper and BART style
+	EncoderLayers         int `json:"encoder_layers"`
+	DecoderLayers         int `json:"decoder_layers"`
+	EncoderAttentionHeads int `json:"encoder_attention_heads"`
+	DecoderAttentionHeads int `json:"decoder_attention_heads"`
+	EncoderFFNDim         int `json:"encoder_ffn_dim"`
+	DecoderFFNDim         int `json:"decoder_ffn_dim"`
+	MaxSourcePositions    int `json:"max_source_positions"`
+	MaxTargetPositions    int `json:"max_target_positions"`
+
+	// DeciLM and Nemotron-NAS
+	BlockConfigs []struct {
+		Attention struct {
+			NHeadsInGroup     int  `json:"n_heads_in_group"`
+			NoOp              bool `json:"no_op"`
+			ReplaceWithLinear bool `json:"replace_with_linear"`
+		} `json:"attention"`
+		FFN struct {
+			FFNMult           float64 `json:"ffn_mult"`
+			NoOp              bool    `json:"no_op"`
+			ReplaceWithLinear bool    `json:"replace_with_linear"`
+		} `json:"ffn"`
+	} `json:"block_configs"`
+}
+
+// normaliseHFConfig fills in the ModelConfig fields that need more than a direct
+// JSON mapping: defaults Transformers applies and per-layer architectures.
+func normaliseHFConfig(configFile []byte, config *ModelConfig) error {
+	var extras hfConfigExtras
+	if err := json.Unmarshal(configFile, &extras); err != nil {
+		return err
+	}
+
+	// Transformers ties the embeddings unless the config says otherwise
+	config.TieWordEmbeddings = extras.TieWordEmbeddings == nil || *extras.TieWordEmbeddings
+
+	if !config.IsEncoderDecoder {
+		normaliseEmbedding(extras, config)
+	}
+
+	switch {
+	case config.IsEncoderDecoder:
+		normaliseEncoderDecoder(extras, config)
+
+	case len(extras.NumQueryHeads) > 0:
+		config.NumHiddenLayers = extras.NumTransformerLayers
+		config.HiddenSize = extras.ModelDim
+		config.MaxPositionEmbeddings = extras.MaxContextLength
+		config.TieWordEmbeddings = extras.ShareInputOutputLayers == nil || *extras.ShareInputOutputLayers
+
+		divisor := extras.FFNDimDivisor
+		if divisor == 0 {
+			divisor = 256
+		}
+		config.Layers = make([]LayerConfig, extras.NumTransformerLayers)
+		for i := range config.Layers {
+			layer := &config.Layers[i]
+			if i < len(extras.NumQueryHeads) {
+				layer.NumAttentionHeads = extras.NumQueryHeads[i]
+			}
+			if i < len(extras.NumKVHeads) {
+				layer.NumKeyValueHeads = extras.NumKVHeads[i]
+			}
+			if i < len(extras.FFNMultipliers) {
+				layer.IntermediateSize = makeDivisible(extras.FFNMultipliers[i]*float64(extras.ModelDim), divisor)
+			}
+		}
+
+	case len(extras.BlockConfigs) > 0:
+		config.NumHiddenLayers = len(extras.BlockConfigs)
+		config.Layers = make([]LayerConfig, len(extras.BlockConfigs))
+		for i, block := range extras.BlockConfigs {
+			layer := &config.Layers[i]
+			switch {
+			case block.Attention.ReplaceWithLinear:
+				layer.LinearAttention = true
+			case !block.Attention.NoOp && block.Attention.NHeadsInGroup > 0:
+				layer.NumAttentionHeads = config.NumAttentionHeads
+				layer.NumKeyValueHeads = config.NumAttentionHeads / block.Attention.NHeadsInGroup
+			}
+			switch {
+			case block.FFN.ReplaceWithLinear:
+				layer.LinearFFN = true
+			case !block.FFN.NoOp:
+				// Mirrors _ffn_mult_to_intermediate_size in the DeciLM modelling code
+				intermediate := int(2 * block.FFN.FFNMult * float64(config.HiddenSize) / 3)
+				layer.IntermediateSize = (intermediate + 255) / 256 * 256
+			}
+		}
+	}
+
+	if len(config.Layers) > 0 {
+		config.NumAttentionHeads, config.NumKeyValueHeads, config.IntermediateSize = 0, 0, 0
+		for _, layer := range config.Layers {
+			config.NumAttentionHeads = max(config.NumAttentionHeads, layer.NumAttentionHeads)
+			config.NumKeyValueHeads = max(config.NumKeyValueHeads, layer.NumKeyValueHeads)
+			config.IntermediateSize = max(config.IntermediateSize, layer.IntermediateSize)
+		}
+	}
+
+	// Sliding window layers, either listed explicitly or as a repeating pattern of local layers
+	pattern := extras.SlidingWindowPattern
+	if pattern == 0 && config.ModelType == "gemma2" {
+		pattern = 2
+	}
+	if config.SlidingWindow > 0 && (len(extras.LayerTypes) > 0 || pattern > 0) {
+		layers := config.LayerConfigs()
+		config.Layers = make([]LayerConfig, len(layers))
+		copy(config.Layers, layers)
+		for i := range config.Layers {
+			sliding := pattern > 0 && (i+1)%pattern != 0
+			if i < len(extras.LayerTypes) {
+				sliding = extras.LayerTypes[i] == "sliding_attention"
+			}
+			if sliding {
+				config.Layers[i].SlidingWindow = config.SlidingWindow
+			}
+		}
+	}
+
+	return nil
+}
+
+// normaliseEncoderDecoder maps T5, Whisper and BART style configs onto a
+// ModelConfig describing the decoder, with the encoder held separately.
+func normaliseEncoderDecoder(extras hfConfigExtras, config *ModelConfig) {
+	config.HiddenSize = extras.DModel
+
+	if extras.NumLayers > 0 {
+		// T5 shares its head count and FFN width between the stacks
+		decoderLayers := extras.NumDecoderLayers
+		if decoderLayers == 0 {
+			decoderLayers = extras.NumLayers
+		}
+		inputLength := extras.NPositions
+		if inputLength == 0 {
+			inputLength = 512
+		}
+
+		config.NumHiddenLayers = decoderLayers
+		config.NumAttentionHeads = extras.NumHeads
+		config.NumKeyValueHeads = extras.NumHeads
+		config.IntermediateSize = extras.DFF
+		config.HeadDim = extras.DKV
+		config.MaxPositionEmbeddings = inputLength
+		config.Encoder = &EncoderConfig{
+			NumLayers:         extras.NumLayers,
+			NumAttentionHeads: extras.NumHeads,
+			IntermediateSize:  extras.DFF,
+			MaxPositions:      inputLength,
+		}
+		return
+	}
+
+	inputLength := extras.MaxSourcePositions
+	if inputLength == 0 {
+		inputLength = config.MaxPositionEmbeddings
+	}
+	if extras.MaxTargetPositions > 0 {
+		config.MaxPositionEmbeddings = extras.MaxTargetPositions
+	}
+
+	config.NumHiddenLayers = extras.DecoderLayers
+	config.NumAttentionHeads = extras.DecoderAttentionHeads
+	config.NumKeyValueHeads = extras.DecoderAttentionHeads
+	config.IntermediateSize = extras.DecoderFFNDim
+	config.Encoder = &EncoderConfig{
+		NumLayers:         extras.EncoderLayers,
+		NumAttentionHeads: extras.EncoderAttentionHeads,
+		IntermediateSize:  extras.EncoderFFNDim,
+		MaxPositions:      inputLength,
+	}
+}
+
+// makeDivisible rounds a layer width to the nearest multiple of divisor without
+// going more than 10% below it, as OpenELM sizes its FFNs.
+func makeDivisible(value float64, divisor int) int {
+	rounded := max(divisor, int(value+float64(divisor)/2)/divisor*divisor)
+	if float64(rounded) < 0.9*value {
+		rounded += divisor
+	}
+	return rounded
+}
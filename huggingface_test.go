@@ -0,0 +1,106 @@
+// File: quantest/huggingface_test.go
+
+package quantest
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// llama8BConfig is Llama 3.1 8B's config.json, less the fields quantest ignores
+const llama8BConfig = `{"hidden_size": 4096, "intermediate_size": 14336, "num_attention_heads": 32, "num_hidden_layers": 32,
+	"num_key_value_heads": 8, "vocab_size": 128256, "max_position_embeddings": 131072, "tie_word_embeddings": false%s}`
+
+// writeHFCache writes a model's config.json and, when given, its safetensors index to the Hugging Face cache
+func writeHFCache(t *testing.T, modelID, config, index string) {
+	t.Helper()
+	dir := filepath.Join(os.Getenv("HOME"), ".cache", "huggingface", "hub", modelID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if index != "" {
+		if err := os.WriteFile(filepath.Join(dir, "model.safetensors.index.json"), []byte(index), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetHFModelConfigParams(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// 8.03B parameters: 2 x 525M for the untied embedding and output head, and
+	// 32 layers of 41.9M attention, 176.2M FFN and 8K norm weights
+	tests := []struct {
+		modelID string
+		config  string
+		index   string
+		want    float64
+	}{
+		{"test/bf16", strings.Replace(llama8BConfig, "%s", `, "torch_dtype": "bfloat16"`, 1), `{"metadata": {"total_size": 16060522496}}`, 8.03},
+		{"test/fp32", strings.Replace(llama8BConfig, "%s", `, "torch_dtype": "float32"`, 1), `{"metadata": {"total_size": 32121044992}}`, 8.03},
+		{"test/awq", strings.Replace(llama8BConfig, "%s", `, "torch_dtype": "float16", "quantization_config": {"quant_method": "awq", "bits": 4}`, 1), `{"metadata": {"total_size": 5730000000}}`, 8.03},
+		{"test/Llama-3.1-8B-Instruct-FP8", strings.Replace(llama8BConfig, "%s", `, "torch_dtype": "bfloat16"`, 1), `{"metadata": {"total_size": 9080000000}}`, 8.03},
+		{"test/mlx", strings.Replace(llama8BConfig, "%s", `, "quantization": {"group_size": 64, "bits": 4}`, 1), `{"metadata": {"total_size": 4520000000}}`, 8.03},
+		{"test/single-file", strings.Replace(llama8BConfig, "%s", "", 1), "", 8.03},
+	}
+	for _, test := range tests {
+		t.Run(test.modelID, func(t *testing.T) {
+			writeHFCache(t, test.modelID, test.config, test.index)
+			config, err := GetHFModelConfig(test.modelID)
+			if err != nil {
+				t.Fatalf("GetHFModelConfig(%q) returned error: %v", test.modelID, err)
+			}
+			if got := math.Round(config.NumParams*100) / 100; got != test.want {
+				t.Errorf("GetHFModelConfig(%q).NumParams = %v, want %v", test.modelID, config.NumParams, test.want)
+			}
+		})
+	}
+}
+
+func TestGetModelConfigGGUFWithoutConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := GetModelConfig("test/Llama-3.1-8B-Instruct-GGUF/Llama-3.1-8B-Instruct-Q4_K_M.gguf")
+	if err == nil || !strings.Contains(err.Error(), "GGUF repositories") {
+		t.Errorf("GetModelConfig returned %v, want an error explaining GGUF repositories lack a config.json", err)
+	}
+}
+
+func TestNormaliseDeciLMConfig(t *testing.T) {
+	configFile := []byte(`{"hidden_size": 64, "num_attention_heads": 8, "block_configs": [
+		{"attention": {"n_heads_in_group": 4}, "ffn": {"ffn_mult": 1.5}},
+		{"attention": {"no_op": true}, "ffn": {"replace_with_linear": true}}
+	]}`)
+	var config ModelConfig
+	if err := json.Unmarshal(configFile, &config); err != nil {
+		t.Fatal(err)
+	}
+	if err := normaliseHFConfig(configFile, &config); err != nil {
+		t.Fatalf("normaliseHFConfig returned error: %v", err)
+	}
+
+	// ffn_mult 1.5 gives 2 x 1.5 x 64 / 3 = 64, rounded up to a multiple of 256
+	want := []LayerConfig{
+		{NumAttentionHeads: 8, NumKeyValueHeads: 2, IntermediateSize: 256},
+		{LinearFFN: true},
+	}
+	if len(config.Layers) != len(want) {
+		t.Fatalf("normaliseHFConfig gave %d layers, want %d", len(config.Layers), len(want))
+	}
+	for i := range want {
+		if config.Layers[i] != want[i] {
+			t.Errorf("layer %d = %+v, want %+v", i, config.Layers[i], want[i])
+		}
+	}
+	if config.NumHiddenLayers != 2 || config.NumAttentionHeads != 8 || config.NumKeyValueHeads != 2 || config.IntermediateSize != 256 {
+		t.Errorf("normaliseHFConfig summary = %d layers, %d heads, %d KV heads, %d FFN, want 2, 8, 2, 256",
+			config.NumHiddenLayers, config.NumAttentionHeads, config.NumKeyValueHeads, config.IntermediateSize)
+	}
+}
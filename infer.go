@@ -0,0 +1,125 @@
+// File: quantest/infer.go
+
+package quantest
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ExLlama repository names such as Llama-3.1-8B-Instruct-exl2-4.0bpw or -4.65bpw-h6-exl3
+var (
+	bpwNamePattern = regexp.MustCompile(`(?i)(?:^|[-_])(\d+(?:\.\d+)?)bpw(?:$|[-_])`)
+	exlNamePattern = regexp.MustCompile(`(?i)(?:^|[-_])exl([23])(?:$|[-_])`)
+)
+
+// AWQ, GPTQ and bitsandbytes repository names such as -AWQ, -GPTQ-Int4 or -bnb-4bit
+var (
+	groupNamePattern = regexp.MustCompile(`(?i)(?:^|[-_])(awq|gptq)(?:[-_](int[2348]|[2348]bits?))?(?:$|[-_])`)
+	bnbNamePattern   = regexp.MustCompile(`(?i)(?:^|[-_])bnb[-_]?([48])bits?(?:$|[-_])`)
+)
+
+// MLX repository names such as mlx-community/Llama-3.2-3B-Instruct-4bit
+var (
+	mlxNamePattern = regexp.MustCompile(`(?i)(?:^|[-_])mlx(?:$|[-_])`)
+	mlxBitsPattern = regexp.MustCompile(`(?i)(?:^|[-_])(\d)[-_]?bits?(?:$|[-_])`)
+)
+
+// InferQuant works out the quant level of a model when none is given
+//
+// Ollama models report their quant level. Otherwise it's parsed from the
+// model's name: the quant in an Ollama tag such as llama3.1:8b-instruct-q6_K
+// or a GGUF filename such as Llama-3.1-8B-Instruct-Q5_K_M.gguf, or the quant
+// a Hugging Face repository names, e.g. -AWQ, -GPTQ-Int4, -exl2-4.0bpw, -FP8 or
+// an mlx-community -4bit. Anything else falls back to DefaultQuantLevel.
+//
+// Parameters:
+//   - config: The model's configuration, whose ModelName and QuantLevel are used.
+//
+// Returns:
+//   - InferredQuant: The quant level, its format when the name gives one, and where it came from.
+//
+// Example:
+//
+//	quant := InferQuant(ModelConfig{ModelName: "Qwen/Qwen2.5-7B-Instruct-GPTQ-Int4"}) // gptq-int4 from the repository name
+func InferQuant(config ModelConfig) InferredQuant {
+	if config.QuantLevel != "" {
+		return InferredQuant{QuantLevel: config.QuantLevel, Source: QuantSourceMetadata}
+	}
+
+	name := filepath.ToSlash(config.ModelName)
+	if index := strings.LastIndex(name, ":"); index >= 0 {
+		if quant, err := ResolveQuant(name[index+1:]); err == nil {
+			return InferredQuant{QuantLevel: quant.Name, Format: QuantFormatGGUF, Source: QuantSourceTag}
+		}
+		return InferredQuant{QuantLevel: DefaultQuantLevel, Source: QuantSourceDefault}
+	}
+
+	base := path.Base(name)
+	if extension := path.Ext(base); strings.EqualFold(extension, ".gguf") {
+		if quant, err := ResolveQuant(strings.TrimSuffix(base, extension)); err == nil {
+			return InferredQuant{QuantLevel: quant.Name, Format: QuantFormatGGUF, Source: QuantSourceFilename}
+		}
+		return InferredQuant{QuantLevel: DefaultQuantLevel, Source: QuantSourceDefault}
+	}
+
+	if quant, ok := repositoryQuant(path.Dir(name), base); ok {
+		return quant
+	}
+	return InferredQuant{QuantLevel: DefaultQuantLevel, Source: QuantSourceDefault}
+}
+
+// repositoryQuant parses the quant a Hugging Face repository's owner and name give
+func repositoryQuant(owner, name string) (InferredQuant, bool) {
+	inferred := func(quantLevel string, format QuantFormat) (InferredQuant, bool) {
+		return InferredQuant{QuantLevel: quantLevel, Format: format, Source: QuantSourceRepository}, true
+	}
+
+	// ExLlama quants are named by their BPW, EXL2 unless they say otherwise
+	if match := bpwNamePattern.FindStringSubmatch(name); match != nil {
+		format := QuantFormatEXL2
+		if exl := exlNamePattern.FindStringSubmatch(name); exl != nil {
+			format = QuantFormat("exl" + exl[1])
+		}
+		return inferred(match[1]+"bpw", format)
+	}
+
+	// AWQ and GPTQ repositories without bits are almost always 4-bit
+	if match := groupNamePattern.FindStringSubmatch(name); match != nil {
+		format := QuantFormat(strings.ToLower(match[1]))
+		bits := strings.ToLower(match[2])
+		if bits == "" {
+			bits = "4bit"
+		}
+		return inferred(string(format)+"-"+bits, format)
+	}
+
+	if match := bnbNamePattern.FindStringSubmatch(name); match != nil {
+		if match[1] == "8" {
+			return inferred("bnb-int8", QuantFormatBNB)
+		}
+		return inferred("bnb-nf4", QuantFormatBNB)
+	}
+
+	if strings.EqualFold(owner, "mlx-community") || mlxNamePattern.MatchString(name) {
+		if match := mlxBitsPattern.FindStringSubmatch(name); match != nil {
+			if quant, err := ParseMLXQuant("mlx-" + match[1] + "bit"); err == nil {
+				return inferred(quant.Name(), QuantFormatMLX)
+			}
+		}
+	}
+
+	// Anything else suffixed with its quant's name or float type, e.g. -Q8_0, -FP8 or -BF16.
+	// Generic aliases such as 4bit aren't enough to go on in a repository name.
+	parts := quantNameParts(name)
+	if len(parts) == 0 {
+		return InferredQuant{}, false
+	}
+	suffix := parts[len(parts)-1]
+	if quant, ok := defaultRegistry.Lookup(suffix); ok && (quant.Family == QuantFamilyFloat || compactQuantName(suffix) == compactQuantName(quant.Name)) {
+		return inferred(quant.Name, "")
+	}
+	return InferredQuant{}, false
+}
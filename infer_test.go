@@ -0,0 +1,34 @@
+// File: quantest/infer_test.go
+
+package quantest
+
+import "testing"
+
+func TestInferQuant(t *testing.T) {
+	tests := []struct {
+		config ModelConfig
+		want   InferredQuant
+	}{
+		{ModelConfig{ModelName: "llama3.1:8b", QuantLevel: "Q6_K"}, InferredQuant{QuantLevel: "Q6_K", Source: QuantSourceMetadata}},
+		{ModelConfig{ModelName: "llama3.1:8b-instruct-q5_K_S"}, InferredQuant{QuantLevel: "Q5_K_S", Format: QuantFormatGGUF, Source: QuantSourceTag}},
+		{ModelConfig{ModelName: "gemma3:4b-it-q8_0"}, InferredQuant{QuantLevel: "Q8_0", Format: QuantFormatGGUF, Source: QuantSourceTag}},
+		{ModelConfig{ModelName: "gemma3:4b-it"}, InferredQuant{QuantLevel: DefaultQuantLevel, Source: QuantSourceDefault}},
+		{ModelConfig{ModelName: "bartowski/Llama-3.1-8B-Instruct-GGUF/Llama-3.1-8B-Instruct-Q5_K_M.gguf"}, InferredQuant{QuantLevel: "Q5_K_M", Format: QuantFormatGGUF, Source: QuantSourceFilename}},
+		{ModelConfig{ModelName: "google_gemma-3-4b-it-Q8_0.gguf"}, InferredQuant{QuantLevel: "Q8_0", Format: QuantFormatGGUF, Source: QuantSourceFilename}},
+		{ModelConfig{ModelName: "Qwen/Qwen2.5-7B-Instruct-AWQ"}, InferredQuant{QuantLevel: "awq-4bit", Format: QuantFormatAWQ, Source: QuantSourceRepository}},
+		{ModelConfig{ModelName: "Qwen/Qwen2.5-7B-Instruct-GPTQ-Int8"}, InferredQuant{QuantLevel: "gptq-int8", Format: QuantFormatGPTQ, Source: QuantSourceRepository}},
+		{ModelConfig{ModelName: "turboderp/Llama-3.1-8B-Instruct-exl3-4.0bpw"}, InferredQuant{QuantLevel: "4.0bpw", Format: QuantFormatEXL3, Source: QuantSourceRepository}},
+		{ModelConfig{ModelName: "unsloth/llama-3-8b-bnb-4bit"}, InferredQuant{QuantLevel: "bnb-nf4", Format: QuantFormatBNB, Source: QuantSourceRepository}},
+		{ModelConfig{ModelName: "mlx-community/Llama-3.2-3B-Instruct-4bit"}, InferredQuant{QuantLevel: "mlx-4bit-g64", Format: QuantFormatMLX, Source: QuantSourceRepository}},
+		{ModelConfig{ModelName: "Qwen/Qwen2.5-7B-Instruct-FP8"}, InferredQuant{QuantLevel: "FP8_E4M3", Source: QuantSourceRepository}},
+		{ModelConfig{ModelName: "google/gemma-2-2b-it"}, InferredQuant{QuantLevel: DefaultQuantLevel, Source: QuantSourceDefault}},
+		{ModelConfig{ModelName: "someone/Llama-3.2-3B-Instruct-4bit"}, InferredQuant{QuantLevel: DefaultQuantLevel, Source: QuantSourceDefault}},
+	}
+	for _, test := range tests {
+		t.Run(test.config.ModelName, func(t *testing.T) {
+			if got := InferQuant(test.config); got != test.want {
+				t.Errorf("InferQuant(%q) = %+v, want %+v", test.config.ModelName, got, test.want)
+			}
+		})
+	}
+}
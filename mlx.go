@@ -0,0 +1,162 @@
+// File: quantest/mlx.go
+
+package quantest
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultMLXGroupSize is mlx_lm.convert's default --q-group-size.
+	DefaultMLXGroupSize = 64
+
+	// mlxGroupBits is the fp16 scale and bias MLX stores per group.
+	mlxGroupBits = 32
+
+	// mlxMixedFraction is roughly the share of a Llama style model's layer
+	// weights a mixed recipe keeps at the higher bits, used without a config.
+	mlxMixedFraction = 0.14
+
+	// Without iogpu.wired_limit_mb, Metal lets the GPU wire about two thirds of
+	// unified memory up to 36 GB and three quarters above it.
+	appleSmallMemory        = 36.0
+	appleSmallWiredFraction = 2.0 / 3.0
+	appleLargeWiredFraction = 3.0 / 4.0
+)
+
+// MLX names such as mlx-4bit, mlx-6bit-g32 or mlx-mixed-3-6
+var mlxQuantPattern = regexp.MustCompile(`^mlx[-_]?(?:(\d)[-_]?bits?|mixed[-_](\d)[-_](\d))(?:[-_]g(\d+))?$`)
+
+// mlxBits are the bit widths recommendations are chosen from, MLX also supports 5-bit
+var mlxBits = []int{2, 3, 4, 6, 8}
+
+// ParseMLXQuant parses an MLX quant name, e.g. mlx-4bit, mlx-8bit-g32 or mlx-mixed-3-6
+//
+// The group size defaults to 64. Mixed recipes follow mlx_lm's mixed quant
+// predicate, mixed-3-6 keeps v_proj and down_proj in the first and last
+// eighth of the layers and every third layer between, and the output head, at
+// 6 bits and quantises everything else to 3 bits.
+//
+// Example:
+//
+//	quant, err := ParseMLXQuant("mlx-mixed-4-6-g64")
+func ParseMLXQuant(name string) (MLXQuant, error) {
+	match := mlxQuantPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(name)))
+	if match == nil {
+		return MLXQuant{}, fmt.Errorf("%q is not an MLX quant", name)
+	}
+
+	quant := MLXQuant{GroupSize: DefaultMLXGroupSize}
+	if match[1] != "" {
+		quant.Bits, _ = strconv.Atoi(match[1])
+	} else {
+		quant.Bits, _ = strconv.Atoi(match[2])
+		quant.HighBits, _ = strconv.Atoi(match[3])
+	}
+	if match[4] != "" {
+		quant.GroupSize, _ = strconv.Atoi(match[4])
+	}
+
+	for _, bits := range []int{quant.Bits, quant.HighBits} {
+		switch bits {
+		case 0, 2, 3, 4, 5, 6, 8:
+		default:
+			return MLXQuant{}, fmt.Errorf("invalid MLX quant %q, bits must be 2, 3, 4, 5, 6 or 8", name)
+		}
+	}
+	if quant.HighBits != 0 && quant.HighBits <= quant.Bits {
+		return MLXQuant{}, fmt.Errorf("invalid MLX quant %q, the mixed recipe's second bits must be the higher", name)
+	}
+	switch quant.GroupSize {
+	case 32, 64, 128:
+	default:
+		return MLXQuant{}, fmt.Errorf("invalid MLX quant %q, group size must be 32, 64 or 128", name)
+	}
+	return quant, nil
+}
+
+// Name returns the quant's name, e.g. mlx-4bit-g64
+func (q MLXQuant) Name() string {
+	if q.HighBits > 0 {
+		return fmt.Sprintf("mlx-mixed-%d-%d-g%d", q.Bits, q.HighBits, q.GroupSize)
+	}
+	return fmt.Sprintf("mlx-%dbit-g%d", q.Bits, q.GroupSize)
+}
+
+// BPW returns the effective BPW of the model's layers, including each group's scale and bias
+//
+// Mixed recipes are averaged over the config's layers, or a typical share of
+// high bit weights when the config has none.
+func (q MLXQuant) BPW(config ModelConfig) float64 {
+	overhead := float64(mlxGroupBits) / float64(q.GroupSize)
+	if q.HighBits == 0 {
+		return float64(q.Bits) + overhead
+	}
+
+	fraction := config.mlxMixedFraction()
+	return float64(q.Bits)*(1-fraction) + float64(q.HighBits)*fraction + overhead
+}
+
+// HeadBPW returns the output head's BPW, which mixed recipes keep at the higher bits
+func (q MLXQuant) HeadBPW() float64 {
+	bits := q.Bits
+	if q.HighBits > 0 {
+		bits = q.HighBits
+	}
+	return float64(bits) + float64(mlxGroupBits)/float64(q.GroupSize)
+}
+
+// mlxMixedFraction returns the share of the layers' linear weights mlx_lm's
+// mixed quant predicate keeps at the higher bits
+func (c ModelConfig) mlxMixedFraction() float64 {
+	layers := c.LayerConfigs()
+	numLayers := len(layers)
+
+	var high, total float64
+	for index, layer := range layers {
+		moreBits := index < numLayers/8 || index >= 7*numLayers/8 || (index-numLayers/8)%3 == 2
+		for _, module := range c.linearModules(layer) {
+			params := module.in * module.out
+			total += params
+			if moreBits && (module.name == "v_proj" || module.name == "down_proj") {
+				high += params
+			}
+		}
+	}
+
+	if total == 0 {
+		return mlxMixedFraction
+	}
+	return high / total
+}
+
+// AppleGPUMemory returns the unified memory an Apple Silicon GPU can use, in GB
+//
+// macOS caps the memory the GPU can wire, which Metal reports as the
+// recommended max working set: about two thirds of unified memory on Macs
+// with up to 36 GB and three quarters on larger ones. Setting the
+// iogpu.wired_limit_mb sysctl overrides the cap.
+//
+// Parameters:
+//   - unifiedMemory: The Mac's total unified memory in GB.
+//   - wiredLimitMB: The iogpu.wired_limit_mb sysctl, or 0 for the default.
+//
+// Returns:
+//   - float64: The memory available to the GPU in GB.
+//
+// Example:
+//
+//	vram := AppleGPUMemory(64, 0)    // 48 GB
+//	vram = AppleGPUMemory(64, 57344) // 56 GB
+func AppleGPUMemory(unifiedMemory float64, wiredLimitMB int) float64 {
+	if wiredLimitMB > 0 {
+		return min(float64(wiredLimitMB)/1024, unifiedMemory)
+	}
+	if unifiedMemory <= appleSmallMemory {
+		return unifiedMemory * appleSmallWiredFraction
+	}
+	return unifiedMemory * appleLargeWiredFraction
+}
@@ -0,0 +1,104 @@
+// File: quantest/mlx_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseMLXQuant(t *testing.T) {
+	tests := []struct {
+		name string
+		want MLXQuant
+	}{
+		{"mlx-4bit", MLXQuant{Bits: 4, GroupSize: 64}},
+		{"MLX_8bits", MLXQuant{Bits: 8, GroupSize: 64}},
+		{"mlx-6bit-g32", MLXQuant{Bits: 6, GroupSize: 32}},
+		{"mlx-mixed-3-6", MLXQuant{Bits: 3, HighBits: 6, GroupSize: 64}},
+		{"mlx-mixed-4-8-g128", MLXQuant{Bits: 4, HighBits: 8, GroupSize: 128}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseMLXQuant(test.name)
+			if err != nil {
+				t.Fatalf("ParseMLXQuant(%q) returned error: %v", test.name, err)
+			}
+			if got != test.want {
+				t.Errorf("ParseMLXQuant(%q) = %+v, want %+v", test.name, got, test.want)
+			}
+		})
+	}
+
+	for _, name := range []string{"mlx-7bit", "mlx-mixed-6-3", "mlx-4bit-g16", "awq-4bit"} {
+		if _, err := ParseMLXQuant(name); err == nil {
+			t.Errorf("ParseMLXQuant(%q) returned no error", name)
+		}
+	}
+}
+
+func TestMLXQuantBPW(t *testing.T) {
+	// 16 of llama8B's 32 layers keep v_proj and down_proj at the higher bits: the
+	// first and last 4 and every third between. Those are 15/52 of a layer's weights.
+	mixed := 15.0 / 104
+
+	tests := []struct {
+		name     string
+		quant    MLXQuant
+		config   ModelConfig
+		wantBPW  float64
+		wantHead float64
+	}{
+		// A 32-bit scale and bias per group
+		{"4-bit", MLXQuant{Bits: 4, GroupSize: 64}, llama8B, 4.5, 4.5},
+		{"8-bit g32", MLXQuant{Bits: 8, GroupSize: 32}, llama8B, 9, 9},
+		{"mixed", MLXQuant{Bits: 3, HighBits: 6, GroupSize: 64}, llama8B, 3*(1-mixed) + 6*mixed + 0.5, 6.5},
+		{"mixed without config", MLXQuant{Bits: 3, HighBits: 6, GroupSize: 64}, ModelConfig{}, 3*0.86 + 6*0.14 + 0.5, 6.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.quant.BPW(test.config); math.Abs(got-test.wantBPW) > 1e-12 {
+				t.Errorf("BPW() = %v, want %v", got, test.wantBPW)
+			}
+			if got := test.quant.HeadBPW(); got != test.wantHead {
+				t.Errorf("HeadBPW() = %v, want %v", got, test.wantHead)
+			}
+		})
+	}
+}
+
+func TestResolveMLXQuant(t *testing.T) {
+	resolved, err := resolveQuant(llama8B, "mlx-mixed-3-6", "", 0, nil)
+	if err != nil {
+		t.Fatalf("resolveQuant returned error: %v", err)
+	}
+	want := MLXQuant{Bits: 3, HighBits: 6, GroupSize: 64}.BPW(llama8B)
+	if resolved.quant.Format != QuantFormatMLX || resolved.bpw != want {
+		t.Errorf("resolveQuant = %s at %v BPW, want mlx at %v BPW", resolved.quant.Format, resolved.bpw, want)
+	}
+
+	// The output head stays at 6 bits and the embedding is quantised in unified memory
+	bpwValues := resolved.quant.BPWValues(resolved.bpw, KVCacheFP16)
+	if bpwValues.LMHeadBPW != 6.5 || bpwValues.EmbeddingBPW != resolved.bpw || !bpwValues.GPUEmbedding {
+		t.Errorf("BPWValues = %+v, want a 6.5 BPW head and a %v BPW embedding on the GPU", bpwValues, resolved.bpw)
+	}
+}
+
+func TestAppleGPUMemory(t *testing.T) {
+	tests := []struct {
+		unifiedMemory float64
+		wiredLimitMB  int
+		want          float64
+	}{
+		{24, 0, 16},
+		{36, 0, 24},
+		{64, 0, 48},
+		{64, 57344, 56},
+		{16, 65536, 16},
+	}
+	for _, test := range tests {
+		if got := AppleGPUMemory(test.unifiedMemory, test.wiredLimitMB); got != test.want {
+			t.Errorf("AppleGPUMemory(%v, %d) = %v, want %v", test.unifiedMemory, test.wiredLimitMB, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// File: quantest/offload.go
+
+package quantest
+
+import (
+	"fmt"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+// PlanOffload calculates how many layers can be offloaded to the GPU
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - bpwValues: A BPWValues struct containing the bits per weight values.
+//   - context: An integer representing the context size.
+//   - params: A RuntimeParams struct containing the batch sizes and parallel slots.
+//   - vram: A float64 representing the available VRAM in GB.
+//
+// Returns:
+//   - OffloadPlan: The largest offload that fits, with the VRAM and RAM each side needs.
+//   - error: An error if the model can't be planned.
+//
+// Example:
+//
+//	plan, err := PlanOffload(config, GetBPWValues(4.85, KVCacheQ8_0), 32768, RuntimeParams{}, 12)
+//	fmt.Printf("num_gpu: %d/%d\n", plan.GPULayers, plan.TotalLayers)
+func PlanOffload(config ModelConfig, bpwValues BPWValues, context int, params RuntimeParams, vram float64) (OffloadPlan, error) {
+	logging.DebugLogger.Println("Planning layer offload...")
+
+	if config.IsEncoderDecoder {
+		return OffloadPlan{}, fmt.Errorf("layer offload planning is not supported for encoder-decoder models")
+	}
+
+	usage := calculateUsage(config, bpwValues, context, true, params)
+	for gpuLayers := len(usage.layerWeights) + 1; gpuLayers > 0; gpuLayers-- {
+		if plan := offloadLayers(usage, gpuLayers); plan.VRAM <= vram {
+			return plan, nil
+		}
+	}
+	return offloadLayers(usage, 0), nil
+}
+
+// CalculateOffload calculates the VRAM and RAM needed to offload a given number of layers
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - bpwValues: A BPWValues struct containing the bits per weight values.
+//   - context: An integer representing the context size.
+//   - params: A RuntimeParams struct containing the batch sizes and parallel slots.
+//   - gpuLayers: The number of layers to offload, the output head only at one more than the repeating layers.
+//
+// Returns:
+//   - OffloadPlan: The VRAM and RAM each side needs.
+//   - error: An error if the model can't be planned.
+//
+// Example:
+//
+//	plan, err := CalculateOffload(config, GetBPWValues(4.85, KVCacheFP16), 8192, RuntimeParams{Parallel: 2}, 20)
+func CalculateOffload(config ModelConfig, bpwValues BPWValues, context int, params RuntimeParams, gpuLayers int) (OffloadPlan, error) {
+	if config.IsEncoderDecoder {
+		return OffloadPlan{}, fmt.Errorf("layer offload planning is not supported for encoder-decoder models")
+	}
+	return offloadLayers(calculateUsage(config, bpwValues, context, true, params), gpuLayers), nil
+}
+
+// offloadLayers splits the usage between GPU and CPU as llama.cpp does for -ngl:
+// the repeating layers are offloaded from the last one backwards, and the output
+// head only once they all are, at n_layer+1. Each offloaded layer brings its KV
+// cache with it.
+func offloadLayers(usage vramUsage, gpuLayers int) OffloadPlan {
+	numLayers := len(usage.layerWeights)
+	gpuLayers = max(0, min(gpuLayers, numLayers+1))
+
+	plan := OffloadPlan{
+		GPULayers:      gpuLayers,
+		TotalLayers:    numLayers + 1,
+		RAM:            usage.weights.TokenEmbedding,
+		FullyOffloaded: gpuLayers == numLayers+1,
+	}
+
+	firstGPULayer := numLayers - min(gpuLayers, numLayers)
+	for layer := 0; layer < numLayers; layer++ {
+		if layer >= firstGPULayer {
+			plan.VRAM += usage.layerWeights[layer] + usage.layerKVCache[layer]
+		} else {
+			plan.RAM += usage.layerWeights[layer] + usage.layerKVCache[layer]
+		}
+	}
+
+	if gpuLayers > 0 {
+		plan.VRAM += bitsToGB(float64(CUDASize)) + usage.activations
+	}
+	if gpuLayers > numLayers {
+		plan.VRAM += usage.weights.Output + usage.logits
+	} else {
+		plan.RAM += usage.weights.Output + usage.logits
+	}
+	if !plan.FullyOffloaded {
+		// Layers left on the CPU need their own compute buffer
+		plan.RAM += usage.activations
+	}
+
+	return plan
+}
+
+// classifyFit decides whether an offload runs entirely on the GPU, spills to
+// system RAM or doesn't fit at all.
+func classifyFit(fitsVRAM bool, offload OffloadPlan, vram, ram float64) FitStatus {
+	switch {
+	case offload.VRAM > vram || offload.RAM > ram:
+		return FitNone
+	case fitsVRAM && offload.FullyOffloaded:
+		return FitGPU
+	default:
+		return FitCPUSpill
+	}
+}
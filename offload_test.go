@@ -0,0 +1,105 @@
+// File: quantest/offload_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculateOffload(t *testing.T) {
+	bpwValues := GetBPWValues(4.85, KVCacheFP16)
+	usage := calculateUsage(llama8B, bpwValues, 8192, true, RuntimeParams{})
+	overhead := bitsToGB(float64(CUDASize))
+
+	var layers float64
+	for i := range usage.layerWeights {
+		layers += usage.layerWeights[i] + usage.layerKVCache[i]
+	}
+	head := usage.weights.Output + usage.logits
+	embedding := usage.weights.TokenEmbedding
+
+	tests := []struct {
+		name      string
+		gpuLayers int
+		wantVRAM  float64
+		wantRAM   float64
+		wantFully bool
+	}{
+		{"cpu only", 0, 0, embedding + layers + head + usage.activations, false},
+		// -ngl 32 offloads every repeating layer but leaves the output head on the CPU
+		{"n_layer", 32, overhead + usage.activations + layers, embedding + head + usage.activations, false},
+		// -ngl 33 brings the output head and its logits to the GPU too
+		{"n_layer+1", 33, overhead + usage.activations + layers + head, embedding, true},
+		{"beyond n_layer+1", 99, overhead + usage.activations + layers + head, embedding, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := CalculateOffload(llama8B, bpwValues, 8192, RuntimeParams{}, test.gpuLayers)
+			if err != nil {
+				t.Fatalf("CalculateOffload returned error: %v", err)
+			}
+			if math.Abs(plan.VRAM-test.wantVRAM) > 1e-9 || math.Abs(plan.RAM-test.wantRAM) > 1e-9 || plan.FullyOffloaded != test.wantFully || plan.TotalLayers != 33 {
+				t.Errorf("CalculateOffload(%d) = %.3f GB vRAM, %.3f GB RAM, fully offloaded %v, %d total layers, want %.3f, %.3f, %v, 33",
+					test.gpuLayers, plan.VRAM, plan.RAM, plan.FullyOffloaded, plan.TotalLayers, test.wantVRAM, test.wantRAM, test.wantFully)
+			}
+		})
+	}
+}
+
+func TestPlanOffload(t *testing.T) {
+	bpwValues := GetBPWValues(4.85, KVCacheFP16)
+	full, _ := CalculateOffload(llama8B, bpwValues, 8192, RuntimeParams{}, 33)
+	layers, _ := CalculateOffload(llama8B, bpwValues, 8192, RuntimeParams{}, 32)
+
+	tests := []struct {
+		name string
+		vram float64
+		want int
+	}{
+		{"everything", full.VRAM, 33},
+		{"all but the output head", layers.VRAM, 32},
+		{"just short of the output head", full.VRAM - 1e-6, 32},
+		{"nothing", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := PlanOffload(llama8B, bpwValues, 8192, RuntimeParams{}, test.vram)
+			if err != nil {
+				t.Fatalf("PlanOffload returned error: %v", err)
+			}
+			if plan.GPULayers != test.want {
+				t.Errorf("PlanOffload(%.3f GB) = %d layers, want %d", test.vram, plan.GPULayers, test.want)
+			}
+		})
+	}
+}
+
+func TestClassifyFit(t *testing.T) {
+	full := OffloadPlan{GPULayers: 33, TotalLayers: 33, VRAM: 6, RAM: 0.5, FullyOffloaded: true}
+	partial := OffloadPlan{GPULayers: 20, TotalLayers: 33, VRAM: 4, RAM: 3, FullyOffloaded: false}
+
+	tests := []struct {
+		name     string
+		fitsVRAM bool
+		offload  OffloadPlan
+		vram     float64
+		ram      float64
+		want     FitStatus
+	}{
+		{"entirely on the GPU", true, full, 8, 16, FitGPU},
+		{"layers left in RAM", false, partial, 4, 16, FitCPUSpill},
+		// A full offload whose pooled fit fails on one device still spills
+		{"pooled fit without room on each GPU", false, full, 8, 16, FitCPUSpill},
+		{"not enough RAM for the rest", false, partial, 4, 2, FitNone},
+		{"offload beyond the vRAM", false, partial, 3, 16, FitNone},
+		{"token embeddings beyond the RAM", true, full, 8, 0.25, FitNone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := classifyFit(test.fitsVRAM, test.offload, test.vram, test.ram); got != test.want {
+				t.Errorf("classifyFit() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
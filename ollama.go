@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -19,7 +20,7 @@ func GetOllamaModelConfig(modelID string) (ModelConfig, error) {
 		return ModelConfig{}, fmt.Errorf("error fetching Ollama model info: %w", err)
 	}
 
-	return ModelConfig{
+	config := ModelConfig{
 		ModelName:             modelID,
 		NumParams:             float64(ollamaInfo.ModelInfo.ParameterCount) / 1e9,
 		MaxPositionEmbeddings: ollamaInfo.ModelInfo.ContextLength,
@@ -29,9 +30,112 @@ func GetOllamaModelConfig(modelID string) (ModelConfig, error) {
 		NumAttentionHeads:     ollamaInfo.ModelInfo.AttentionHeadCount,
 		IntermediateSize:      ollamaInfo.ModelInfo.FeedForwardLength,
 		VocabSize:             ollamaInfo.ModelInfo.VocabSize,
+		ModelType:             ollamaInfo.ModelInfo.Architecture,
+		SlidingWindow:         ollamaInfo.ModelInfo.SlidingWindow,
+		KeyLength:             ollamaInfo.ModelInfo.AttentionKeyLength,
+		ValueLength:           ollamaInfo.ModelInfo.AttentionValueLength,
 		IsOllama:              true,
-    QuantLevel:           ollamaInfo.Details.QuantizationLevel,
-	}, nil
+		QuantLevel:            ollamaInfo.Details.QuantizationLevel,
+	}
+
+	// Embedding models advertise the capability, or have pooling or non-causal attention
+	info := ollamaInfo.ModelInfo
+	if slices.Contains(ollamaInfo.Capabilities, "embedding") || embeddingModelTypes[info.Architecture] ||
+		info.PoolingType > 0 || (info.CausalAttention != nil && !*info.CausalAttention) {
+		config.IsEmbedding = true
+		if info.PoolingType > 0 && info.PoolingType < len(ollamaPoolingTypes) {
+			config.Pooling = ollamaPoolingTypes[info.PoolingType]
+		}
+	}
+
+	if info := ollamaInfo.ModelInfo; info.RopeScalingType != "" && info.RopeScalingType != "none" {
+		config.RopeScaling = &RopeScaling{
+			Type:                          info.RopeScalingType,
+			Factor:                        info.RopeScalingFactor,
+			OriginalMaxPositionEmbeddings: info.RopeScalingOriginalContext,
+		}
+	}
+
+	config.Layers = ollamaLayerConfigs(ollamaInfo)
+	for _, layer := range config.Layers {
+		config.NumAttentionHeads = max(config.NumAttentionHeads, layer.NumAttentionHeads)
+		config.NumKeyValueHeads = max(config.NumKeyValueHeads, layer.NumKeyValueHeads)
+		config.IntermediateSize = max(config.IntermediateSize, layer.IntermediateSize)
+	}
+
+	// Size the embedding and output tensors from the GGUF when Ollama lists them
+	if len(ollamaInfo.Tensors) > 0 {
+		hasOutput := false
+		for _, tensor := range ollamaInfo.Tensors {
+			switch tensor.Name {
+			case "token_embd.weight":
+				config.TokenEmbeddingParams = tensorParams(tensor)
+			case "output.weight":
+				config.OutputParams = tensorParams(tensor)
+				hasOutput = true
+			}
+		}
+		config.TieWordEmbeddings = !hasOutput
+		config.Tensors = ollamaInfo.Tensors
+	}
+
+	return config, nil
+}
+
+// ollamaSWAPatterns holds how often a full attention layer follows the sliding
+// window layers for architectures llama.cpp runs with interleaved SWA.
+var ollamaSWAPatterns = map[string]int{
+	"gemma2":  2,
+	"gemma3":  6,
+	"cohere2": 4,
+	"gpt-oss": 2,
+}
+
+// ollamaLayerConfigs builds per-layer configs from GGUF per-layer arrays and
+// sliding window metadata, returning nil for uniform models.
+func ollamaLayerConfigs(info *OllamaModelInfo) []LayerConfig {
+	modelInfo := info.ModelInfo
+	pattern := ollamaSWAPatterns[modelInfo.Architecture]
+	perLayer := len(modelInfo.LayerHeadCount) > 0 || len(modelInfo.LayerHeadCountKV) > 0 || len(modelInfo.LayerFeedForward) > 0
+	if !perLayer && (pattern == 0 || modelInfo.SlidingWindow == 0) {
+		return nil
+	}
+
+	layers := make([]LayerConfig, modelInfo.BlockCount)
+	for i := range layers {
+		layers[i] = LayerConfig{
+			NumAttentionHeads: layerValue(modelInfo.LayerHeadCount, i, modelInfo.AttentionHeadCount),
+			NumKeyValueHeads:  layerValue(modelInfo.LayerHeadCountKV, i, modelInfo.AttentionHeadCountKV),
+			IntermediateSize:  layerValue(modelInfo.LayerFeedForward, i, modelInfo.FeedForwardLength),
+		}
+		if layers[i].NumKeyValueHeads == 0 && len(modelInfo.LayerHeadCountKV) == 0 {
+			layers[i].NumKeyValueHeads = layers[i].NumAttentionHeads
+		}
+		if pattern > 0 && (i+1)%pattern != 0 {
+			layers[i].SlidingWindow = modelInfo.SlidingWindow
+		}
+	}
+	return layers
+}
+
+// layerValue returns a layer's entry from a per-layer array, or the scalar fallback
+func layerValue(values []int, layer, fallback int) int {
+	if layer < len(values) {
+		return values[layer]
+	}
+	return fallback
+}
+
+// tensorParams returns the number of elements in a tensor
+func tensorParams(tensor OllamaTensor) float64 {
+	if len(tensor.Shape) == 0 {
+		return 0
+	}
+	params := 1.0
+	for _, dim := range tensor.Shape {
+		params *= float64(dim)
+	}
+	return params
 }
 
 var (
@@ -39,10 +143,59 @@ var (
 	ollamaCacheMutex     sync.RWMutex
 )
 
-// TODO: Function to estimate the number of hidden layers based on OllamaModelInfo
-func estimateHiddenLayers(*OllamaModelInfo) int {
-	// Implement logic here to estimate the number of hidden layers
-	return 0
+// estimateHiddenLayers returns the number of transformer blocks reported by the GGUF metadata
+func estimateHiddenLayers(info *OllamaModelInfo) int {
+	return info.ModelInfo.BlockCount
+}
+
+// modelInfoValue looks up a GGUF metadata key for the given architecture,
+// falling back to the llama prefix used by most llama.cpp derived models.
+func modelInfoValue(modelInfo map[string]interface{}, arch, key string) (interface{}, bool) {
+	for _, prefix := range []string{arch, "llama"} {
+		if prefix == "" {
+			continue
+		}
+		if value, ok := modelInfo[prefix+"."+key]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// modelInfoInt looks up an integer GGUF metadata key
+func modelInfoInt(modelInfo map[string]interface{}, arch, key string) (int, bool) {
+	value, ok := modelInfoFloat(modelInfo, arch, key)
+	return int(value), ok
+}
+
+// modelInfoFloat looks up a numeric GGUF metadata key
+func modelInfoFloat(modelInfo map[string]interface{}, arch, key string) (float64, bool) {
+	value, _ := modelInfoValue(modelInfo, arch, key)
+	number, ok := value.(float64)
+	return number, ok
+}
+
+// modelInfoInts looks up a per-layer integer array GGUF metadata key, an
+// empty array being as good as missing
+func modelInfoInts(modelInfo map[string]interface{}, arch, key string) ([]int, bool) {
+	value, _ := modelInfoValue(modelInfo, arch, key)
+	array, ok := value.([]interface{})
+	if !ok || len(array) == 0 {
+		return nil, false
+	}
+	ints := make([]int, len(array))
+	for i, item := range array {
+		number, _ := item.(float64)
+		ints[i] = int(number)
+	}
+	return ints, true
+}
+
+// modelInfoString looks up a string GGUF metadata key
+func modelInfoString(modelInfo map[string]interface{}, arch, key string) (string, bool) {
+	value, _ := modelInfoValue(modelInfo, arch, key)
+	str, ok := value.(string)
+	return str, ok
 }
 
 // OllamaModelInfo gets model information from Ollama.
@@ -77,7 +230,8 @@ func FetchOllamaModelInfo(modelName string) (*OllamaModelInfo, error) {
 	fmt.Println("Using Ollama API URL:", apiURL)
 
 	url := fmt.Sprintf("%s/api/show", apiURL)
-	payload := []byte(fmt.Sprintf(`{"model": "%s"}`, modelName))
+	// Without verbose, Ollama empties metadata arrays such as the per-layer head counts
+	payload := []byte(fmt.Sprintf(`{"model": "%s", "verbose": true}`, modelName))
 
 	logging.InfoLogger.Println("Sending request to:", url)
 	logging.DebugLogger.Println("With payload:", string(payload))
@@ -97,42 +251,88 @@ func FetchOllamaModelInfo(modelName string) (*OllamaModelInfo, error) {
 	}
 
 	var response struct {
-		Details   OllamaModelInfo        `json:"details"`
-		ModelInfo map[string]interface{} `json:"model_info"`
-		Config    map[string]interface{} `json:"config"`
+		Details      OllamaModelDetails     `json:"details"`
+		ModelInfo    map[string]interface{} `json:"model_info"`
+		Config       map[string]interface{} `json:"config"`
+		Tensors      []OllamaTensor         `json:"tensors"`
+		Capabilities []string               `json:"capabilities"`
 	}
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, fmt.Errorf("error decoding Ollama API response: %v", err)
 	}
 
 	modelInfo := &OllamaModelInfo{
-		Details: response.Details.Details,
+		Details:      response.Details,
+		Tensors:      response.Tensors,
+		Capabilities: response.Capabilities,
 	}
 
-	// Parse the ModelInfo fields
+	// Parse the ModelInfo fields, GGUF keys are prefixed with the model's architecture
+	if arch, ok := response.ModelInfo["general.architecture"].(string); ok {
+		modelInfo.ModelInfo.Architecture = arch
+	}
+	arch := modelInfo.ModelInfo.Architecture
 	if paramCount, ok := response.ModelInfo["general.parameter_count"].(float64); ok {
 		modelInfo.ModelInfo.ParameterCount = int64(paramCount)
 	}
-	if contextLength, ok := response.ModelInfo["llama.context_length"].(float64); ok {
-		modelInfo.ModelInfo.ContextLength = int(contextLength)
+	if contextLength, ok := modelInfoInt(response.ModelInfo, arch, "context_length"); ok {
+		modelInfo.ModelInfo.ContextLength = contextLength
+	}
+	if headCount, ok := modelInfoInt(response.ModelInfo, arch, "attention.head_count"); ok {
+		modelInfo.ModelInfo.AttentionHeadCount = headCount
 	}
-	if headCount, ok := response.ModelInfo["llama.attention.head_count"].(float64); ok {
-		modelInfo.ModelInfo.AttentionHeadCount = int(headCount)
+	if headCountKV, ok := modelInfoInt(response.ModelInfo, arch, "attention.head_count_kv"); ok {
+		modelInfo.ModelInfo.AttentionHeadCountKV = headCountKV
 	}
-	if headCountKV, ok := response.ModelInfo["llama.attention.head_count_kv"].(float64); ok {
-		modelInfo.ModelInfo.AttentionHeadCountKV = int(headCountKV)
+	if keyLength, ok := modelInfoInt(response.ModelInfo, arch, "attention.key_length"); ok {
+		modelInfo.ModelInfo.AttentionKeyLength = keyLength
 	}
-	if embeddingLength, ok := response.ModelInfo["llama.embedding_length"].(float64); ok {
-		modelInfo.ModelInfo.EmbeddingLength = int(embeddingLength)
+	if valueLength, ok := modelInfoInt(response.ModelInfo, arch, "attention.value_length"); ok {
+		modelInfo.ModelInfo.AttentionValueLength = valueLength
 	}
-	if feedForwardLength, ok := response.ModelInfo["llama.feed_forward_length"].(float64); ok {
-		modelInfo.ModelInfo.FeedForwardLength = int(feedForwardLength)
+	if blockCount, ok := modelInfoInt(response.ModelInfo, arch, "block_count"); ok {
+		modelInfo.ModelInfo.BlockCount = blockCount
 	}
-	if ropeDimensionCount, ok := response.ModelInfo["llama.rope.dimension_count"].(float64); ok {
-		modelInfo.ModelInfo.RopeDimensionCount = int(ropeDimensionCount)
+	if embeddingLength, ok := modelInfoInt(response.ModelInfo, arch, "embedding_length"); ok {
+		modelInfo.ModelInfo.EmbeddingLength = embeddingLength
 	}
-	if vocabSize, ok := response.ModelInfo["llama.vocab_size"].(float64); ok {
-		modelInfo.ModelInfo.VocabSize = int(vocabSize)
+	if feedForwardLength, ok := modelInfoInt(response.ModelInfo, arch, "feed_forward_length"); ok {
+		modelInfo.ModelInfo.FeedForwardLength = feedForwardLength
+	}
+	if ropeDimensionCount, ok := modelInfoInt(response.ModelInfo, arch, "rope.dimension_count"); ok {
+		modelInfo.ModelInfo.RopeDimensionCount = ropeDimensionCount
+	}
+	if vocabSize, ok := modelInfoInt(response.ModelInfo, arch, "vocab_size"); ok {
+		modelInfo.ModelInfo.VocabSize = vocabSize
+	}
+	if slidingWindow, ok := modelInfoInt(response.ModelInfo, arch, "attention.sliding_window"); ok {
+		modelInfo.ModelInfo.SlidingWindow = slidingWindow
+	}
+	if headCounts, ok := modelInfoInts(response.ModelInfo, arch, "attention.head_count"); ok {
+		modelInfo.ModelInfo.LayerHeadCount = headCounts
+	}
+	if headCountsKV, ok := modelInfoInts(response.ModelInfo, arch, "attention.head_count_kv"); ok {
+		modelInfo.ModelInfo.LayerHeadCountKV = headCountsKV
+	}
+	if feedForwardLengths, ok := modelInfoInts(response.ModelInfo, arch, "feed_forward_length"); ok {
+		modelInfo.ModelInfo.LayerFeedForward = feedForwardLengths
+	}
+	if scalingType, ok := modelInfoString(response.ModelInfo, arch, "rope.scaling.type"); ok {
+		modelInfo.ModelInfo.RopeScalingType = scalingType
+	}
+	if scalingFactor, ok := modelInfoFloat(response.ModelInfo, arch, "rope.scaling.factor"); ok {
+		modelInfo.ModelInfo.RopeScalingFactor = scalingFactor
+	}
+	if originalContext, ok := modelInfoInt(response.ModelInfo, arch, "rope.scaling.original_context_length"); ok {
+		modelInfo.ModelInfo.RopeScalingOriginalContext = originalContext
+	}
+	if poolingType, ok := modelInfoInt(response.ModelInfo, arch, "pooling_type"); ok {
+		modelInfo.ModelInfo.PoolingType = poolingType
+	}
+	if causal, ok := modelInfoValue(response.ModelInfo, arch, "attention.causal"); ok {
+		if causal, ok := causal.(bool); ok {
+			modelInfo.ModelInfo.CausalAttention = &causal
+		}
 	}
 
 	logging.DebugLogger.Println("Response status:", resp.Status)
@@ -147,10 +347,10 @@ func FetchOllamaModelInfo(modelName string) (*OllamaModelInfo, error) {
 
 // A function that takes an ollama model/name and returns the quantisation level
 func GetOllamaQuantLevel(modelName string) (string, error) {
-  modelInfo, err := FetchOllamaModelInfo(modelName)
-  if err != nil {
-    return "", fmt.Errorf("error fetching Ollama model info: %w", err)
-  }
+	modelInfo, err := FetchOllamaModelInfo(modelName)
+	if err != nil {
+		return "", fmt.Errorf("error fetching Ollama model info: %w", err)
+	}
 
-  return modelInfo.Details.QuantizationLevel, nil
+	return modelInfo.Details.QuantizationLevel, nil
 }
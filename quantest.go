@@ -2,6 +2,8 @@ package quantest
 
 import (
 	"fmt"
+	"math"
+	"path"
 	"strings"
 )
 
@@ -12,44 +14,212 @@ func GetModelConfig(modelName string) (ModelConfig, error) {
 	if strings.Contains(modelName, ":") {
 		return GetOllamaModelConfig(modelName)
 	}
+	// A GGUF file in a repository shares the repository's config
+	if strings.HasSuffix(strings.ToLower(modelName), ".gguf") {
+		repository := path.Dir(modelName)
+		config, err := GetHFModelConfig(repository)
+		if err != nil {
+			return ModelConfig{}, fmt.Errorf("error reading %s's config.json, which most GGUF repositories don't include, "+
+				"try the original model's repository or an Ollama model instead: %w", repository, err)
+		}
+		config.ModelName = modelName
+		return config, nil
+	}
 	return GetHFModelConfig(modelName)
 }
 
 func EstimateVRAMForModel(modelName string, vram float64, contextSize int, quantLevel, kvQuant string) (*VRAMEstimation, error) {
+	return EstimateVRAMWithOptions(modelName, EstimateOptions{
+		VRAM:         vram,
+		ContextSize:  contextSize,
+		QuantLevel:   quantLevel,
+		KVCacheQuant: kvQuant,
+	})
+}
+
+// EstimateVRAMWithOptions estimates the VRAM usage of a model with the given options.
+//
+// Parameters:
+//   - modelName: A string representing the model name (Huggingface/ModelID or Ollama:modelName).
+//   - opts: An EstimateOptions struct containing the estimation parameters.
+//
+// Returns:
+//   - *VRAMEstimation: A pointer to a VRAMEstimation struct containing the estimation results.
+//   - error: An error if the estimation fails.
+//
+// Example:
+//
+//	estimation, err := quantest.EstimateVRAMWithOptions("Qwen/Qwen2.5-7B-Instruct", quantest.EstimateOptions{
+//		VRAM:         24,
+//		ContextSize:  65536,
+//		QuantLevel:   "Q4_K_M",
+//		KVCacheQuant: "q8_0",
+//		RopeScaling:  "yarn",
+//		RopeFactor:   4,
+//	})
+func EstimateVRAMWithOptions(modelName string, opts EstimateOptions) (*VRAMEstimation, error) {
+	vram, contextSize, quantLevel := opts.VRAM, opts.ContextSize, opts.QuantLevel
+	kvCacheQuant := KVCacheQuantisation(opts.KVCacheQuant)
+	if err := opts.Workload.validate(); err != nil {
+		return nil, err
+	}
 
 	modelConfig, err := GetModelConfig(modelName)
 	if err != nil {
 		return nil, fmt.Errorf("error getting model config: %w", err)
 	}
 
-  // If quantLevel is not provided, and it's an ollama model, check the model's config
-  if quantLevel == "" && modelConfig.IsOllama {
-    quantLevel = modelConfig.QuantLevel
-  } else if quantLevel == "" {
-    fmt.Println("Quant level not provided, and model is not an Ollama model. Defaulting to q4_k_m...")
-    quantLevel = "q4_k_m"
-  }
+	// Opt into the RoPE scaled context, a supplied scaling implies opting in
+	if opts.ScaledContext || opts.RopeScaling != "" || opts.RopeFactor > 0 {
+		modelConfig = modelConfig.WithScaledContext(opts.RopeScaling, opts.RopeFactor)
+	}
 
-	// Parse BPW from quantLevel
-	bpw, err := ParseBPWOrQuant(quantLevel)
+	modelConfig = modelConfig.WithWorkload(opts.Workload)
+
+	// Encoder-decoder models size the encoder input and decoder output separately
+	if modelConfig.IsEncoderDecoder {
+		if opts.InputLength > 0 {
+			encoder := modelConfig.encoder()
+			encoder.InputLength = opts.InputLength
+			modelConfig.Encoder = &encoder
+		}
+		if opts.OutputLength > 0 {
+			contextSize = opts.OutputLength
+		}
+	}
+
+	// An Apple Silicon GPU can only wire part of the unified memory, leaving the rest to the CPU
+	if opts.UnifiedMemory > 0 {
+		vram = AppleGPUMemory(opts.UnifiedMemory, opts.WiredLimitMB)
+		if opts.RAM == 0 {
+			opts.RAM = opts.UnifiedMemory - vram
+		}
+	}
+
+	// Multiple GPUs pool their memory, less the overhead each additional one carries
+	if len(opts.GPUs) > 0 {
+		vram = 0
+		for _, capacity := range opts.GPUs {
+			vram += capacity
+		}
+		vram -= bitsToGB(float64(CUDASize * (len(opts.GPUs) - 1)))
+	}
+
+	var warnings []string
+
+	// Without a quant level, use the model's own or infer it from the model's name
+	resolved, err := resolveQuant(modelConfig, quantLevel, opts.QuantType, opts.HeadBits, opts.Registry)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing quantisation level: %w", err)
+		return nil, err
+	}
+	quantLevel, quantType, bpw := resolved.level, resolved.quant, resolved.bpw
+	warnings = append(warnings, resolved.warnings...)
+
+	bpwValues := quantType.BPWValues(bpw, kvCacheQuant)
+	params := RuntimeParams{BatchSize: opts.BatchSize, UBatchSize: opts.UBatchSize, Parallel: opts.Parallel, EmbedBatch: opts.EmbedBatch}
+	if contextSize == 0 {
+		contextSize = modelConfig.MaxPositionEmbeddings
+	}
+
+	// Embedding models truncate their inputs rather than extending the context
+	if modelConfig.IsEmbedding && modelConfig.MaxPositionEmbeddings > 0 && contextSize > modelConfig.MaxPositionEmbeddings {
+		warnings = append(warnings, fmt.Sprintf("inputs are truncated to the model's max position embeddings of %d tokens", modelConfig.MaxPositionEmbeddings))
+		contextSize = modelConfig.MaxPositionEmbeddings
+	}
+
+	// LoRA adapters are a fixed cost alongside the model, leaving the rest for the model itself
+	var adapters *AdapterEstimate
+	modelVRAM := vram
+	if len(opts.Adapters.Adapters) > 0 {
+		adapters, err = EstimateAdapters(modelConfig, opts.Adapters)
+		if err != nil {
+			return nil, fmt.Errorf("error estimating LoRA adapters: %w", err)
+		}
+		modelVRAM -= adapters.VRAM
+		warnings = append(warnings, adapters.Warnings...)
 	}
 
 	// Calculate VRAM usage
-	estimatedVRAM, err := CalculateVRAM(modelConfig, bpw, contextSize, KVCacheQuantisation(kvQuant))
+	estimatedVRAM, err := CalculateVRAMWithQuantType(modelConfig, bpw, contextSize, kvCacheQuant, quantType, params)
 	if err != nil {
 		return nil, fmt.Errorf("error calculating VRAM: %w", err)
 	}
 
+	fitsAvailable := estimatedVRAM <= modelVRAM
+
+	// Split the model across GPUs and judge the fit per device
+	var devices []DeviceUsage
+	switch {
+	case len(opts.GPUs) > 0 && modelConfig.IsEncoderDecoder:
+		warnings = append(warnings, "tensor split planning is not supported for encoder-decoder models, estimating against the GPUs' pooled vRAM")
+	case len(opts.GPUs) > 0:
+		devices, err = PlanTensorSplit(modelConfig, bpwValues, contextSize, params, opts.GPUs, opts.TensorSplit)
+		if err != nil {
+			return nil, fmt.Errorf("error planning tensor split: %w", err)
+		}
+		if adapters != nil {
+			addSplitAdapters(devices, adapters.VRAM)
+		}
+		estimatedVRAM = math.Round(splitTotal(devices)*100) / 100
+		fitsAvailable = splitFits(devices)
+	}
+
+	// Work out how many layers can be offloaded, or what a fixed number of layers needs
+	var offload OffloadPlan
+	if opts.GPULayers > 0 {
+		offload, err = CalculateOffload(modelConfig, bpwValues, contextSize, params, opts.GPULayers)
+	} else {
+		offload, err = PlanOffload(modelConfig, bpwValues, contextSize, params, modelVRAM)
+	}
+	if err != nil && !modelConfig.IsEncoderDecoder && !modelConfig.IsEmbedding {
+		warnings = append(warnings, err.Error())
+	}
+
+	// Budget system RAM for whatever isn't offloaded
+	ram := opts.RAM
+	if ram == 0 {
+		ram, err = GetSystemRAM()
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+	estimatedRAM := offload.RAM
+	modelRAM := ram
+	if adapters != nil {
+		modelRAM -= adapters.RAM
+	}
+	fit := classifyFit(fitsAvailable, offload, modelVRAM, modelRAM)
+	if modelConfig.IsEncoderDecoder || modelConfig.IsEmbedding {
+		// Planned without a layer offload, so only the GPU fit and token embeddings apply
+		estimatedRAM = CalculateWeights(modelConfig, bpwValues).TokenEmbedding
+		fit = FitGPU
+		if !fitsAvailable || estimatedRAM > modelRAM {
+			fit = FitNone
+		}
+	}
+
+	if adapters != nil {
+		// A split's devices already carry the adapters
+		if len(devices) == 0 {
+			estimatedVRAM = math.Round((estimatedVRAM+adapters.VRAM)*100) / 100
+		}
+		estimatedRAM += adapters.RAM
+	}
+
 	// Calculate maximum context size
-	maxContextSize, err := CalculateContext(modelConfig, vram, bpw, KVCacheQuantisation(kvQuant))
+	maxContextSize, err := CalculateContextWithQuantType(modelConfig, modelVRAM, bpw, kvCacheQuant, quantType, params)
 	if err != nil {
 		maxContextSize = 0 // Set to 0 if calculation fails
 	}
 
+	// Size the batch throughput of embedding models
+	var maxEmbedBatch int
+	if modelConfig.IsEmbedding {
+		maxEmbedBatch = MaxEmbeddingBatch(modelConfig, bpwValues, contextSize, modelVRAM)
+	}
+
 	// Calculate best BPW
-	bestBPW, recommendations, err := CalculateBPW(modelConfig, vram, contextSize, KVCacheQuantisation(kvQuant), "gguf")
+	bestBPW, recommendations, err := CalculateBPWWithQuantType(modelConfig, modelVRAM, contextSize, kvCacheQuant, quantType, params)
 	if err != nil {
 		bestBPW = "Unknown"
 		recommendations = QuantRecommendations{Recommendations: make(map[int]string)}
@@ -57,15 +227,26 @@ func EstimateVRAMForModel(modelName string, vram float64, contextSize int, quant
 
 	return &VRAMEstimation{
 		ModelName:       modelName,
-		ModelConfig:     modelConfig, // Add this line
+		ModelConfig:     modelConfig,
 		ContextSize:     contextSize,
-		KVCacheQuant:    KVCacheQuantisation(kvQuant),
+		KVCacheQuant:    kvCacheQuant,
 		AvailableVRAM:   vram,
+		AvailableRAM:    ram,
 		QuantLevel:      quantLevel,
+		QuantFormat:     quantType.Format,
+		QuantSource:     resolved.source,
 		EstimatedVRAM:   estimatedVRAM,
-		FitsAvailable:   estimatedVRAM <= vram,
+		EstimatedRAM:    estimatedRAM,
+		Fit:             fit,
+		Weights:         CalculateWeights(modelConfig, bpwValues),
+		Devices:         devices,
+		Offload:         offload,
+		FitsAvailable:   fitsAvailable,
 		MaxContextSize:  maxContextSize,
+		MaxEmbedBatch:   maxEmbedBatch,
+		Adapters:        adapters,
 		MaximumQuant:    fmt.Sprintf("%v", bestBPW),
 		Recommendations: recommendations.Recommendations,
+		Warnings:        append(warnings, contextWarnings(modelConfig, contextSize)...),
 	}, nil
 }
@@ -0,0 +1,80 @@
+// File: quantest/quantest_test.go
+
+package quantest
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEstimateSplitFit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeHFCache(t, "test/split", strings.Replace(llama8BConfig, "%s", "", 1), "")
+
+	// Q8_0 Llama 3.1 8B needs ~11.4 GB at 8K, so two 4 GB GPUs spill the rest to RAM
+	tests := []struct {
+		name string
+		gpus []float64
+		ram  float64
+		want FitStatus
+	}{
+		{"fits", []float64{12, 12}, 64, FitGPU},
+		{"spills", []float64{4, 4}, 64, FitCPUSpill},
+		{"no room in RAM", []float64{4, 4}, 1, FitNone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			estimation, err := EstimateVRAMWithOptions("test/split", EstimateOptions{ContextSize: 8192, QuantLevel: "Q8_0", GPUs: test.gpus, RAM: test.ram})
+			if err != nil {
+				t.Fatalf("EstimateVRAMWithOptions returned error: %v", err)
+			}
+			if estimation.Fit != test.want {
+				t.Errorf("Fit = %s, want %s", estimation.Fit, test.want)
+			}
+		})
+	}
+}
+
+func TestEstimateSplitAdapters(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeHFCache(t, "test/split-adapters", strings.Replace(llama8BConfig, "%s", "", 1), "")
+
+	estimation, err := EstimateVRAMWithOptions("test/split-adapters", EstimateOptions{
+		ContextSize: 8192,
+		QuantLevel:  "Q4_K_M",
+		GPUs:        []float64{6, 6},
+		RAM:         64,
+		Adapters:    AdapterOptions{Adapters: []LoRAAdapter{{Name: "a", Rank: 64, Targets: []string{"all-linear"}}}},
+	})
+	if err != nil {
+		t.Fatalf("EstimateVRAMWithOptions returned error: %v", err)
+	}
+
+	// The adapters are spread with the layers and counted once in the total
+	var adapters float64
+	for _, device := range estimation.Devices {
+		adapters += device.Adapters
+		if want := estimation.Adapters.VRAM * float64(device.Layers) / 32; math.Abs(device.Adapters-want) > 1e-9 {
+			t.Errorf("GPU %d adapters = %v, want %v for %d of 32 layers", device.Index, device.Adapters, want, device.Layers)
+		}
+	}
+	if math.Abs(adapters-estimation.Adapters.VRAM) > 1e-9 {
+		t.Errorf("device adapters sum to %v, want %v", adapters, estimation.Adapters.VRAM)
+	}
+	if want := math.Round(splitTotal(estimation.Devices)*100) / 100; estimation.EstimatedVRAM != want {
+		t.Errorf("EstimatedVRAM = %v, want the devices' total %v", estimation.EstimatedVRAM, want)
+	}
+}
+
+func TestEstimateInvalidTensorSplit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeHFCache(t, "test/split-invalid", strings.Replace(llama8BConfig, "%s", "", 1), "")
+
+	for _, tensorSplit := range [][]float64{{1}, {1, -1}, {0, 0}} {
+		_, err := EstimateVRAMWithOptions("test/split-invalid", EstimateOptions{QuantLevel: "Q4_K_M", GPUs: []float64{24, 24}, TensorSplit: tensorSplit, RAM: 64})
+		if err == nil {
+			t.Errorf("EstimateVRAMWithOptions with tensor split %v returned no error", tensorSplit)
+		}
+	}
+}
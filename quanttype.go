@@ -0,0 +1,348 @@
+// File: quantest/quanttype.go
+
+package quantest
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultHeadBits is ExLlama's default output head bits.
+	DefaultHeadBits = 6
+
+	// DefaultGroupSize is AutoAWQ's and AutoGPTQ's default group size.
+	DefaultGroupSize = 128
+
+	// bitsandbytes quantises 4-bit weights in blocks of 64 with an fp32 absmax
+	// each, or with double quant, an 8-bit absmax and an fp32 scale per 256 blocks.
+	bnbBlockSize       = 64
+	bnbDoubleQuantSize = 256
+
+	// maxRecommendedBPW stops recommendations at 16-bit, as F32 gains nothing over it
+	maxRecommendedBPW = 16
+)
+
+// AWQ and GPTQ names such as awq-4bit-g128, gptq-8bit-32g, gptq-4bit or gptq-int4
+var groupQuantPattern = regexp.MustCompile(`^(awq|gptq)[-_]?(?:int)?([2348])(?:bits?|b)?(?:[-_](?:g(-1|\d+)|(\d+)g))?$`)
+
+// bitsandbytes names such as bnb-nf4-dq, nf4, fp4 or bnb-int8
+var bnbQuantPattern = regexp.MustCompile(`^(?:bnb[-_])?(nf4|fp4|int8|llm\.int8)(?:[-_](dq))?$`)
+
+// groupQuantBits are the bit widths AWQ and GPTQ recommendations are chosen from
+var groupQuantBits = []int{2, 3, 4, 8}
+
+// quantCandidate is a quant that recommendations can be chosen from
+type quantCandidate struct {
+	name string
+	bpw  float64
+}
+
+// ParseQuantType parses a quantisation format name, defaulting to GGUF
+//
+// Example:
+//
+//	quantType, err := ParseQuantType("exl2")
+func ParseQuantType(name string) (QuantType, error) {
+	switch QuantFormat(strings.ToLower(strings.TrimSpace(name))) {
+	case "", QuantFormatGGUF:
+		return QuantType{Format: QuantFormatGGUF}, nil
+	case QuantFormatEXL2:
+		return QuantType{Format: QuantFormatEXL2}, nil
+	case QuantFormatEXL3:
+		return QuantType{Format: QuantFormatEXL3}, nil
+	case QuantFormatAWQ, "autoawq":
+		return QuantType{Format: QuantFormatAWQ}, nil
+	case QuantFormatGPTQ, "autogptq":
+		return QuantType{Format: QuantFormatGPTQ}, nil
+	case QuantFormatBNB, "bitsandbytes":
+		return QuantType{Format: QuantFormatBNB}, nil
+	case QuantFormatMLX:
+		return QuantType{Format: QuantFormatMLX}, nil
+	}
+	return QuantType{}, fmt.Errorf("unknown quant type %q, expected gguf, exl2, exl3, awq, gptq, bnb or mlx", name)
+}
+
+// resolvedQuant represents a model's quant level resolved to its format and BPW
+type resolvedQuant struct {
+	level    string
+	source   QuantSource
+	quant    QuantType
+	bpw      float64
+	warnings []string
+}
+
+// resolveQuant works out a model's quant level, format and BPW
+//
+// Without a quant level, the model's own is used or one is inferred from its
+// name, along with its format when no quant type is given. A quant level from
+// the model that quantest doesn't know is estimated as DefaultQuantLevel, with
+// a warning. User-defined quants in the registry are looked up first.
+func resolveQuant(config ModelConfig, quantLevel, quantTypeName string, headBits int, registry *Registry) (resolvedQuant, error) {
+	resolved := resolvedQuant{level: quantLevel, source: QuantSourceSpecified}
+	inferredType := false
+	if resolved.level == "" {
+		inferred := InferQuant(config)
+		resolved.level, resolved.source = inferred.QuantLevel, inferred.Source
+		if quantTypeName == "" && inferred.Format != "" {
+			quantTypeName, inferredType = string(inferred.Format), true
+		}
+	}
+
+	// Parse BPW from the quant level, user-defined quants first
+	quants := registryOrDefault(registry)
+	bpw, err := ParseBPWOrQuant(resolved.level)
+	if quant, ok := quants.Lookup(resolved.level); ok {
+		bpw, err = quant.BPW, nil
+	} else if err != nil {
+		var quant QuantSpec
+		if quant, err = quants.Resolve(resolved.level); err == nil {
+			bpw = quant.BPW
+		}
+	}
+	if err != nil && resolved.source != QuantSourceSpecified {
+		// A quant level from the model itself may be one quantest doesn't know, estimate with the default instead
+		resolved.warnings = append(resolved.warnings, fmt.Sprintf("unknown quant level %s from the %s, estimating with %s", resolved.level, resolved.source, DefaultQuantLevel))
+		resolved.level, resolved.source = DefaultQuantLevel, QuantSourceDefault
+		if inferredType {
+			quantTypeName = ""
+		}
+		bpw, err = ParseBPWOrQuant(resolved.level)
+	}
+	if err != nil {
+		return resolvedQuant{}, fmt.Errorf("error parsing quantisation level: %w", err)
+	}
+
+	quantType, err := ParseQuantType(quantTypeName)
+	if err != nil {
+		return resolvedQuant{}, err
+	}
+	if quantTypeName == "" {
+		// AWQ, GPTQ and bitsandbytes quant levels name their format
+		if weightQuant, _, err := ParseWeightQuant(resolved.level); err == nil {
+			quantType = weightQuant
+		}
+	}
+	if mlxQuant, err := ParseMLXQuant(resolved.level); err == nil && (quantTypeName == "" || quantType.Format == QuantFormatMLX) {
+		// Mixed recipes depend on the model's layers and keep the output head at the higher bits
+		quantType = QuantType{Format: QuantFormatMLX, HeadBPW: mlxQuant.HeadBPW()}
+		bpw = mlxQuant.BPW(config)
+	}
+	quantType.HeadBits = headBits
+	if quantType.Format == QuantFormatGGUF {
+		// Spellings such as q4km resolve to the quant's name, which finds its recipe
+		if quant, err := quants.Resolve(resolved.level); err == nil {
+			resolved.level, bpw = quant.Name, quant.BPW
+		}
+		quantType.Recipe, quantType.Registry = resolved.level, registry
+	}
+	if err := quantType.validate(); err != nil {
+		return resolvedQuant{}, err
+	}
+
+	resolved.quant, resolved.bpw = quantType, bpw
+	return resolved, nil
+}
+
+// ParseWeightQuant parses an AWQ, GPTQ or bitsandbytes quant name into its format and effective BPW
+//
+// AWQ and GPTQ store an fp16 scale and a packed zero point per group of
+// weights, so a 4-bit quant with groups of 128 is 4 + (16 + 4) / 128 BPW. The
+// group size defaults to 128, and -1 quantises per channel with no group
+// overhead to speak of. bitsandbytes' nf4 and fp4 add an absmax per block of
+// 64 weights, which double quant (-dq) shrinks to 8 bits, and int8 is LLM.int8().
+//
+// Example:
+//
+//	quantType, bpw, err := ParseWeightQuant("awq-4bit-g128") // awq, 4.16
+func ParseWeightQuant(name string) (QuantType, float64, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if match := groupQuantPattern.FindStringSubmatch(name); match != nil {
+		bits, _ := strconv.Atoi(match[2])
+		groupSize := DefaultGroupSize
+		if group := match[3] + match[4]; group != "" {
+			groupSize, _ = strconv.Atoi(group)
+		}
+		if groupSize == 0 {
+			return QuantType{}, 0, fmt.Errorf("invalid group size in %q", name)
+		}
+		return QuantType{Format: QuantFormat(match[1])}, groupQuantBPW(bits, groupSize), nil
+	}
+
+	if match := bnbQuantPattern.FindStringSubmatch(name); match != nil {
+		bpw := 8.0
+		if match[1] == "nf4" || match[1] == "fp4" {
+			bpw = 4 + 32.0/bnbBlockSize
+			if match[2] == "dq" {
+				bpw = 4 + 8.0/bnbBlockSize + 32.0/(bnbBlockSize*bnbDoubleQuantSize)
+			}
+		} else if match[2] == "dq" {
+			return QuantType{}, 0, fmt.Errorf("double quant only applies to bitsandbytes' 4-bit quants, not %q", name)
+		}
+		return QuantType{Format: QuantFormatBNB}, bpw, nil
+	}
+
+	return QuantType{}, 0, fmt.Errorf("%q is not an AWQ, GPTQ or bitsandbytes quant", name)
+}
+
+// groupQuantBPW returns the effective BPW of an AWQ or GPTQ quant with a group size, or -1 for per channel
+func groupQuantBPW(bits, groupSize int) float64 {
+	if groupSize < 0 {
+		return float64(bits)
+	}
+	return float64(bits) + float64(16+bits)/float64(groupSize)
+}
+
+// IsExLlama reports whether the quant type is run by ExLlama, e.g. under TabbyAPI
+func (q QuantType) IsExLlama() bool {
+	return q.Format == QuantFormatEXL2 || q.Format == QuantFormatEXL3
+}
+
+// BPWValues returns the bits per weight values for a model quantised with this type
+//
+// GGUF follows llama.cpp's quant mixes, see GetBPWValues, and with a recipe
+// is sized per tensor as llama-quantize makes it, see TensorTypes. ExLlama quantises
+// the output head to the head bits, whatever the model's BPW, and keeps the
+// token embeddings unquantised in system RAM. AWQ, GPTQ and bitsandbytes leave
+// both unquantised, and vLLM holds the embedding on the GPU. MLX quantises both
+// and keeps them in unified memory the GPU wires.
+//
+// Example:
+//
+//	bpwValues := QuantType{Format: QuantFormatEXL2, HeadBits: 8}.BPWValues(4.65, KVCacheQ6)
+func (q QuantType) BPWValues(bpw float64, kvCacheQuant KVCacheQuantisation) BPWValues {
+	bpwValues := GetBPWValues(bpw, kvCacheQuant)
+	if q.Format == QuantFormatGGUF || q.Format == "" {
+		bpwValues.Recipe, bpwValues.Registry = q.Recipe, q.Registry
+		// User-defined quants can pin the KV cache they run with
+		if quant, ok := registryOrDefault(q.Registry).Lookup(q.Recipe); ok && quant.KVCache != "" {
+			bpwValues.KVCacheBPW = GetBPWValues(bpw, quant.KVCache).KVCacheBPW
+		}
+	}
+	if q.IsExLlama() {
+		bpwValues.LMHeadBPW = float64(q.headBits())
+		bpwValues.EmbeddingBPW = 16
+	}
+	if q.servedByVLLM() {
+		bpwValues.LMHeadBPW = 16
+		bpwValues.EmbeddingBPW = 16
+		bpwValues.GPUEmbedding = true
+	}
+	if q.Format == QuantFormatMLX {
+		bpwValues.LMHeadBPW = bpw
+		if q.HeadBPW > 0 {
+			bpwValues.LMHeadBPW = q.HeadBPW
+		}
+		bpwValues.GPUEmbedding = true
+	}
+	return bpwValues
+}
+
+// servedByVLLM reports whether the quant type is one vLLM and Transformers load
+func (q QuantType) servedByVLLM() bool {
+	return q.Format == QuantFormatAWQ || q.Format == QuantFormatGPTQ || q.Format == QuantFormatBNB
+}
+
+// headBits returns the ExLlama head bits, defaulting to DefaultHeadBits
+func (q QuantType) headBits() int {
+	if q.HeadBits == 0 {
+		return DefaultHeadBits
+	}
+	return q.HeadBits
+}
+
+// candidates returns the quants available in this type, from the lowest BPW to the highest,
+// quants of the same BPW from the lowest quality to the highest
+func (q QuantType) candidates() []quantCandidate {
+	var steps []float64
+	switch q.Format {
+	case QuantFormatEXL2:
+		steps = EXL2Options
+	case QuantFormatEXL3:
+		steps = EXL3Options
+	case QuantFormatAWQ, QuantFormatGPTQ:
+		var candidates []quantCandidate
+		for _, bits := range groupQuantBits {
+			candidates = append(candidates, quantCandidate{
+				name: fmt.Sprintf("%s-%dbit-g%d", q.Format, bits, DefaultGroupSize),
+				bpw:  groupQuantBPW(bits, DefaultGroupSize),
+			})
+		}
+		return candidates
+	case QuantFormatMLX:
+		var candidates []quantCandidate
+		for _, bits := range mlxBits {
+			quant := MLXQuant{Bits: bits, GroupSize: DefaultMLXGroupSize}
+			candidates = append(candidates, quantCandidate{name: quant.Name(), bpw: quant.BPW(ModelConfig{})})
+		}
+		return candidates
+	case QuantFormatBNB:
+		var candidates []quantCandidate
+		for _, name := range []string{"bnb-nf4-dq", "bnb-nf4", "bnb-int8"} {
+			_, bpw, _ := ParseWeightQuant(name)
+			candidates = append(candidates, quantCandidate{name: name, bpw: bpw})
+		}
+		return candidates
+	default:
+		var quants []QuantSpec
+		for _, quant := range registryOrDefault(q.Registry).Quants() {
+			// Recommendations are for VRAM, so skip quants without GPU kernels
+			if quant.BPW <= maxRecommendedBPW && quant.GPU {
+				quants = append(quants, quant)
+			}
+		}
+		var candidates []quantCandidate
+		for _, quant := range quants {
+			if !dominated(quant, quants) {
+				candidates = append(candidates, quantCandidate{name: quant.Name, bpw: quant.BPW})
+			}
+		}
+		return candidates
+	}
+
+	candidates := make([]quantCandidate, len(steps))
+	for i, bpw := range steps {
+		candidates[i] = quantCandidate{name: fmt.Sprintf("%.2fbpw", bpw), bpw: bpw}
+	}
+	return candidates
+}
+
+// dominated reports whether another quant ranks higher at the same or a lower BPW,
+// e.g. Q5_K_M over Q5_1, so the quant is never worth recommending. Unranked
+// user-defined quants are never dominated.
+func dominated(quant QuantSpec, quants []QuantSpec) bool {
+	if quant.Quality == 0 {
+		return false
+	}
+	for _, other := range quants {
+		if other.BPW <= quant.BPW && other.Quality > quant.Quality {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the head bits are ones ExLlama supports
+func (q QuantType) validate() error {
+	if q.IsExLlama() && q.HeadBits != 0 && q.HeadBits != 6 && q.HeadBits != 8 {
+		return fmt.Errorf("invalid head bits %d, expected 6 or 8", q.HeadBits)
+	}
+	return nil
+}
+
+// bpwSteps returns every BPW from low to high in the given step
+func bpwSteps(low, high, step float64) []float64 {
+	var steps []float64
+	for i := 0; ; i++ {
+		bpw := math.Round((low+float64(i)*step)*100) / 100
+		if bpw > high {
+			break
+		}
+		steps = append(steps, bpw)
+	}
+	return steps
+}
@@ -0,0 +1,164 @@
+// File: quantest/quanttype_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResolveQuant(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     ModelConfig
+		quantLevel string
+		quantType  string
+		wantLevel  string
+		wantSource QuantSource
+		wantFormat QuantFormat
+		wantBPW    float64
+		wantWarn   bool
+	}{
+		{"specified gguf", ModelConfig{}, "q4km", "", "Q4_K_M", QuantSourceSpecified, QuantFormatGGUF, 4.85, false},
+		{"awq repository", ModelConfig{ModelName: "Qwen/Qwen2.5-7B-Instruct-AWQ"}, "", "", "awq-4bit", QuantSourceRepository, QuantFormatAWQ, 4.15625, false},
+		{"exl2 repository", ModelConfig{ModelName: "turboderp/Llama-3.1-8B-Instruct-exl2-4.0bpw"}, "", "", "4.0bpw", QuantSourceRepository, QuantFormatEXL2, 4, false},
+		{"ollama tag", ModelConfig{ModelName: "llama3.1:8b-instruct-q6_K"}, "", "", "Q6_K", QuantSourceTag, QuantFormatGGUF, 6.59, false},
+		{"unknown metadata", ModelConfig{QuantLevel: "Q9_Z"}, "", "", DefaultQuantLevel, QuantSourceDefault, QuantFormatGGUF, 4.85, true},
+		{"specified type", ModelConfig{}, "4.65", "exl2", "4.65", QuantSourceSpecified, QuantFormatEXL2, 4.65, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolveQuant(test.config, test.quantLevel, test.quantType, 0, nil)
+			if err != nil {
+				t.Fatalf("resolveQuant returned error: %v", err)
+			}
+			if resolved.level != test.wantLevel || resolved.source != test.wantSource || resolved.quant.Format != test.wantFormat || resolved.bpw != test.wantBPW {
+				t.Errorf("resolveQuant = %s from %s as %s at %v BPW, want %s from %s as %s at %v BPW",
+					resolved.level, resolved.source, resolved.quant.Format, resolved.bpw,
+					test.wantLevel, test.wantSource, test.wantFormat, test.wantBPW)
+			}
+			if (len(resolved.warnings) > 0) != test.wantWarn {
+				t.Errorf("resolveQuant warnings = %v, want warning %v", resolved.warnings, test.wantWarn)
+			}
+		})
+	}
+}
+
+func TestResolveQuantUnknownSpecified(t *testing.T) {
+	if _, err := resolveQuant(ModelConfig{}, "Q9_Z", "", 0, nil); err == nil {
+		t.Error("resolveQuant(Q9_Z) returned no error, want an unknown quant error")
+	}
+}
+
+func TestExLlamaHeadBits(t *testing.T) {
+	tests := []struct {
+		name         string
+		quant        QuantType
+		bpw          float64
+		kvCacheQuant KVCacheQuantisation
+		wantHead     float64
+		wantKVCache  float64
+	}{
+		{"exl2 default", QuantType{Format: QuantFormatEXL2}, 4.65, KVCacheFP16, 6, 16},
+		// GGUF would keep a 3 BPW model's head at 6 bits
+		{"exl2 8-bit head", QuantType{Format: QuantFormatEXL2, HeadBits: 8}, 3, KVCacheQ6, 8, 6},
+		// and an 8 BPW model's at 8 bits
+		{"exl3 6-bit head", QuantType{Format: QuantFormatEXL3, HeadBits: 6}, 8, KVCacheQ4, 6, 4},
+		{"exl3 low bpw", QuantType{Format: QuantFormatEXL3}, 1.5, KVCacheQ8, 6, 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.quant.BPWValues(test.bpw, test.kvCacheQuant)
+			// ExLlama keeps the token embeddings unquantised in system RAM
+			if got.BPW != test.bpw || got.LMHeadBPW != test.wantHead || got.EmbeddingBPW != 16 || got.GPUEmbedding || got.KVCacheBPW != test.wantKVCache {
+				t.Errorf("BPWValues(%v, %s) = %+v, want %v BPW, a %v BPW head, 16 BPW embeddings in RAM and a %v BPW KV cache",
+					test.bpw, test.kvCacheQuant, got, test.bpw, test.wantHead, test.wantKVCache)
+			}
+		})
+	}
+}
+
+func TestExLlamaHeadBitsWeights(t *testing.T) {
+	head6 := CalculateWeights(llama8B, QuantType{Format: QuantFormatEXL2}.BPWValues(4, KVCacheFP16))
+	head8 := CalculateWeights(llama8B, QuantType{Format: QuantFormatEXL2, HeadBits: 8}.BPWValues(4, KVCacheFP16))
+
+	// The 128256 x 4096 output head grows by 2 bits per weight
+	want := 128256 * 4096 * 2.0 / 8 / (1 << 30)
+	if diff := head8.Output - head6.Output; math.Abs(diff-want) > 1e-12 {
+		t.Errorf("8-bit head adds %v GB, want %v GB", diff, want)
+	}
+	if head8.Layers != head6.Layers || head8.TokenEmbedding != head6.TokenEmbedding {
+		t.Errorf("head bits changed the layers or embedding: %+v and %+v", head6, head8)
+	}
+}
+
+func TestExLlamaInvalidHeadBits(t *testing.T) {
+	for _, format := range []QuantFormat{QuantFormatEXL2, QuantFormatEXL3} {
+		if _, err := resolveQuant(ModelConfig{}, "4.0", string(format), 7, nil); err == nil {
+			t.Errorf("resolveQuant(%s, 7 head bits) returned no error", format)
+		}
+		if _, err := resolveQuant(ModelConfig{}, "4.0", string(format), 8, nil); err != nil {
+			t.Errorf("resolveQuant(%s, 8 head bits) returned error: %v", format, err)
+		}
+	}
+}
+
+func TestParseWeightQuant(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantFormat QuantFormat
+		wantBPW    float64
+	}{
+		// A 16-bit scale and a packed zero point per group of 128
+		{"awq-4bit-g128", QuantFormatAWQ, 4 + 20.0/128},
+		{"AWQ-4bit", QuantFormatAWQ, 4 + 20.0/128},
+		{"gptq-int4-g32", QuantFormatGPTQ, 4 + 20.0/32},
+		{"gptq_8bit_64g", QuantFormatGPTQ, 8 + 24.0/64},
+		{"gptq-3bit", QuantFormatGPTQ, 3 + 19.0/128},
+		// Per channel quantisation has no group overhead to speak of
+		{"gptq-4bit-g-1", QuantFormatGPTQ, 4},
+		// A 32-bit absmax per block of 64 weights
+		{"bnb-nf4", QuantFormatBNB, 4.5},
+		{"fp4", QuantFormatBNB, 4.5},
+		// Double quant stores each absmax in 8 bits with a 32-bit scale per 256 blocks
+		{"bnb-nf4-dq", QuantFormatBNB, 4 + 8.0/64 + 32.0/(64*256)},
+		{"llm.int8", QuantFormatBNB, 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quantType, bpw, err := ParseWeightQuant(test.name)
+			if err != nil {
+				t.Fatalf("ParseWeightQuant(%q) returned error: %v", test.name, err)
+			}
+			if quantType.Format != test.wantFormat || bpw != test.wantBPW {
+				t.Errorf("ParseWeightQuant(%q) = %s at %v BPW, want %s at %v BPW", test.name, quantType.Format, bpw, test.wantFormat, test.wantBPW)
+			}
+		})
+	}
+}
+
+func TestParseWeightQuantInvalid(t *testing.T) {
+	for _, name := range []string{"awq-4bit-g0", "bnb-int8-dq", "awq-5bit", "Q4_K_M"} {
+		if _, _, err := ParseWeightQuant(name); err == nil {
+			t.Errorf("ParseWeightQuant(%q) returned no error", name)
+		}
+	}
+}
+
+func TestWeightQuantBPWValues(t *testing.T) {
+	for _, format := range []QuantFormat{QuantFormatAWQ, QuantFormatGPTQ, QuantFormatBNB} {
+		t.Run(string(format), func(t *testing.T) {
+			// vLLM keeps the embedding and output head unquantised on the GPU
+			got := QuantType{Format: format}.BPWValues(4.15625, KVCacheFP16)
+			if got.BPW != 4.15625 || got.LMHeadBPW != 16 || got.EmbeddingBPW != 16 || !got.GPUEmbedding {
+				t.Errorf("BPWValues = %+v, want 4.15625 BPW layers with a 16 BPW head and embedding on the GPU", got)
+			}
+
+			weights := CalculateWeights(llama8B, got)
+			want := 2 * 128256 * 4096 * 2.0 / (1 << 30)
+			if weights.TokenEmbedding != 0 || math.Abs(weights.Output-want) > 1e-12 {
+				t.Errorf("CalculateWeights = %+v, want the embedding and head's %v GB on the GPU", weights, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,607 @@
+// File: quantest/recipe.go
+
+package quantest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// qkK is the k-quant super-block size, rows that aren't a multiple of it fall back to legacy quants.
+const qkK = 256
+
+// ggmlTypeBPW maps ggml tensor types to their bits per weight, including block scales
+var ggmlTypeBPW = map[string]float64{
+	"F64":      64,
+	"F32":      32,
+	"I32":      32,
+	"F16":      16,
+	"BF16":     16,
+	"I16":      16,
+	"I8":       8,
+	"Q8_0":     8.5,
+	"Q6_K":     6.5625,
+	"Q5_1":     6,
+	"Q5_0":     5.5,
+	"Q5_K":     5.5,
+	"Q4_1":     5,
+	"Q4_0":     4.5,
+	"Q4_K":     4.5,
+	"Q4_0_4_4": 4.5,
+	"Q4_0_4_8": 4.5,
+	"Q4_0_8_8": 4.5,
+	"IQ4_NL":   4.5,
+	"IQ4_XS":   4.25,
+	"MXFP4":    4.25,
+	"Q3_K":     3.4375,
+	"IQ3_S":    3.4375,
+	"IQ3_XXS":  3.0625,
+	"Q2_K":     2.625,
+	"IQ2_S":    2.5625,
+	"IQ2_XS":   2.3125,
+	"IQ2_XXS":  2.0625,
+	"TQ2_0":    2.0625,
+	"IQ1_M":    1.75,
+	"TQ1_0":    1.6875,
+	"IQ1_S":    1.5625,
+}
+
+// ggufRecipe is how llama-quantize makes a quant: the file type it's run
+// with, that type's default tensor type, and any tensor type overrides
+type ggufRecipe struct {
+	ftype         string
+	defaultType   string
+	embeddingType string
+	outputType    string
+	tensorTypes   []tensorTypeOverride
+}
+
+// tensorTypeOverride is a llama-quantize --tensor-type override
+type tensorTypeOverride struct {
+	pattern  *regexp.Regexp
+	ggmlType string
+}
+
+// ggufFileTypes maps llama-quantize's file types to the ggml type most of their tensors get
+var ggufFileTypes = map[string]string{
+	"F32":      "F32",
+	"F16":      "F16",
+	"BF16":     "BF16",
+	"Q8_0":     "Q8_0",
+	"Q6_K":     "Q6_K",
+	"Q5_K_M":   "Q5_K",
+	"Q5_K_S":   "Q5_K",
+	"Q5_1":     "Q5_1",
+	"Q5_0":     "Q5_0",
+	"Q4_K_M":   "Q4_K",
+	"Q4_K_S":   "Q4_K",
+	"Q4_1":     "Q4_1",
+	"Q4_0":     "Q4_0",
+	"Q4_0_4_4": "Q4_0_4_4",
+	"Q4_0_4_8": "Q4_0_4_8",
+	"Q4_0_8_8": "Q4_0_8_8",
+	"IQ4_NL":   "IQ4_NL",
+	"IQ4_XS":   "IQ4_XS",
+	"Q3_K_L":   "Q3_K",
+	"Q3_K_M":   "Q3_K",
+	"Q3_K_S":   "Q3_K",
+	"IQ3_M":    "IQ3_S",
+	"IQ3_S":    "IQ3_S",
+	"IQ3_XS":   "IQ3_S",
+	"IQ3_XXS":  "IQ3_XXS",
+	"Q2_K":     "Q2_K",
+	"Q2_K_S":   "Q2_K",
+	"IQ2_M":    "IQ2_S",
+	"IQ2_S":    "IQ2_XS",
+	"IQ2_XS":   "IQ2_XS",
+	"IQ2_XXS":  "IQ2_XXS",
+	"TQ2_0":    "TQ2_0",
+	"TQ1_0":    "TQ1_0",
+	"IQ1_M":    "IQ1_M",
+	"IQ1_S":    "IQ1_S",
+}
+
+// recipeModel holds the model properties llama-quantize's rules depend on
+type recipeModel struct {
+	layers     int
+	gqa        int
+	experts    int
+	is70B      bool
+	hasOutput  bool
+	hasImatrix bool
+}
+
+// recipeWeights holds a model's weights under a quant recipe, in GB
+type recipeWeights struct {
+	breakdown WeightBreakdown
+	layers    []float64
+}
+
+// TensorTypes returns the ggml type llama-quantize gives each of a model's tensors for a GGUF quant
+//
+// The tensors are the model's own when Ollama lists them, otherwise they're
+// built from the config. The rules follow llama.cpp's llama_tensor_get_type,
+// e.g. Q4_K_M keeps the output head, and attn_v and ffn_down in half of the
+// layers, at Q6_K.
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - quant: The GGUF quant, e.g. Q4_K_M.
+//
+// Returns:
+//   - map[string]string: The ggml type of each tensor by name.
+//   - error: An error if the quant has no known recipe.
+//
+// Example:
+//
+//	types, err := TensorTypes(config, "Q4_K_M")
+//	fmt.Println(types["blk.0.attn_v.weight"]) // Q6_K
+func TensorTypes(config ModelConfig, quant string) (map[string]string, error) {
+	return defaultRegistry.TensorTypes(config, quant)
+}
+
+// TensorTypes returns the ggml type llama-quantize gives each of a model's
+// tensors for a quant in the registry, see TensorTypes
+func (r *Registry) TensorTypes(config ModelConfig, quant string) (map[string]string, error) {
+	spec, _ := r.Lookup(quant)
+	recipe, err := r.recipe(quant)
+	if err != nil {
+		return nil, err
+	}
+
+	tensors := config.ggufTensors()
+	model := config.recipeModel(tensors, spec)
+	types := make(map[string]string, len(tensors))
+	for _, tensor := range tensors {
+		types[tensor.Name] = recipe.tensorType(tensor, model)
+	}
+	return types, nil
+}
+
+// recipe returns how llama-quantize makes a quant, from its recipe or as a plain file type
+func (r *Registry) recipe(quant string) (ggufRecipe, error) {
+	spec, ok := r.Lookup(quant)
+	if !ok {
+		spec.Name = strings.ToUpper(quant)
+	}
+	if spec.Recipe == nil {
+		defaultType, ok := ggufFileTypes[spec.Name]
+		if !ok {
+			return ggufRecipe{}, fmt.Errorf("no llama-quantize recipe for %s", quant)
+		}
+		return ggufRecipe{ftype: spec.Name, defaultType: defaultType}, nil
+	}
+	return spec.Recipe.parse()
+}
+
+// parse checks a recipe's types and patterns against llama-quantize's
+func (q QuantRecipe) parse() (ggufRecipe, error) {
+	ftype := strings.ToUpper(q.Base)
+	defaultType, ok := ggufFileTypes[ftype]
+	if !ok {
+		return ggufRecipe{}, fmt.Errorf("unknown llama-quantize base type %q", q.Base)
+	}
+	recipe := ggufRecipe{ftype: ftype, defaultType: defaultType}
+
+	var err error
+	if recipe.embeddingType, err = parseGGMLType(q.TokenEmbeddingType); err != nil {
+		return ggufRecipe{}, err
+	}
+	if recipe.outputType, err = parseGGMLType(q.OutputType); err != nil {
+		return ggufRecipe{}, err
+	}
+
+	for _, override := range q.TensorTypes {
+		pattern, ggmlType, ok := strings.Cut(override, "=")
+		if !ok || strings.TrimSpace(ggmlType) == "" {
+			return ggufRecipe{}, fmt.Errorf("invalid tensor type %q, expected pattern=type", override)
+		}
+		ggmlType, err := parseGGMLType(ggmlType)
+		if err != nil {
+			return ggufRecipe{}, fmt.Errorf("invalid tensor type %q: %w", override, err)
+		}
+		compiled, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return ggufRecipe{}, fmt.Errorf("invalid tensor type pattern %q: %w", pattern, err)
+		}
+		recipe.tensorTypes = append(recipe.tensorTypes, tensorTypeOverride{pattern: compiled, ggmlType: ggmlType})
+	}
+	return recipe, nil
+}
+
+// recipeWeights sizes the model's weights under a GGUF quant's recipe from the
+// registry, or DefaultRegistry when nil. The installed quant of an Ollama
+// model is sized from its actual tensor types.
+func (c ModelConfig) recipeWeights(registry *Registry, quant string) (recipeWeights, bool) {
+	if quant == "" {
+		return recipeWeights{}, false
+	}
+	registry = registryOrDefault(registry)
+
+	tensors := c.ggufTensors()
+	actual := len(c.Tensors) > 0 && strings.EqualFold(quant, c.QuantLevel)
+	types := make(map[string]string, len(tensors))
+	if actual {
+		for _, tensor := range tensors {
+			types[tensor.Name] = strings.ToUpper(tensor.Type)
+		}
+	} else {
+		var err error
+		if types, err = registry.TensorTypes(c, quant); err != nil {
+			return recipeWeights{}, false
+		}
+	}
+
+	numLayers := len(c.LayerConfigs())
+	weights := recipeWeights{layers: make([]float64, numLayers)}
+	shapeParams := make([]float64, numLayers)
+	var tokenEmbedding, output float64
+	for _, tensor := range tensors {
+		bpw, ok := ggmlTypeBPW[types[tensor.Name]]
+		if !ok {
+			return recipeWeights{}, false
+		}
+		bytes := tensorParams(tensor) * bpw / 8
+
+		switch block := tensorBlock(tensor.Name); {
+		case tensor.Name == "token_embd.weight":
+			tokenEmbedding = bytes
+		case tensor.Name == "output.weight":
+			output = bytes
+		case block >= 0 && block < numLayers:
+			weights.layers[block] += bytes
+			shapeParams[block] += tensorParams(tensor)
+		}
+	}
+
+	// Llama.cpp uses the token embedding as the output head of tied models
+	if !slices.ContainsFunc(tensors, func(t OllamaTensor) bool { return t.Name == "output.weight" }) {
+		output = tokenEmbedding
+	}
+
+	// Shapes built from the config are scaled to the layers' known parameter counts
+	if !actual && len(c.Tensors) == 0 {
+		params := c.layerParamsPerLayer()
+		for i := range weights.layers {
+			if shapeParams[i] > 0 {
+				weights.layers[i] *= params[i] / shapeParams[i]
+			}
+		}
+	}
+
+	var layers float64
+	for i := range weights.layers {
+		weights.layers[i] = bitsToGB(weights.layers[i])
+		layers += weights.layers[i]
+	}
+	weights.breakdown = WeightBreakdown{
+		TokenEmbedding: bitsToGB(tokenEmbedding),
+		Output:         bitsToGB(output),
+		Layers:         layers,
+	}
+	return weights, true
+}
+
+// ggufTensors returns the model's GGUF tensors, from Ollama when listed or
+// built from the config with llama.cpp's names and shapes
+func (c ModelConfig) ggufTensors() []OllamaTensor {
+	if len(c.Tensors) > 0 {
+		return c.Tensors
+	}
+
+	hidden := uint64(c.HiddenSize)
+	embedding := uint64(c.embeddingParams()) / max(hidden, 1)
+	tensors := []OllamaTensor{{Name: "token_embd.weight", Shape: []uint64{hidden, embedding}}}
+
+	names := map[string]string{
+		"q_proj": "attn_q", "k_proj": "attn_k", "v_proj": "attn_v", "o_proj": "attn_output",
+		"gate_proj": "ffn_gate", "up_proj": "ffn_up", "down_proj": "ffn_down",
+		"linear_attn": "attn_linear", "linear_mlp": "ffn_linear",
+	}
+	for i, layer := range c.LayerConfigs() {
+		prefix := fmt.Sprintf("blk.%d.", i)
+		tensors = append(tensors,
+			OllamaTensor{Name: prefix + "attn_norm.weight", Shape: []uint64{hidden}},
+			OllamaTensor{Name: prefix + "ffn_norm.weight", Shape: []uint64{hidden}},
+		)
+		for _, module := range c.linearModules(layer) {
+			tensors = append(tensors, OllamaTensor{
+				Name:  prefix + names[module.name] + ".weight",
+				Shape: []uint64{uint64(module.in), uint64(module.out)},
+			})
+		}
+	}
+
+	if !c.TieWordEmbeddings {
+		tensors = append(tensors, OllamaTensor{Name: "output.weight", Shape: []uint64{hidden, uint64(c.outputParams()) / max(hidden, 1)}})
+	}
+	return tensors
+}
+
+// parseGGMLType normalises a ggml type name, leaving an empty one empty
+func parseGGMLType(name string) (string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if _, ok := ggmlTypeBPW[name]; !ok && name != "" {
+		return "", fmt.Errorf("unknown ggml type %q", name)
+	}
+	return name, nil
+}
+
+// recipeModel collects the properties llama-quantize's rules look at
+func (c ModelConfig) recipeModel(tensors []OllamaTensor, spec QuantSpec) recipeModel {
+	model := recipeModel{
+		layers:     len(c.LayerConfigs()),
+		gqa:        c.NumAttentionHeads / max(c.kvHeads(), 1),
+		is70B:      c.NumHiddenLayers == 80 && c.HiddenSize == 8192,
+		hasImatrix: spec.Imatrix != ImatrixNone,
+	}
+	for _, tensor := range tensors {
+		if tensor.Name == "output.weight" {
+			model.hasOutput = true
+		}
+		if strings.Contains(tensor.Name, "_exps.") && len(tensor.Shape) == 3 {
+			model.experts = int(tensor.Shape[2])
+		}
+	}
+	return model
+}
+
+// tensorType returns the ggml type a tensor is quantised to, applying the
+// recipe's overrides after llama-quantize's own rules as llama-quantize does
+func (r ggufRecipe) tensorType(tensor OllamaTensor, model recipeModel) string {
+	// Norms, biases and MoE routers are kept at full precision
+	if len(tensor.Shape) < 2 || strings.Contains(tensor.Name, "ffn_gate_inp") {
+		return "F32"
+	}
+
+	newType := r.defaultType
+	if r.defaultType != "F32" && r.defaultType != "F16" && r.defaultType != "BF16" {
+		newType = r.ruleType(tensor, model)
+	}
+
+	switch {
+	case r.embeddingType != "" && tensor.Name == "token_embd.weight":
+		newType = r.embeddingType
+	case r.outputType != "" && tensor.Name == "output.weight":
+		newType = r.outputType
+	}
+	for _, override := range r.tensorTypes {
+		if override.pattern.MatchString(tensor.Name) {
+			return override.ggmlType
+		}
+	}
+	return newType
+}
+
+// ruleType returns the ggml type llama-quantize picks for a tensor, following llama.cpp's llama_tensor_get_type
+func (r ggufRecipe) ruleType(tensor OllamaTensor, model recipeModel) string {
+	name := tensor.Name
+
+	ftype := r.ftype
+	is := func(ftypes ...string) bool { return slices.Contains(ftypes, ftype) }
+	gqa, experts, block := model.gqa, model.experts, tensorBlock(name)
+	moreBits := useMoreBits(block, model.layers)
+	firstEighth := block < model.layers/8
+
+	newType := r.defaultType
+	switch {
+	case name == "output.weight" || (!model.hasOutput && name == "token_embd.weight"):
+		switch {
+		case tensor.Shape[0]%qkK != 0:
+			newType = "Q8_0"
+		case is("IQ2_XXS", "IQ2_XS", "IQ3_XXS", "IQ1_S", "IQ2_S", "IQ2_M", "IQ1_M"):
+			newType = "Q5_K"
+		case newType != "Q8_0":
+			newType = "Q6_K"
+		}
+
+	case name == "token_embd.weight":
+		switch {
+		case is("IQ2_XXS", "IQ2_XS", "IQ1_S", "IQ1_M"):
+			newType = "Q2_K"
+		case is("IQ2_S", "IQ2_M"):
+			newType = "IQ3_S"
+		case is("TQ1_0", "TQ2_0"):
+			newType = "Q4_K"
+		}
+
+	case is("IQ2_XXS", "IQ2_XS", "IQ1_S", "IQ2_S", "IQ2_M", "IQ1_M"):
+		lowType := "Q2_K"
+		if is("IQ2_S", "IQ2_M") {
+			lowType = "IQ3_S"
+		}
+		switch {
+		case strings.Contains(name, "attn_v.weight"):
+			newType = lowType
+			if gqa >= 4 || experts >= 4 {
+				newType = "Q4_K"
+			}
+		case experts == 8 && strings.Contains(name, "attn_k.weight"):
+			newType = "Q4_K"
+		case strings.Contains(name, "ffn_down"):
+			if firstEighth {
+				newType = lowType
+			}
+		case strings.Contains(name, "attn_output.weight"):
+			switch {
+			case experts == 8:
+				newType = "Q5_K"
+			case is("IQ1_S", "IQ1_M"):
+				newType = "IQ2_XXS"
+			case is("IQ2_S", "IQ2_M"):
+				newType = "IQ3_S"
+			}
+		}
+
+	case strings.Contains(name, "attn_v.weight"):
+		switch {
+		case is("Q2_K"):
+			newType = "Q3_K"
+			if gqa >= 4 {
+				newType = "Q4_K"
+			}
+		case is("Q2_K_S") && gqa >= 4:
+			newType = "Q4_K"
+		case is("IQ3_XXS"):
+			switch {
+			case gqa >= 4:
+				newType = "Q4_K"
+			case !model.hasImatrix:
+				newType = "IQ3_S"
+			}
+		case is("IQ3_XS", "IQ3_S") && gqa >= 4:
+			newType = "Q4_K"
+		case is("IQ3_M"):
+			newType = "Q4_K"
+		case is("Q3_K_M"):
+			newType = "Q4_K"
+			if block < 2 {
+				newType = "Q5_K"
+			}
+		case is("Q3_K_L"):
+			newType = "Q5_K"
+		case is("IQ4_NL", "IQ4_XS") && gqa >= 4:
+			newType = "Q5_K"
+		case is("Q4_K_M", "Q5_K_M") && moreBits:
+			newType = "Q6_K"
+		case is("Q4_K_S") && block < 4:
+			newType = "Q5_K"
+		}
+		// 70B models share each attn_v between 8 heads, so more bits cost little
+		if model.is70B && (newType == "Q3_K" || newType == "Q4_K") {
+			newType = "Q5_K"
+		}
+		if experts == 8 {
+			newType = "Q8_0"
+		}
+
+	case strings.Contains(name, "attn_k.weight"):
+		switch {
+		case experts == 8:
+			newType = "Q8_0"
+		case is("IQ3_XS"):
+			newType = "IQ3_XXS"
+		case is("IQ3_XXS"):
+			newType = "IQ2_S"
+		}
+
+	case strings.Contains(name, "attn_q.weight"):
+		switch {
+		case is("IQ3_XS"):
+			newType = "IQ3_XXS"
+		case is("IQ3_XXS"):
+			newType = "IQ2_S"
+		}
+
+	case strings.Contains(name, "ffn_down"):
+		switch {
+		case is("Q2_K"):
+			newType = "Q3_K"
+		case is("Q2_K_S"):
+			if firstEighth {
+				newType = "Q4_K"
+			}
+		case is("IQ3_XXS") && !model.hasImatrix:
+			newType = "Q3_K"
+			if firstEighth {
+				newType = "Q4_K"
+			}
+		case is("Q3_K_M"):
+			newType = "Q4_K"
+			if block < model.layers/16 {
+				newType = "Q5_K"
+			}
+		case is("IQ3_M") && (firstEighth || (experts == 8 && moreBits)):
+			newType = "Q4_K"
+		case is("Q3_K_L"):
+			newType = "Q5_K"
+		case is("Q4_K_M"):
+			if moreBits {
+				newType = "Q6_K"
+			}
+		case firstEighth && is("IQ4_NL", "IQ4_XS") && !model.hasImatrix:
+			newType = "Q5_K"
+		case is("Q5_K_M") && moreBits:
+			newType = "Q6_K"
+		case is("Q4_K_S") && firstEighth:
+			newType = "Q5_K"
+		case is("Q4_0") && model.hasImatrix && firstEighth:
+			newType = "Q4_1"
+		case is("Q5_0") && model.hasImatrix && firstEighth:
+			newType = "Q5_1"
+		}
+
+	case strings.Contains(name, "attn_output.weight"):
+		if experts == 8 {
+			if is("Q2_K", "IQ3_XS", "IQ3_XXS", "Q3_K_S", "Q3_K_M", "IQ4_NL", "Q4_K_S", "Q4_K_M", "IQ3_S", "IQ3_M", "IQ4_XS") {
+				newType = "Q5_K"
+			}
+			break
+		}
+		switch {
+		case is("Q2_K"):
+			newType = "Q3_K"
+		case is("IQ3_XXS"):
+			newType = "IQ3_S"
+		case is("Q3_K_M", "IQ3_M"):
+			newType = "Q4_K"
+		case is("Q3_K_L"):
+			newType = "Q5_K"
+		}
+
+	case strings.Contains(name, "attn_qkv.weight"):
+		switch {
+		case is("Q3_K_M", "Q3_K_L", "IQ3_M"):
+			newType = "Q4_K"
+		case is("Q4_K_M"):
+			newType = "Q5_K"
+		case is("Q5_K_M"):
+			newType = "Q6_K"
+		}
+
+	case strings.Contains(name, "ffn_gate") || strings.Contains(name, "ffn_up"):
+		if is("IQ3_XS") && block >= model.layers/8 && block < 7*model.layers/8 {
+			newType = "IQ3_XXS"
+		}
+	}
+
+	// Rows that don't fill a k-quant super-block fall back to a legacy quant
+	if tensor.Shape[0]%qkK != 0 {
+		switch newType {
+		case "TQ1_0", "TQ2_0":
+			newType = "Q4_0"
+		case "IQ2_XXS", "IQ2_XS", "IQ2_S", "IQ3_XXS", "IQ3_S", "IQ1_S", "IQ1_M", "Q2_K", "Q3_K", "IQ4_XS":
+			newType = "IQ4_NL"
+		case "Q4_K":
+			newType = "Q5_0"
+		case "Q5_K":
+			newType = "Q5_1"
+		case "Q6_K":
+			newType = "Q8_0"
+		}
+	}
+	return newType
+}
+
+// useMoreBits reports whether llama-quantize gives a layer more bits: the
+// first and last eighth of the layers and every third layer between
+func useMoreBits(layer, layers int) bool {
+	return layer < layers/8 || layer >= 7*layers/8 || (layer-layers/8)%3 == 2
+}
+
+// tensorBlock returns the layer a tensor belongs to, or -1 for tensors outside the repeating layers
+func tensorBlock(name string) int {
+	rest, ok := strings.CutPrefix(name, "blk.")
+	if !ok {
+		return -1
+	}
+	index, _, _ := strings.Cut(rest, ".")
+	block, err := strconv.Atoi(index)
+	if err != nil {
+		return -1
+	}
+	return block
+}
@@ -0,0 +1,93 @@
+// File: quantest/recipe_test.go
+
+package quantest
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTensorTypesQ4KM(t *testing.T) {
+	types, err := TensorTypes(llama8B, "Q4_K_M")
+	if err != nil {
+		t.Fatalf("TensorTypes returned error: %v", err)
+	}
+
+	tests := []struct {
+		tensor string
+		want   string
+	}{
+		{"token_embd.weight", "Q4_K"},
+		{"output.weight", "Q6_K"},
+		{"blk.0.attn_norm.weight", "F32"},
+		{"blk.0.attn_q.weight", "Q4_K"},
+		{"blk.0.attn_k.weight", "Q4_K"},
+		{"blk.0.attn_output.weight", "Q4_K"},
+		{"blk.0.ffn_gate.weight", "Q4_K"},
+		{"blk.0.ffn_up.weight", "Q4_K"},
+		// The first and last 4 of 32 layers, and every third layer between, get more bits
+		{"blk.0.attn_v.weight", "Q6_K"},
+		{"blk.3.ffn_down.weight", "Q6_K"},
+		{"blk.4.attn_v.weight", "Q4_K"},
+		{"blk.5.ffn_down.weight", "Q4_K"},
+		{"blk.6.attn_v.weight", "Q6_K"},
+		{"blk.6.ffn_down.weight", "Q6_K"},
+		{"blk.27.attn_v.weight", "Q6_K"},
+		{"blk.28.ffn_down.weight", "Q6_K"},
+	}
+	for _, test := range tests {
+		t.Run(test.tensor, func(t *testing.T) {
+			if got := types[test.tensor]; got != test.want {
+				t.Errorf("TensorTypes(Q4_K_M)[%s] = %s, want %s", test.tensor, got, test.want)
+			}
+		})
+	}
+
+	// Half of the layers keep attn_v and ffn_down at Q6_K
+	var q6k int
+	for i := 0; i < 32; i++ {
+		if types[fmt.Sprintf("blk.%d.attn_v.weight", i)] == "Q6_K" {
+			q6k++
+		}
+	}
+	if q6k != 16 {
+		t.Errorf("TensorTypes(Q4_K_M) has attn_v at Q6_K in %d layers, want 16", q6k)
+	}
+}
+
+func TestTensorTypesRecipes(t *testing.T) {
+	tied := llama8B
+	tied.TieWordEmbeddings = true
+
+	tests := []struct {
+		name   string
+		config ModelConfig
+		quant  string
+		tensor string
+		want   string
+	}{
+		// Q4_K_L is Q4_K_M with Q8_0 embeddings and output head
+		{"Q4_K_L embedding", llama8B, "Q4_K_L", "token_embd.weight", "Q8_0"},
+		{"Q4_K_L output", llama8B, "Q4_K_L", "output.weight", "Q8_0"},
+		{"Q4_K_L layers", llama8B, "Q4_K_L", "blk.0.attn_v.weight", "Q6_K"},
+		// A tied embedding doubles as the output head and is quantised as one
+		{"tied embedding", tied, "Q4_K_M", "token_embd.weight", "Q6_K"},
+		{"IQ2_XXS output", llama8B, "IQ2_XXS", "output.weight", "Q5_K"},
+		{"F16", llama8B, "F16", "blk.0.attn_v.weight", "F16"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			types, err := TensorTypes(test.config, test.quant)
+			if err != nil {
+				t.Fatalf("TensorTypes(%s) returned error: %v", test.quant, err)
+			}
+			if got := types[test.tensor]; got != test.want {
+				t.Errorf("TensorTypes(%s)[%s] = %s, want %s", test.quant, test.tensor, got, test.want)
+			}
+		})
+	}
+
+	if _, err := TensorTypes(llama8B, "mlx-4bit"); err == nil {
+		t.Error("TensorTypes(mlx-4bit) returned no error")
+	}
+}
@@ -0,0 +1,494 @@
+// File: quantest/registry.go
+
+package quantest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// builtinQuants are the GGUF quant types quantest knows, with BPWs measured
+// from llama.cpp's quants of Llama models
+var builtinQuants = []QuantSpec{
+	// Unquantised and FP8 checkpoints, FP8 is scaled per tensor
+	{Name: "F32", Family: QuantFamilyFloat, BPW: 32, BlockSize: 1, CPU: true, GPU: true, Quality: 43, Aliases: []string{"FP32", "FLOAT32"}},
+	{Name: "F16", Family: QuantFamilyFloat, BPW: 16, BlockSize: 1, CPU: true, GPU: true, Quality: 42, Aliases: []string{"FP16", "FLOAT16", "HALF"}},
+	{Name: "BF16", Family: QuantFamilyFloat, BPW: 16, BlockSize: 1, CPU: true, GPU: true, Quality: 42, Aliases: []string{"BFLOAT16"}},
+	{Name: "FP8_E4M3", Family: QuantFamilyFloat, BPW: 8, BlockSize: 1, GPU: true, Quality: 38, Aliases: []string{"FP8"}, Note: "needs Ada, Hopper or newer GPUs"},
+	{Name: "FP8_E5M2", Family: QuantFamilyFloat, BPW: 8, BlockSize: 1, GPU: true, Quality: 37, Note: "needs Ada, Hopper or newer GPUs"},
+
+	// Microscaled FP4, MXFP4 has an E8M0 scale per 32 weights and NVFP4 an E4M3 scale per 16
+	{Name: "MXFP4", Family: QuantFamilyMicroscaled, BPW: 4.25, BlockSize: 32, CPU: true, GPU: true, Quality: 21, Aliases: []string{"MXFP4_MOE"}},
+	{Name: "NVFP4", Family: QuantFamilyMicroscaled, BPW: 4.5, BlockSize: 16, GPU: true, Quality: 22, Note: "needs Blackwell GPUs"},
+
+	{Name: "Q8_0", Family: QuantFamilyLegacy, BPW: 8.5, BlockSize: 32, CPU: true, GPU: true, Quality: 39, Aliases: []string{"Q8", "8BIT"}},
+	{Name: "Q5_1", Family: QuantFamilyLegacy, BPW: 6.04, BlockSize: 32, CPU: true, GPU: true, Quality: 30},
+	{Name: "Q5_0", Family: QuantFamilyLegacy, BPW: 5.54, BlockSize: 32, CPU: true, GPU: true, Quality: 29},
+	{Name: "Q4_1", Family: QuantFamilyLegacy, BPW: 5.05, BlockSize: 32, CPU: true, GPU: true, Quality: 24},
+	{Name: "Q4_0", Family: QuantFamilyLegacy, BPW: 4.55, BlockSize: 32, CPU: true, GPU: true, Quality: 20},
+
+	{Name: "Q6_K_L", Family: QuantFamilyKQuant, BPW: 6.64, BlockSize: 256, CPU: true, GPU: true, Quality: 35, Imatrix: ImatrixRecommended, Note: "Q8_0 embeddings and output head",
+		Recipe: &QuantRecipe{Base: "Q6_K", TokenEmbeddingType: "Q8_0", OutputType: "Q8_0"}},
+	{Name: "Q6_K", Family: QuantFamilyKQuant, BPW: 6.59, BlockSize: 256, CPU: true, GPU: true, Quality: 34, Aliases: []string{"6BIT"}},
+	{Name: "Q5_K_L", Family: QuantFamilyKQuant, BPW: 5.75, BlockSize: 256, CPU: true, GPU: true, Quality: 33, Imatrix: ImatrixRecommended, Note: "Q8_0 embeddings and output head",
+		Recipe: &QuantRecipe{Base: "Q5_K_M", TokenEmbeddingType: "Q8_0", OutputType: "Q8_0"}},
+	{Name: "Q5_K_M", Family: QuantFamilyKQuant, BPW: 5.69, BlockSize: 256, CPU: true, GPU: true, Quality: 31, Aliases: []string{"Q5_K", "5BIT"}},
+	{Name: "Q5_K_S", Family: QuantFamilyKQuant, BPW: 5.54, BlockSize: 256, CPU: true, GPU: true, Quality: 30},
+	{Name: "Q4_K_L", Family: QuantFamilyKQuant, BPW: 4.9, BlockSize: 256, CPU: true, GPU: true, Quality: 28, Imatrix: ImatrixRecommended, Note: "Q8_0 embeddings and output head",
+		Recipe: &QuantRecipe{Base: "Q4_K_M", TokenEmbeddingType: "Q8_0", OutputType: "Q8_0"}},
+	{Name: "Q4_K_M", Family: QuantFamilyKQuant, BPW: 4.85, BlockSize: 256, CPU: true, GPU: true, Quality: 26, Aliases: []string{"Q4_K", "4BIT", "INT4"}},
+	{Name: "Q4_K_S", Family: QuantFamilyKQuant, BPW: 4.58, BlockSize: 256, CPU: true, GPU: true, Quality: 25},
+	{Name: "Q3_K_L", Family: QuantFamilyKQuant, BPW: 4.27, BlockSize: 256, CPU: true, GPU: true, Quality: 18},
+	{Name: "Q3_K_M", Family: QuantFamilyKQuant, BPW: 3.91, BlockSize: 256, CPU: true, GPU: true, Quality: 16, Aliases: []string{"Q3_K", "3BIT"}},
+	{Name: "Q3_K_S", Family: QuantFamilyKQuant, BPW: 3.5, BlockSize: 256, CPU: true, GPU: true, Quality: 13},
+	{Name: "Q2_K", Family: QuantFamilyKQuant, BPW: 3.35, BlockSize: 256, CPU: true, GPU: true, Quality: 9, Aliases: []string{"2BIT"}},
+	{Name: "Q2_K_S", Family: QuantFamilyKQuant, BPW: 3.16, BlockSize: 256, CPU: true, GPU: true, Quality: 7, Imatrix: ImatrixRequired},
+
+	{Name: "IQ4_NL", Family: QuantFamilyIQuant, BPW: 4.5, BlockSize: 32, CPU: true, GPU: true, Quality: 24, Imatrix: ImatrixRecommended},
+	{Name: "IQ4_XS", Family: QuantFamilyIQuant, BPW: 4.25, BlockSize: 256, CPU: true, GPU: true, Quality: 23, Imatrix: ImatrixRecommended},
+	{Name: "IQ3_M", Family: QuantFamilyIQuant, BPW: 3.7, BlockSize: 256, CPU: true, GPU: true, Quality: 17, Imatrix: ImatrixRecommended},
+	{Name: "IQ3_S", Family: QuantFamilyIQuant, BPW: 3.5, BlockSize: 256, CPU: true, GPU: true, Quality: 15, Imatrix: ImatrixRecommended},
+	{Name: "IQ3_XS", Family: QuantFamilyIQuant, BPW: 3.3, BlockSize: 256, CPU: true, GPU: true, Quality: 14, Imatrix: ImatrixRecommended},
+	{Name: "IQ3_XXS", Family: QuantFamilyIQuant, BPW: 3.06, BlockSize: 256, CPU: true, GPU: true, Quality: 12, Imatrix: ImatrixRecommended},
+	{Name: "IQ2_M", Family: QuantFamilyIQuant, BPW: 2.7, BlockSize: 256, CPU: true, GPU: true, Quality: 10, Imatrix: ImatrixRecommended},
+	{Name: "IQ2_S", Family: QuantFamilyIQuant, BPW: 2.5, BlockSize: 256, CPU: true, GPU: true, Quality: 8, Imatrix: ImatrixRequired},
+	{Name: "IQ2_XS", Family: QuantFamilyIQuant, BPW: 2.31, BlockSize: 256, CPU: true, GPU: true, Quality: 6, Imatrix: ImatrixRequired},
+	{Name: "IQ2_XXS", Family: QuantFamilyIQuant, BPW: 2.06, BlockSize: 256, CPU: true, GPU: true, Quality: 5, Imatrix: ImatrixRequired},
+	{Name: "IQ1_M", Family: QuantFamilyIQuant, BPW: 1.75, BlockSize: 256, CPU: true, GPU: true, Quality: 3, Imatrix: ImatrixRequired},
+	{Name: "IQ1_S", Family: QuantFamilyIQuant, BPW: 1.56, BlockSize: 256, CPU: true, GPU: true, Quality: 1, Imatrix: ImatrixRequired},
+
+	{Name: "TQ2_0", Family: QuantFamilyTernary, BPW: 2.06, BlockSize: 256, CPU: true, Quality: 4, Note: "ternary, only for BitNet style models trained for it"},
+	{Name: "TQ1_0", Family: QuantFamilyTernary, BPW: 1.69, BlockSize: 256, CPU: true, Quality: 2, Note: "ternary, only for BitNet style models trained for it"},
+
+	// Q4_0 repacked for ARM CPUs
+	{Name: "Q4_0_4_4", Family: QuantFamilyRepacked, BPW: 4.55, BlockSize: 32, CPU: true, Quality: 20, Note: "ARM NEON, llama.cpp now repacks Q4_0 at load instead"},
+	{Name: "Q4_0_4_8", Family: QuantFamilyRepacked, BPW: 4.55, BlockSize: 32, CPU: true, Quality: 20, Note: "ARM i8mm, llama.cpp now repacks Q4_0 at load instead"},
+	{Name: "Q4_0_8_8", Family: QuantFamilyRepacked, BPW: 4.55, BlockSize: 32, CPU: true, Quality: 20, Note: "ARM SVE, llama.cpp now repacks Q4_0 at load instead"},
+
+	// Unsloth's dynamic quants, typical sizes as the mix varies per model
+	{Name: "UD-Q8_K_XL", Family: QuantFamilyDynamic, BPW: 10.5, BlockSize: 256, CPU: true, GPU: true, Quality: 40, Imatrix: ImatrixRecommended, Aliases: []string{"Q8_K_XL"}},
+	{Name: "UD-Q6_K_XL", Family: QuantFamilyDynamic, BPW: 7.3, BlockSize: 256, CPU: true, GPU: true, Quality: 36, Imatrix: ImatrixRecommended, Aliases: []string{"Q6_K_XL"}},
+	{Name: "UD-Q5_K_XL", Family: QuantFamilyDynamic, BPW: 5.8, BlockSize: 256, CPU: true, GPU: true, Quality: 32, Imatrix: ImatrixRecommended, Aliases: []string{"Q5_K_XL"}},
+	{Name: "UD-Q4_K_XL", Family: QuantFamilyDynamic, BPW: 4.95, BlockSize: 256, CPU: true, GPU: true, Quality: 27, Imatrix: ImatrixRecommended, Aliases: []string{"Q4_K_XL"}},
+	{Name: "UD-Q3_K_XL", Family: QuantFamilyDynamic, BPW: 3.95, BlockSize: 256, CPU: true, GPU: true, Quality: 19, Imatrix: ImatrixRecommended, Aliases: []string{"Q3_K_XL"}},
+	{Name: "UD-Q2_K_XL", Family: QuantFamilyDynamic, BPW: 3.46, BlockSize: 256, CPU: true, GPU: true, Quality: 11, Imatrix: ImatrixRecommended, Aliases: []string{"Q2_K_XL"}},
+}
+
+// quantNameTags are the parts of quant names that don't change the quant, e.g.
+// Q4_K_M-imat, mradermacher's i1-Q4_K_M or a .gguf extension
+var quantNameTags = map[string]bool{
+	"IMAT":    true,
+	"IMATRIX": true,
+	"I1":      true,
+	"GGUF":    true,
+}
+
+// maxQuantCandidates is how many near misses an UnknownQuantError lists
+const maxQuantCandidates = 3
+
+// defaultRegistry holds the built in quant types
+var defaultRegistry = mustRegistry(builtinQuants)
+
+// NewRegistry makes a registry of quant types, ordered by BPW, then quality, then name
+//
+// Names and aliases are matched case-insensitively and must be unique. A
+// quant with a recipe takes its BPW from the recipe's base quant when it has
+// none, so the base must be registered too.
+//
+// Parameters:
+//   - quants: The quant types to register.
+//
+// Returns:
+//   - *Registry: A pointer to the Registry.
+//   - error: An error if a quant is missing its name or BPW, has an invalid recipe, or a name is taken.
+//
+// Example:
+//
+//	registry, err := NewRegistry(QuantSpec{Name: "Q4_K_M", Family: QuantFamilyKQuant, BPW: 4.85, CPU: true, GPU: true})
+func NewRegistry(quants ...QuantSpec) (*Registry, error) {
+	registry := &Registry{}
+	for _, quant := range quants {
+		if quant.Name == "" {
+			return nil, fmt.Errorf("quant type has no name")
+		}
+		if quant.Recipe != nil {
+			if _, err := quant.Recipe.parse(); err != nil {
+				return nil, fmt.Errorf("quant type %s: %w", quant.Name, err)
+			}
+		}
+		switch quant.KVCache {
+		case "", KVCacheFP16, KVCacheQ8_0, KVCacheQ4_0, KVCacheQ8, KVCacheQ6, KVCacheQ4:
+		default:
+			return nil, fmt.Errorf("quant type %s has unknown KV cache quantisation %q", quant.Name, quant.KVCache)
+		}
+		registry.quants = append(registry.quants, quant.clone())
+	}
+	if err := registry.index(); err != nil {
+		return nil, err
+	}
+
+	// Recipes without a BPW or block size of their own are nominally their base quant's
+	for i, quant := range registry.quants {
+		if base, ok := registry.Lookup(quant.recipeBase()); ok {
+			if quant.BPW == 0 {
+				registry.quants[i].BPW = base.BPW
+			}
+			if quant.BlockSize == 0 {
+				registry.quants[i].BlockSize = base.BlockSize
+			}
+		}
+		if registry.quants[i].BPW <= 0 {
+			return nil, fmt.Errorf("quant type %s has no BPW", quant.Name)
+		}
+	}
+
+	slices.SortStableFunc(registry.quants, func(a, b QuantSpec) int {
+		switch {
+		case a.BPW != b.BPW:
+			return cmp.Compare(a.BPW, b.BPW)
+		case a.Quality != b.Quality:
+			return cmp.Compare(a.Quality, b.Quality)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return registry, registry.index()
+}
+
+// With returns a new registry with the quant types added, replacing any of the same name
+//
+// The registry itself is left as it is, so tools can extend DefaultRegistry
+// without changing it for the rest of the process.
+//
+// Example:
+//
+//	registry, err := DefaultRegistry().With(QuantSpec{
+//		Name:   "Q4_K_M-ATTN8",
+//		Family: QuantFamilyKQuant,
+//		Recipe: &QuantRecipe{Base: "Q4_K_M", TensorTypes: []string{"attn_.*=q8_0"}},
+//	})
+func (r *Registry) With(quants ...QuantSpec) (*Registry, error) {
+	replaced := make(map[string]bool, len(quants))
+	for _, quant := range quants {
+		replaced[strings.ToUpper(quant.Name)] = true
+	}
+
+	var combined []QuantSpec
+	for _, quant := range r.quants {
+		if !replaced[strings.ToUpper(quant.Name)] {
+			combined = append(combined, quant)
+		}
+	}
+	return NewRegistry(append(combined, quants...)...)
+}
+
+// LoadQuants reads user-defined quant types from a JSON file
+//
+// The file is JSON only, YAML isn't supported. It holds a list of quant types,
+// or an object with a quants list. Each quant needs a name and a BPW or
+// recipe, quants that don't say where they run are taken to run on both CPU
+// and GPU.
+//
+// Parameters:
+//   - path: The path to the JSON file.
+//
+// Returns:
+//   - []QuantSpec: The quant types, to register with NewRegistry or Registry.With.
+//   - error: An error if the file can't be read or parsed.
+//
+// Example:
+//
+//	quants, err := LoadQuants("quants.json")
+//	registry, err := DefaultRegistry().With(quants...)
+//
+// Where quants.json is e.g.:
+//
+//	[{"name": "Q4_K_M-ATTN8", "family": "k-quant", "recipe": {"base": "Q4_K_M", "tensor_types": ["attn_.*=q8_0"]}, "kv_cache": "q8_0"}]
+func LoadQuants(path string) ([]QuantSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading quant types: %w", err)
+	}
+
+	// Decode the shape the file starts with, so errors are about its fields
+	var quants []QuantSpec
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &quants)
+	} else {
+		var wrapped struct {
+			Quants []QuantSpec `json:"quants"`
+		}
+		err = json.Unmarshal(data, &wrapped)
+		quants = wrapped.Quants
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing quant types: %w", err)
+	}
+
+	for i := range quants {
+		if !quants[i].CPU && !quants[i].GPU {
+			quants[i].CPU, quants[i].GPU = true, true
+		}
+	}
+	return quants, nil
+}
+
+// DefaultRegistry returns the registry of quant types quantest ships with
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Lookup returns the quant type with the given name or alias
+//
+// Example:
+//
+//	quant, ok := DefaultRegistry().Lookup("q4_k") // Q4_K_M
+func (r *Registry) Lookup(name string) (QuantSpec, bool) {
+	index, ok := r.names[strings.ToUpper(strings.TrimSpace(name))]
+	if !ok {
+		return QuantSpec{}, false
+	}
+	return r.quant(index), true
+}
+
+// Resolve returns the quant type a name refers to, forgiving of how it's spelt
+//
+// Besides exact names and aliases, names are matched without case or
+// separators (q4km, IQ4XS), without imatrix tags (Q4_K_M-imat, i1-Q4_K_M) and
+// from within Ollama tags and filenames (8b-instruct-q6_K). Generic names such
+// as fp16, bf16, fp8, 4bit and int4 are aliases of their usual GGUF quants.
+//
+// Returns:
+//   - QuantSpec: The quant type.
+//   - error: An *UnknownQuantError listing the closest quant types when nothing matches.
+//
+// Example:
+//
+//	quant, err := DefaultRegistry().Resolve("llama3.1:8b-instruct-q4km") // Q4_K_M
+//	var unknown *UnknownQuantError
+//	if errors.As(err, &unknown) {
+//		fmt.Println(unknown.Candidates)
+//	}
+func (r *Registry) Resolve(name string) (QuantSpec, error) {
+	if quant, ok := r.Lookup(name); ok {
+		return quant, nil
+	}
+
+	// Try each of the name's parts, the last first as tags and filenames end
+	// with the quant. Only single parts are matched without separators, so
+	// sizes and suffixes such as 4b-it don't read as 4BIT.
+	parts := quantNameParts(name)
+	for i := len(parts) - 1; i >= 0; i-- {
+		if quant, ok := r.Lookup(parts[i]); ok {
+			return quant, nil
+		}
+		if index, ok := r.compact[compactQuantName(parts[i])]; ok {
+			return r.quant(index), nil
+		}
+	}
+
+	// Then runs of parts that make up a name with separators, e.g. UD-Q4_K_XL
+	for length := len(parts); length > 1; length-- {
+		for start := len(parts) - length; start >= 0; start-- {
+			if quant, ok := r.Lookup(strings.Join(parts[start:start+length], "-")); ok {
+				return quant, nil
+			}
+		}
+	}
+
+	return QuantSpec{}, &UnknownQuantError{Name: name, Candidates: r.closest(parts, maxQuantCandidates)}
+}
+
+// closest returns the names of the quant types closest to any of the parts of a name
+func (r *Registry) closest(parts []string, limit int) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for _, quant := range r.quants {
+		compact := compactQuantName(quant.Name)
+		distance := len(compact)
+		for _, part := range parts {
+			distance = min(distance, levenshteinDistance(compactQuantName(part), compact))
+		}
+		// Anything that needs more than half the name changed isn't a near miss
+		if distance*2 <= len(compact) {
+			candidates = append(candidates, candidate{quant.Name, distance})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return cmp.Compare(a.distance, b.distance) })
+	var names []string
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// Error lists the closest quant types, if any
+func (e *UnknownQuantError) Error() string {
+	switch len(e.Candidates) {
+	case 0:
+		return fmt.Sprintf("invalid quantisation or BPW value: %s", e.Name)
+	case 1:
+		return fmt.Sprintf("unknown quantisation type %s, did you mean %s?", e.Name, e.Candidates[0])
+	}
+	last := len(e.Candidates) - 1
+	return fmt.Sprintf("unknown quantisation type %s, did you mean %s or %s?", e.Name, strings.Join(e.Candidates[:last], ", "), e.Candidates[last])
+}
+
+// Quants returns the registry's quant types from the lowest BPW to the highest
+func (r *Registry) Quants() []QuantSpec {
+	quants := make([]QuantSpec, len(r.quants))
+	for i := range r.quants {
+		quants[i] = r.quant(i)
+	}
+	return quants
+}
+
+// quant returns a copy of a quant type, so the registry can't be changed through it
+func (r *Registry) quant(index int) QuantSpec {
+	return r.quants[index].clone()
+}
+
+// index maps the registry's names and aliases to its quant types
+func (r *Registry) index() error {
+	r.names = make(map[string]int, len(r.quants))
+	r.compact = make(map[string]int, len(r.quants))
+	ambiguous := make(map[string]bool)
+	for i, quant := range r.quants {
+		for _, name := range append([]string{quant.Name}, quant.Aliases...) {
+			key := strings.ToUpper(name)
+			if other, ok := r.names[key]; ok {
+				return fmt.Errorf("quant type %s's name %s is already used by %s", quant.Name, name, r.quants[other].Name)
+			}
+			r.names[key] = i
+
+			// Compact names that two quants share match neither
+			compact := compactQuantName(name)
+			if other, ok := r.compact[compact]; ok && other != i {
+				ambiguous[compact] = true
+			}
+			r.compact[compact] = i
+		}
+	}
+	for compact := range ambiguous {
+		delete(r.compact, compact)
+	}
+	return nil
+}
+
+// quantNameParts splits a quant name, tag or filename into its parts,
+// dropping tags that don't change the quant such as imatrix and gguf
+func quantNameParts(name string) []string {
+	fields := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return r == '-' || r == ':' || r == '.' || r == '/' || r == ' '
+	})
+	var parts []string
+	for _, field := range fields {
+		if !quantNameTags[field] {
+			parts = append(parts, field)
+		}
+	}
+	return parts
+}
+
+// compactQuantName returns a name upper-cased without separators, e.g. Q4KM for q4_k_m
+func compactQuantName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == '.' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(name))
+}
+
+// recipeBase returns the quant type's recipe's base, or an empty string without one
+func (q QuantSpec) recipeBase() string {
+	if q.Recipe == nil {
+		return ""
+	}
+	return q.Recipe.Base
+}
+
+// clone copies a quant type's aliases and recipe
+func (q QuantSpec) clone() QuantSpec {
+	q.Aliases = slices.Clone(q.Aliases)
+	if q.Recipe != nil {
+		recipe := *q.Recipe
+		recipe.TensorTypes = slices.Clone(recipe.TensorTypes)
+		q.Recipe = &recipe
+	}
+	return q
+}
+
+// standardFamily reports whether llama-quantize makes the family's quants from any
+// model, unlike float, microscaled, ternary, repacked and dynamic quants, which
+// need particular weights, kernels or another publisher's files
+func standardFamily(family QuantFamily) bool {
+	switch family {
+	case QuantFamilyFloat, QuantFamilyMicroscaled, QuantFamilyTernary, QuantFamilyRepacked, QuantFamilyDynamic:
+		return false
+	}
+	return true
+}
+
+// registryOrDefault returns the registry, or DefaultRegistry when nil
+func registryOrDefault(registry *Registry) *Registry {
+	if registry == nil {
+		return defaultRegistry
+	}
+	return registry
+}
+
+// ResolveQuant returns the built in GGUF quant type a name refers to, see Registry.Resolve
+func ResolveQuant(name string) (QuantSpec, error) {
+	return defaultRegistry.Resolve(name)
+}
+
+// LookupQuant returns a built in GGUF quant type by name or alias
+//
+// Example:
+//
+//	quant, ok := LookupQuant("IQ2_XS")
+//	fmt.Println(quant.Imatrix) // required
+func LookupQuant(name string) (QuantSpec, bool) {
+	return defaultRegistry.Lookup(name)
+}
+
+// mustRegistry makes a registry from quant types known to be valid
+func mustRegistry(quants []QuantSpec) *Registry {
+	registry, err := NewRegistry(quants...)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Description explains how quants of the family store their weights
+func (f QuantFamily) Description() string {
+	switch f {
+	case QuantFamilyFloat:
+		return "unquantised floats, or FP8 with a single scale per tensor"
+	case QuantFamilyMicroscaled:
+		return "4-bit floats sharing a scale per small block, with hardware support on recent GPUs"
+	case QuantFamilyLegacy:
+		return "llama.cpp's original quants, a scale (and for _1 types an offset) per block of 32 weights"
+	case QuantFamilyKQuant:
+		return "mixes of k-quant types in super-blocks of 256 weights, with more bits where llama-quantize finds it matters"
+	case QuantFamilyIQuant:
+		return "lattice codebook quants, best at low BPW and with an importance matrix, slower on CPU"
+	case QuantFamilyTernary:
+		return "ternary weights for models trained with them, such as BitNet"
+	case QuantFamilyRepacked:
+		return "Q4_0 with its blocks interleaved for ARM CPU kernels"
+	case QuantFamilyDynamic:
+		return "per model mixes that keep sensitive layers at higher bits, sizes vary by model"
+	}
+	return ""
+}
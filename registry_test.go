@@ -0,0 +1,209 @@
+// File: quantest/registry_test.go
+
+package quantest
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Q4_K_M", "Q4_K_M"},
+		{"q4km", "Q4_K_M"},
+		{"q4_k_m", "Q4_K_M"},
+		{"Q4_K_M-imat", "Q4_K_M"},
+		{"i1-Q5_K_S", "Q5_K_S"},
+		{"4bit", "Q4_K_M"},
+		{"int4", "Q4_K_M"},
+		{"fp8", "FP8_E4M3"},
+		{"fp16", "F16"},
+		{"bf16", "BF16"},
+		{"IQ4XS", "IQ4_XS"},
+		{"instruct-q6_K", "Q6_K"},
+		{"llama3.1:8b-instruct-q4km", "Q4_K_M"},
+		{"Llama-3.1-8B-Instruct-Q5_K_M.gguf", "Q5_K_M"},
+		{"Llama-3.1-8B-Instruct-UD-Q4_K_XL.gguf", "UD-Q4_K_XL"},
+		{"Llama-3.1-8B-Instruct-IQ4_XS-00001-of-00002.gguf", "IQ4_XS"},
+		{"4b-it-q8_0", "Q8_0"},
+		{"gemma3:4b-it-q8_0", "Q8_0"},
+		{"google_gemma-3-4b-it-Q8_0.gguf", "Q8_0"},
+		{"2b-it-q4_K_M", "Q4_K_M"},
+		{"8b-it-fp16", "F16"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quant, err := ResolveQuant(test.name)
+			if err != nil {
+				t.Fatalf("ResolveQuant(%q) returned error: %v", test.name, err)
+			}
+			if quant.Name != test.want {
+				t.Errorf("ResolveQuant(%q) = %s, want %s", test.name, quant.Name, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveUnknown(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+	}{
+		{"q4kx", []string{"Q4_K_S", "Q4_K_M", "Q4_K_L"}},
+		{"banana", nil},
+		{"4b-it", nil},
+		{"2b-it", nil},
+		{"8b-it", nil},
+		{"gemma-2-2b-it", nil},
+		{"gemma3:latest", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quant, err := ResolveQuant(test.name)
+			var unknown *UnknownQuantError
+			if !errors.As(err, &unknown) {
+				t.Fatalf("ResolveQuant(%q) = %s, %v, want an UnknownQuantError", test.name, quant.Name, err)
+			}
+			if !slices.Equal(unknown.Candidates, test.candidates) {
+				t.Errorf("ResolveQuant(%q) candidates = %v, want %v", test.name, unknown.Candidates, test.candidates)
+			}
+		})
+	}
+}
+
+func TestParseBPWOrQuant(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"4.65", 4.65},
+		{"4.65bpw", 4.65},
+		{"4.65 bpw", 4.65},
+		{"q4km", 4.85},
+		{"4b-it-q8_0", 8.5},
+		{"IQ4XS", 4.25},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			bpw, err := ParseBPWOrQuant(test.input)
+			if err != nil {
+				t.Fatalf("ParseBPWOrQuant(%q) returned error: %v", test.input, err)
+			}
+			if bpw != test.want {
+				t.Errorf("ParseBPWOrQuant(%q) = %v, want %v", test.input, bpw, test.want)
+			}
+		})
+	}
+}
+
+func TestFloatQuants(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     string
+		wantBPW  float64
+		wantCPU  bool
+		wantHead float64
+	}{
+		// Unquantised models keep the output head at their dtype
+		{"fp32", "F32", 32, true, 32},
+		{"float16", "F16", 16, true, 16},
+		{"bfloat16", "BF16", 16, true, 16},
+		{"fp8", "FP8_E4M3", 8, false, 8},
+		{"FP8_E5M2", "FP8_E5M2", 8, false, 8},
+		// An E8M0 scale per 32 FP4 weights, and an E4M3 scale per 16
+		{"mxfp4_moe", "MXFP4", 4 + 8.0/32, true, 6},
+		{"nvfp4", "NVFP4", 4 + 8.0/16, false, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quant, err := ResolveQuant(test.name)
+			if err != nil {
+				t.Fatalf("ResolveQuant(%q) returned error: %v", test.name, err)
+			}
+			if quant.Name != test.want || quant.BPW != test.wantBPW || quant.CPU != test.wantCPU || !quant.GPU {
+				t.Errorf("ResolveQuant(%q) = %s at %v BPW, CPU %v, GPU %v, want %s at %v BPW, CPU %v, GPU true",
+					test.name, quant.Name, quant.BPW, quant.CPU, quant.GPU, test.want, test.wantBPW, test.wantCPU)
+			}
+			if got := GetBPWValues(quant.BPW, KVCacheFP16).LMHeadBPW; got != test.wantHead {
+				t.Errorf("%s output head = %v BPW, want %v", quant.Name, got, test.wantHead)
+			}
+		})
+	}
+}
+
+func TestFloatQuantCandidates(t *testing.T) {
+	var names []string
+	for _, candidate := range (QuantType{Format: QuantFormatGGUF}).candidates() {
+		names = append(names, candidate.name)
+	}
+	// F32 is above the 16 BPW recommendations go up to
+	for _, name := range []string{"FP8_E4M3", "BF16", "F16"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("candidates %v don't include %s", names, name)
+		}
+	}
+	if slices.Contains(names, "F32") {
+		t.Errorf("candidates %v include F32", names)
+	}
+
+	// With room to spare llama8B is recommended unquantised
+	best, _, err := CalculateBPW(llama8B, 40, 8192, KVCacheFP16, "gguf")
+	if err != nil {
+		t.Fatalf("CalculateBPW returned error: %v", err)
+	}
+	if best != "F16" {
+		t.Errorf("CalculateBPW(40 GB) = %v, want F16", best)
+	}
+}
+
+func TestCatalogueQuants(t *testing.T) {
+	tests := []struct {
+		name        string
+		want        string
+		wantBPW     float64
+		wantFamily  QuantFamily
+		wantImatrix ImatrixUse
+		wantLabel   string
+	}{
+		{"IQ1_M", "IQ1_M", 1.75, QuantFamilyIQuant, ImatrixRequired, "IQ1_M (imatrix)"},
+		{"IQ2_S", "IQ2_S", 2.5, QuantFamilyIQuant, ImatrixRequired, "IQ2_S (imatrix)"},
+		{"i1-IQ4_XS", "IQ4_XS", 4.25, QuantFamilyIQuant, ImatrixRecommended, "IQ4_XS"},
+		{"Q2_K_S", "Q2_K_S", 3.16, QuantFamilyKQuant, ImatrixRequired, "Q2_K_S (imatrix)"},
+		{"Q6_K_L", "Q6_K_L", 6.64, QuantFamilyKQuant, ImatrixRecommended, "Q6_K_L"},
+		{"tq1_0", "TQ1_0", 1.69, QuantFamilyTernary, ImatrixNone, "TQ1_0 (CPU)"},
+		{"TQ2_0", "TQ2_0", 2.06, QuantFamilyTernary, ImatrixNone, "TQ2_0 (CPU)"},
+		{"Q4_0_4_4", "Q4_0_4_4", 4.55, QuantFamilyRepacked, ImatrixNone, "Q4_0_4_4 (CPU)"},
+		{"Q4_0_4_8", "Q4_0_4_8", 4.55, QuantFamilyRepacked, ImatrixNone, "Q4_0_4_8 (CPU)"},
+		{"Q4_0_8_8", "Q4_0_8_8", 4.55, QuantFamilyRepacked, ImatrixNone, "Q4_0_8_8 (CPU)"},
+		{"Q8_K_XL", "UD-Q8_K_XL", 10.5, QuantFamilyDynamic, ImatrixRecommended, "UD-Q8_K_XL (dynamic)"},
+		{"UD-Q2_K_XL", "UD-Q2_K_XL", 3.46, QuantFamilyDynamic, ImatrixRecommended, "UD-Q2_K_XL (dynamic)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quant, err := ResolveQuant(test.name)
+			if err != nil {
+				t.Fatalf("ResolveQuant(%q) returned error: %v", test.name, err)
+			}
+			if quant.Name != test.want || quant.BPW != test.wantBPW || quant.Family != test.wantFamily || quant.Imatrix != test.wantImatrix {
+				t.Errorf("ResolveQuant(%q) = %s, %v BPW, %s, imatrix %q, want %s, %v BPW, %s, imatrix %q",
+					test.name, quant.Name, quant.BPW, quant.Family, quant.Imatrix, test.want, test.wantBPW, test.wantFamily, test.wantImatrix)
+			}
+			if got := quantLabel(QuantResult{QuantType: quant.Name, Spec: quant}); got != test.wantLabel {
+				t.Errorf("quantLabel(%s) = %q, want %q", quant.Name, got, test.wantLabel)
+			}
+		})
+	}
+}
+
+func TestCandidatesSkipCPUOnlyQuants(t *testing.T) {
+	for _, candidate := range (QuantType{Format: QuantFormatGGUF}).candidates() {
+		quant, _ := DefaultRegistry().Lookup(candidate.name)
+		if !quant.GPU {
+			t.Errorf("candidates include %s, which has no GPU kernels", candidate.name)
+		}
+	}
+}
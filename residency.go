@@ -0,0 +1,315 @@
+// File: quantest/residency.go
+
+package quantest
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+// maxSuggestions bounds how many reductions the planner tries before giving up.
+const maxSuggestions = 64
+
+// DefaultMaxLoadedModels returns Ollama's default OLLAMA_MAX_LOADED_MODELS, three per GPU.
+func DefaultMaxLoadedModels(numGPUs int) int {
+	return 3 * max(numGPUs, 1)
+}
+
+// PlanCoResidency decides whether a set of models can be loaded at the same time
+//
+// Models are placed the way Ollama's scheduler does: largest first, each on
+// the single GPU with the most free memory, spreading across GPUs only when no
+// single one has room. When the set doesn't fit, quant, KV cache and context
+// reductions are suggested in order of least quality impact until it does.
+//
+// Parameters:
+//   - models: The models to keep resident, configs are fetched by name when empty.
+//   - gpus: The capacity of each GPU in GB.
+//   - maxLoaded: The maximum number of loaded models, 0 for Ollama's default.
+//
+// Returns:
+//   - *ResidencyPlan: A pointer to a ResidencyPlan struct containing the placement and suggestions.
+//   - error: An error if a model can't be estimated.
+//
+// Example:
+//
+//	plan, err := PlanCoResidency([]ResidentModel{
+//		{Name: "nomic-embed-text:latest", ContextSize: 2048, QuantLevel: "Q8_0"},
+//		{Name: "qwen2.5:14b-instruct-q4_K_M", ContextSize: 16384, KVCacheQuant: KVCacheQ8_0},
+//	}, []float64{24}, 0)
+func PlanCoResidency(models []ResidentModel, gpus []float64, maxLoaded int) (*ResidencyPlan, error) {
+	logging.DebugLogger.Println("Planning model co-residency...")
+
+	if len(gpus) == 0 {
+		return nil, fmt.Errorf("no GPUs provided")
+	}
+	if maxLoaded == 0 {
+		maxLoaded = DefaultMaxLoadedModels(len(gpus))
+	}
+
+	resolved := make([]ResidentModel, len(models))
+	for i, model := range models {
+		var err error
+		if resolved[i], err = resolveResidentModel(model); err != nil {
+			return nil, err
+		}
+	}
+
+	plan, err := placeResidents(resolved, gpus, maxLoaded)
+	if err != nil {
+		return nil, err
+	}
+	plan.FitsWithSuggestions = plan.Fits
+
+	// Apply the least harmful reduction until the set fits or nothing is left to reduce
+	reduced := append([]ResidentModel(nil), resolved...)
+	for !plan.FitsWithSuggestions && len(plan.Suggestions) < maxSuggestions {
+		suggestion, ok, err := bestReduction(reduced)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		plan.Suggestions = append(plan.Suggestions, suggestion)
+
+		reducedPlan, err := placeResidents(reduced, gpus, maxLoaded)
+		if err != nil {
+			return nil, err
+		}
+		plan.FitsWithSuggestions = reducedPlan.Fits
+	}
+
+	return plan, nil
+}
+
+// resolveResidentModel fetches the model's config and fills in defaults
+func resolveResidentModel(model ResidentModel) (ResidentModel, error) {
+	if model.Config.NumParams == 0 {
+		config, err := GetModelConfig(model.Name)
+		if err != nil {
+			return ResidentModel{}, fmt.Errorf("error getting model config for %s: %w", model.Name, err)
+		}
+		model.Config = config
+	}
+	resolved, err := resolveQuant(model.Config, model.QuantLevel, model.QuantType, 0, model.Registry)
+	if err != nil {
+		return ResidentModel{}, fmt.Errorf("error resolving quantisation level for %s: %w", model.Name, err)
+	}
+	model.QuantLevel, model.QuantType = resolved.level, string(resolved.quant.Format)
+	if model.ContextSize == 0 {
+		model.ContextSize = DefaultContextSize
+	}
+	if model.KVCacheQuant == "" {
+		model.KVCacheQuant = KVCacheFP16
+	}
+	return model, nil
+}
+
+// residentVRAM estimates a single model's VRAM usage
+func residentVRAM(model ResidentModel) (float64, error) {
+	resolved, err := resolveQuant(model.Config, model.QuantLevel, model.QuantType, 0, model.Registry)
+	if err != nil {
+		return 0, fmt.Errorf("error resolving quantisation level for %s: %w", model.Name, err)
+	}
+	return CalculateVRAMWithQuantType(model.Config, resolved.bpw, model.ContextSize, model.KVCacheQuant, resolved.quant, model.params())
+}
+
+// params returns the model's batching and parallelism settings
+func (model ResidentModel) params() RuntimeParams {
+	return RuntimeParams{BatchSize: model.BatchSize, UBatchSize: model.UBatchSize, Parallel: model.Parallel}
+}
+
+// placeResidents places each model on the GPUs, largest first
+func placeResidents(models []ResidentModel, gpus []float64, maxLoaded int) (*ResidencyPlan, error) {
+	plan := &ResidencyPlan{
+		Models:    make([]ResidentEstimate, len(models)),
+		GPUs:      gpus,
+		MaxLoaded: maxLoaded,
+	}
+	for _, capacity := range gpus {
+		plan.AvailableVRAM += capacity
+	}
+
+	for i, model := range models {
+		vram, err := residentVRAM(model)
+		if err != nil {
+			return nil, err
+		}
+		plan.Models[i] = ResidentEstimate{Model: model, VRAM: vram}
+	}
+
+	order := make([]int, len(models))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return plan.Models[order[a]].VRAM > plan.Models[order[b]].VRAM
+	})
+
+	free := append([]float64(nil), gpus...)
+	loaded := 0
+	for _, i := range order {
+		estimate := &plan.Models[i]
+		plan.TotalVRAM += estimate.VRAM
+		if loaded >= maxLoaded {
+			continue
+		}
+
+		allocation, ok := allocateGPUs(free, estimate.VRAM)
+		if !ok {
+			continue
+		}
+		for gpu, used := range allocation {
+			if used > 0 {
+				free[gpu] -= used
+				plan.TotalVRAM += used
+				estimate.GPUs = append(estimate.GPUs, gpu)
+			}
+		}
+		plan.TotalVRAM -= estimate.VRAM
+		estimate.Loaded = true
+		loaded++
+	}
+
+	plan.Fits = loaded == len(models)
+	return plan, nil
+}
+
+// allocateGPUs finds room for a model, preferring the single GPU with the most
+// free memory and otherwise spreading it across every GPU with room, each
+// carrying its own overhead. It returns the memory taken from each GPU.
+func allocateGPUs(free []float64, vram float64) ([]float64, bool) {
+	allocation := make([]float64, len(free))
+
+	best := 0
+	for gpu := range free {
+		if free[gpu] > free[best] {
+			best = gpu
+		}
+	}
+	if len(free) > 0 && free[best] >= vram {
+		allocation[best] = vram
+		return allocation, true
+	}
+
+	overhead := bitsToGB(float64(CUDASize))
+	var usable []int
+	var freeTotal float64
+	for gpu := range free {
+		if free[gpu] > overhead {
+			usable = append(usable, gpu)
+			freeTotal += free[gpu]
+		}
+	}
+	needed := vram + overhead*float64(len(usable)-1)
+	if len(usable) < 2 || needed > freeTotal {
+		return nil, false
+	}
+	for _, gpu := range usable {
+		allocation[gpu] = needed * free[gpu] / freeTotal
+	}
+	return allocation, true
+}
+
+// residentReduction represents a candidate change to one model, lower costs hurt quality less
+type residentReduction struct {
+	suggestion ResidencySuggestion
+	model      ResidentModel
+	cost       int
+}
+
+// bestReduction applies the cheapest reduction across all models in place,
+// preferring the largest saving between reductions of equal cost
+func bestReduction(models []ResidentModel) (ResidencySuggestion, bool, error) {
+	bestIndex := -1
+	var best residentReduction
+
+	for i, model := range models {
+		current, err := residentVRAM(model)
+		if err != nil {
+			return ResidencySuggestion{}, false, err
+		}
+		for _, reduction := range residentReductions(model) {
+			vram, err := residentVRAM(reduction.model)
+			if err != nil {
+				continue
+			}
+			reduction.suggestion.Saving = current - vram
+			if reduction.suggestion.Saving <= 0 {
+				continue
+			}
+			if bestIndex < 0 || reduction.cost < best.cost ||
+				(reduction.cost == best.cost && reduction.suggestion.Saving > best.suggestion.Saving) {
+				bestIndex, best = i, reduction
+			}
+		}
+	}
+
+	if bestIndex < 0 {
+		return ResidencySuggestion{}, false, nil
+	}
+	models[bestIndex] = best.model
+	return best.suggestion, true, nil
+}
+
+// residentReductions lists the changes that could shrink a model
+func residentReductions(model ResidentModel) []residentReduction {
+	var reductions []residentReduction
+	reduce := func(change, from, to string, cost int, apply func(*ResidentModel)) {
+		reduced := model
+		apply(&reduced)
+		reductions = append(reductions, residentReduction{
+			suggestion: ResidencySuggestion{Model: model.Name, Change: change, From: from, To: to},
+			model:      reduced,
+			cost:       cost,
+		})
+	}
+
+	switch model.KVCacheQuant {
+	case KVCacheFP16:
+		reduce("kv_quant", string(KVCacheFP16), string(KVCacheQ8_0), 1, func(m *ResidentModel) { m.KVCacheQuant = KVCacheQ8_0 })
+	case KVCacheQ8_0:
+		reduce("kv_quant", string(KVCacheQ8_0), string(KVCacheQ4_0), 3, func(m *ResidentModel) { m.KVCacheQuant = KVCacheQ4_0 })
+	}
+
+	if resolved, err := resolveQuant(model.Config, model.QuantLevel, model.QuantType, 0, model.Registry); err == nil {
+		if lower, lowerBPW, ok := nextLowerQuant(resolved.quant, resolved.bpw); ok {
+			// Dropping below ~4.5 BPW costs noticeably more quality
+			cost := 2
+			if lowerBPW < 4.5 {
+				cost = 4
+			}
+			reduce("quant", model.QuantLevel, lower, cost, func(m *ResidentModel) { m.QuantLevel = lower })
+		}
+	}
+
+	if model.ContextSize/2 >= 2048 {
+		reduce("context", fmt.Sprint(model.ContextSize), fmt.Sprint(model.ContextSize/2), 3, func(m *ResidentModel) { m.ContextSize /= 2 })
+	}
+
+	return reductions
+}
+
+// nextLowerQuant returns the quant of the same type with the next lowest BPW,
+// from those recommendations are chosen from
+//
+// GGUF reductions stay with the legacy, k-quant and i-quant types llama-quantize
+// makes from any model, rather than suggesting a float, microscaled or dynamic
+// quant that needs different weights or kernels.
+func nextLowerQuant(quant QuantType, bpw float64) (string, float64, bool) {
+	registry := registryOrDefault(quant.Registry)
+	candidates := quant.candidates()
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if candidates[i].bpw >= bpw {
+			continue
+		}
+		if spec, ok := registry.Lookup(candidates[i].name); ok && !standardFamily(spec.Family) {
+			continue
+		}
+		return candidates[i].name, candidates[i].bpw, true
+	}
+	return "", 0, false
+}
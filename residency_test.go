@@ -0,0 +1,116 @@
+// File: quantest/residency_test.go
+
+package quantest
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNextLowerQuant(t *testing.T) {
+	gguf := QuantType{Format: QuantFormatGGUF}
+	tests := []struct {
+		name      string
+		quant     QuantType
+		bpw       float64
+		want      string
+		wantFound bool
+	}{
+		{"Q4_K_S", gguf, 4.58, "IQ4_NL", true},
+		{"Q8_0", gguf, 8.5, "Q6_K_L", true},
+		{"IQ1_M", gguf, 1.75, "IQ1_S", true},
+		{"IQ4_XS", gguf, 4.25, "IQ3_M", true},
+		{"F16", gguf, 16, "Q8_0", true},
+		{"IQ1_S", gguf, 1.56, "", false},
+		{"exl2 4.65bpw", QuantType{Format: QuantFormatEXL2}, 4.65, "4.60bpw", true},
+		{"awq-8bit", QuantType{Format: QuantFormatAWQ}, groupQuantBPW(8, DefaultGroupSize), "awq-4bit-g128", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _, found := nextLowerQuant(test.quant, test.bpw)
+			if got != test.want || found != test.wantFound {
+				t.Errorf("nextLowerQuant(%s, %v) = %q, %v, want %q, %v", test.quant.Format, test.bpw, got, found, test.want, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestPlanCoResidency(t *testing.T) {
+	// ~12.9 GB and ~6.9 GB
+	chat := ResidentModel{Name: "chat", Config: llama8B, QuantLevel: "Q8_0", ContextSize: 16384}
+	small := ResidentModel{Name: "small", Config: llama8B, QuantLevel: "Q4_K_M", ContextSize: 8192}
+
+	tests := []struct {
+		name        string
+		gpus        []float64
+		wantFits    bool
+		wantGPUs    [][]int
+		wantChanges []ResidencySuggestion
+	}{
+		{"both on one GPU", []float64{24}, true, [][]int{{0}, {0}}, nil},
+		// Largest first, the chat model is spread over both GPUs, leaving no room for the small one
+		{"spread across GPUs", []float64{8, 8}, false, [][]int{{0, 1}, nil}, nil},
+		{"one reduction", []float64{12, 8}, false, [][]int{{0, 1}, nil}, []ResidencySuggestion{
+			{Model: "chat", Change: "kv_quant", From: "fp16", To: "q8_0"},
+		}},
+		// KV cache quantisation costs the least, the largest saving first, then quants above 4.5 BPW
+		{"reduction order", []float64{14}, false, [][]int{{0}, nil}, []ResidencySuggestion{
+			{Model: "chat", Change: "kv_quant", From: "fp16", To: "q8_0"},
+			{Model: "small", Change: "kv_quant", From: "fp16", To: "q8_0"},
+			{Model: "chat", Change: "quant", From: "Q8_0", To: "Q6_K_L"},
+			{Model: "small", Change: "quant", From: "Q4_K_M", To: "Q4_K_S"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := PlanCoResidency([]ResidentModel{chat, small}, test.gpus, 0)
+			if err != nil {
+				t.Fatalf("PlanCoResidency returned error: %v", err)
+			}
+			if plan.Fits != test.wantFits {
+				t.Errorf("Fits = %v, want %v", plan.Fits, test.wantFits)
+			}
+			for i, estimate := range plan.Models {
+				if !slices.Equal(estimate.GPUs, test.wantGPUs[i]) || estimate.Loaded != (test.wantGPUs[i] != nil) {
+					t.Errorf("%s on GPUs %v, loaded %v, want %v", estimate.Model.Name, estimate.GPUs, estimate.Loaded, test.wantGPUs[i])
+				}
+			}
+			for i, want := range test.wantChanges {
+				if i >= len(plan.Suggestions) {
+					t.Fatalf("got %d suggestions, want at least %d", len(plan.Suggestions), len(test.wantChanges))
+				}
+				got := plan.Suggestions[i]
+				got.Saving = 0
+				if got != want {
+					t.Errorf("suggestion %d = %+v, want %+v", i, got, want)
+				}
+			}
+			if len(test.wantChanges) > 0 && !plan.FitsWithSuggestions {
+				t.Error("FitsWithSuggestions = false, want true")
+			}
+		})
+	}
+}
+
+func TestResidentVRAM(t *testing.T) {
+	config := llama8B
+	config.ModelName = "Qwen/Qwen2.5-7B-Instruct-AWQ"
+	model, err := resolveResidentModel(ResidentModel{Name: config.ModelName, Config: config, ContextSize: 8192})
+	if err != nil {
+		t.Fatalf("resolveResidentModel returned error: %v", err)
+	}
+	if model.QuantLevel != "awq-4bit" || model.QuantType != string(QuantFormatAWQ) || model.KVCacheQuant != KVCacheFP16 {
+		t.Errorf("resolveResidentModel = %s as %s with %s KV cache, want awq-4bit as awq with fp16", model.QuantLevel, model.QuantType, model.KVCacheQuant)
+	}
+
+	// The model's own batch sizes bound its compute buffers
+	want, err := CalculateVRAMWithQuantType(config, groupQuantBPW(4, DefaultGroupSize), 8192, KVCacheFP16,
+		QuantType{Format: QuantFormatAWQ}, RuntimeParams{BatchSize: 512, UBatchSize: 256, Parallel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.BatchSize, model.UBatchSize, model.Parallel = 512, 256, 2
+	if got, err := residentVRAM(model); err != nil || got != want {
+		t.Errorf("residentVRAM = %v, %v, want %v", got, err, want)
+	}
+}
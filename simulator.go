@@ -0,0 +1,365 @@
+// File: quantest/simulator.go
+
+package quantest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+// DefaultKeepAlive is how long Ollama keeps an idle model loaded.
+const DefaultKeepAlive = 5 * time.Minute
+
+// simRunner represents a model loaded by the simulated scheduler
+type simRunner struct {
+	model      ResidentModel
+	vram       float64
+	allocation []float64
+	keepAlive  time.Duration
+	busyUntil  time.Time
+}
+
+// expired reports whether keep_alive has unloaded the runner by the given time, a
+// negative keep_alive keeps the model loaded forever
+func (r *simRunner) expired(now time.Time) bool {
+	return r.keepAlive >= 0 && !r.busyUntil.Add(r.keepAlive).After(now)
+}
+
+// sameOptions reports whether a request can reuse a loaded model without a reload
+func sameOptions(a, b ResidentModel) bool {
+	return a.ContextSize == b.ContextSize && a.QuantLevel == b.QuantLevel && a.QuantType == b.QuantType &&
+		a.KVCacheQuant == b.KVCacheQuant && max(a.Parallel, 1) == max(b.Parallel, 1) &&
+		a.BatchSize == b.BatchSize && a.UBatchSize == b.UBatchSize
+}
+
+// SimulateScheduler replays a request trace through a model of Ollama's scheduler
+//
+// Requests are handled one at a time in timestamp order. A model is reused when
+// it's loaded with the same context, quant, KV cache, parallel and batch settings,
+// otherwise it's reloaded. Loading a model when OLLAMA_MAX_LOADED_MODELS is
+// reached, or when it doesn't fit the free VRAM, unloads models the way Ollama
+// does: shortest keep_alive first, then by name, skipping busy models unless all
+// are busy, in which case the request waits for the model to finish. Idle models
+// are unloaded once their keep_alive expires.
+//
+// Parameters:
+//   - requests: The request trace, configs are fetched by model name when empty.
+//   - opts: The GPUs, loaded model limit, keep_alive and default request duration.
+//
+// Returns:
+//   - *SimulationResult: A pointer to a SimulationResult struct containing the load, swap and eviction counts.
+//   - error: An error if the options are invalid or a model can't be estimated.
+//
+// Example:
+//
+//	result, err := SimulateScheduler(trace, SimulationOptions{GPUs: []float64{24}, KeepAlive: "10m"})
+//	fmt.Printf("%d cold loads, %d swaps\n", result.ColdLoads, result.Swaps)
+func SimulateScheduler(requests []SimRequest, opts SimulationOptions) (*SimulationResult, error) {
+	logging.DebugLogger.Println("Simulating scheduler...")
+
+	if len(opts.GPUs) == 0 {
+		return nil, fmt.Errorf("no GPUs provided")
+	}
+	maxLoaded := opts.MaxLoaded
+	if maxLoaded == 0 {
+		maxLoaded = DefaultMaxLoadedModels(len(opts.GPUs))
+	}
+	defaultKeepAlive := DefaultKeepAlive
+	if opts.KeepAlive != "" {
+		var err error
+		if defaultKeepAlive, err = ParseKeepAlive(opts.KeepAlive); err != nil {
+			return nil, err
+		}
+	}
+
+	trace := append([]SimRequest(nil), requests...)
+	sort.SliceStable(trace, func(i, j int) bool {
+		return trace[i].Timestamp.Before(trace[j].Timestamp)
+	})
+
+	result := &SimulationResult{Requests: len(trace)}
+	if len(trace) == 0 {
+		return result, nil
+	}
+	result.Span = trace[len(trace)-1].Timestamp.Sub(trace[0].Timestamp)
+
+	configs := make(map[string]ModelConfig)
+	estimates := make(map[string]float64)
+	stats := make(map[string]*SimModelStats)
+
+	free := append([]float64(nil), opts.GPUs...)
+	runners := make(map[string]*simRunner)
+	var clock time.Time
+
+	unload := func(name string) {
+		for gpu, used := range runners[name].allocation {
+			free[gpu] += used
+		}
+		delete(runners, name)
+	}
+	expire := func(now time.Time) {
+		for name, runner := range runners {
+			if runner.expired(now) {
+				unload(name)
+				result.Expiries++
+			}
+		}
+	}
+
+	for _, request := range trace {
+		model := request.ResidentModel
+		if config, ok := configs[model.Name]; ok && model.Config.NumParams == 0 {
+			model.Config = config
+		}
+		model, err := resolveResidentModel(model)
+		if err != nil {
+			return nil, err
+		}
+		configs[model.Name] = model.Config
+
+		key := fmt.Sprintf("%s/%d/%s/%s/%s/%d/%d/%d", model.Name, model.ContextSize, model.QuantLevel, model.QuantType,
+			model.KVCacheQuant, model.Parallel, model.BatchSize, model.UBatchSize)
+		vram, ok := estimates[key]
+		if !ok {
+			if vram, err = residentVRAM(model); err != nil {
+				return nil, err
+			}
+			estimates[key] = vram
+		}
+
+		keepAlive := defaultKeepAlive
+		if request.KeepAlive != "" {
+			if keepAlive, err = ParseKeepAlive(request.KeepAlive); err != nil {
+				return nil, fmt.Errorf("invalid keep_alive for %s: %w", model.Name, err)
+			}
+		}
+		duration := opts.RequestDuration
+		if request.Duration > 0 {
+			duration = time.Duration(request.Duration * float64(time.Second))
+		}
+
+		modelStats, ok := stats[model.Name]
+		if !ok {
+			modelStats = &SimModelStats{Model: model.Name}
+			stats[model.Name] = modelStats
+		}
+		modelStats.Requests++
+		modelStats.VRAM = math.Max(modelStats.VRAM, vram)
+
+		// The scheduler handles one pending request at a time
+		now := request.Timestamp
+		if clock.After(now) {
+			now = clock
+		}
+		expire(now)
+
+		runner, loaded := runners[model.Name]
+		if loaded && !sameOptions(runner.model, model) {
+			// A changed context or quant needs the model reloaded once it's idle
+			if runner.busyUntil.After(now) {
+				result.Waits++
+				result.WaitTime += runner.busyUntil.Sub(now)
+				now = runner.busyUntil
+			}
+			unload(model.Name)
+			result.Reloads++
+			modelStats.Reloads++
+			loaded = false
+		}
+
+		if !loaded {
+			swapped := false
+			for {
+				var allocation []float64
+				fits := false
+				if len(runners) < maxLoaded {
+					allocation, fits = allocateGPUs(free, vram)
+				}
+				if !fits && len(runners) == 0 {
+					// Ollama loads a model that's too large alone, partially offloaded to the CPU
+					allocation = append([]float64(nil), free...)
+					fits = true
+					result.Spills++
+				}
+				if fits {
+					runner = &simRunner{model: model, vram: vram, allocation: allocation}
+					for gpu, used := range allocation {
+						free[gpu] -= used
+					}
+					runners[model.Name] = runner
+					break
+				}
+
+				victim := runnerToUnload(runners, now)
+				if busyUntil := runners[victim].busyUntil; busyUntil.After(now) {
+					result.Waits++
+					result.WaitTime += busyUntil.Sub(now)
+					now = busyUntil
+				}
+				unload(victim)
+				result.Evictions++
+				stats[victim].Evictions++
+				swapped = true
+				expire(now)
+			}
+
+			result.ColdLoads++
+			modelStats.ColdLoads++
+			if swapped {
+				result.Swaps++
+			}
+		}
+
+		runner.keepAlive = keepAlive
+		if runner.busyUntil.Before(now) {
+			runner.busyUntil = now
+		}
+		runner.busyUntil = runner.busyUntil.Add(duration)
+		clock = now
+
+		var used float64
+		for _, r := range runners {
+			used += r.vram
+		}
+		result.PeakVRAM = math.Max(result.PeakVRAM, used)
+		result.PeakLoaded = max(result.PeakLoaded, len(runners))
+	}
+
+	result.ColdLoadRate = float64(result.ColdLoads) / float64(result.Requests)
+	for _, modelStats := range stats {
+		result.Models = append(result.Models, *modelStats)
+	}
+	sort.Slice(result.Models, func(i, j int) bool {
+		return result.Models[i].Model < result.Models[j].Model
+	})
+
+	return result, nil
+}
+
+// runnerToUnload picks the model Ollama would unload to make room: the idle
+// model with the shortest keep_alive, then by name, or the first busy one if
+// every model is busy
+func runnerToUnload(runners map[string]*simRunner, now time.Time) string {
+	names := make([]string, 0, len(runners))
+	for name := range runners {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := runners[names[i]].keepAlive, runners[names[j]].keepAlive
+		// A negative keep_alive never expires so it sorts last
+		if (a < 0) != (b < 0) {
+			return b < 0
+		}
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		if !runners[name].busyUntil.After(now) {
+			return name
+		}
+	}
+	return names[0]
+}
+
+// ParseKeepAlive parses a keep_alive value the way Ollama does: a duration
+// such as "10m", or a number of seconds, where negative keeps the model loaded
+// forever and zero unloads it as soon as the request completes
+//
+// Example:
+//
+//	keepAlive, err := ParseKeepAlive("30m")
+func ParseKeepAlive(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return -1, nil
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid keep_alive %q: %w", value, err)
+	}
+	if duration < 0 {
+		return -1, nil
+	}
+	return duration, nil
+}
+
+// SyntheticTrace generates a request trace from a weighted mix of models
+//
+// Requests arrive as a Poisson process at the given rate, each picking a model
+// in proportion to its weight. The same seed always produces the same trace.
+//
+// Parameters:
+//   - mix: The models and their relative weights.
+//   - requestsPerHour: The average arrival rate.
+//   - length: How long the trace covers.
+//   - seed: The random seed.
+//
+// Returns:
+//   - []SimRequest: The generated requests in timestamp order.
+//   - error: An error if the mix or rate is invalid.
+//
+// Example:
+//
+//	trace, err := SyntheticTrace([]SimMixEntry{
+//		{ResidentModel: ResidentModel{Name: "qwen2.5-coder:32b", ContextSize: 16384}, Weight: 3},
+//		{ResidentModel: ResidentModel{Name: "llama3.1:8b"}, Weight: 1},
+//	}, 120, 8*time.Hour, 1)
+func SyntheticTrace(mix []SimMixEntry, requestsPerHour float64, length time.Duration, seed int64) ([]SimRequest, error) {
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("no models in the mix")
+	}
+	if requestsPerHour <= 0 {
+		return nil, fmt.Errorf("request rate must be positive")
+	}
+
+	weights := make([]float64, len(mix))
+	var totalWeight float64
+	for i, entry := range mix {
+		if entry.Weight < 0 {
+			return nil, fmt.Errorf("negative weight for %s", entry.Name)
+		}
+		weights[i] = entry.Weight
+		totalWeight += entry.Weight
+	}
+	if totalWeight == 0 {
+		// Unweighted mixes are uniform
+		for i := range weights {
+			weights[i] = 1
+		}
+		totalWeight = float64(len(mix))
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	start := time.Unix(0, 0).UTC()
+	meanGap := float64(time.Hour) / requestsPerHour
+
+	var trace []SimRequest
+	for offset := time.Duration(random.ExpFloat64() * meanGap); offset < length; offset += time.Duration(random.ExpFloat64() * meanGap) {
+		pick := random.Float64() * totalWeight
+		entry := mix[len(mix)-1]
+		for i, candidate := range mix {
+			if pick < weights[i] {
+				entry = candidate
+				break
+			}
+			pick -= weights[i]
+		}
+		trace = append(trace, SimRequest{ResidentModel: entry.ResidentModel, Timestamp: start.Add(offset)})
+	}
+
+	return trace, nil
+}
@@ -0,0 +1,110 @@
+// File: quantest/simulator_test.go
+
+package quantest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulateScheduler(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	// ~12.9 GB and ~6.9 GB, too much for 16 GB together
+	large := ResidentModel{Name: "large", Config: llama8B, QuantLevel: "Q8_0", ContextSize: 16384}
+	small := ResidentModel{Name: "small", Config: llama8B, QuantLevel: "Q4_K_M", ContextSize: 8192}
+	tiny := ResidentModel{Name: "tiny", Config: llama8B, QuantLevel: "Q4_K_M", ContextSize: 2048}
+	request := func(model ResidentModel, at time.Duration, duration float64, keepAlive string) SimRequest {
+		return SimRequest{ResidentModel: model, Timestamp: start.Add(at), Duration: duration, KeepAlive: keepAlive}
+	}
+
+	tests := []struct {
+		name      string
+		requests  []SimRequest
+		opts      SimulationOptions
+		want      SimulationResult
+		evictions map[string]int
+	}{
+		{
+			// Each idle model is evicted for the other
+			"swaps", []SimRequest{request(large, 0, 10, ""), request(small, time.Minute, 10, ""), request(large, 2*time.Minute, 10, "")},
+			SimulationOptions{GPUs: []float64{16}},
+			SimulationResult{ColdLoads: 3, Swaps: 2, Evictions: 2},
+			map[string]int{"large": 1, "small": 1},
+		},
+		{
+			// The small model arrives 10s into the large model's 60s request and waits out the other 50s
+			"busy", []SimRequest{request(large, 0, 60, ""), request(small, 10*time.Second, 10, "")},
+			SimulationOptions{GPUs: []float64{16}},
+			SimulationResult{ColdLoads: 2, Swaps: 1, Evictions: 1, Waits: 1, WaitTime: 50 * time.Second},
+			map[string]int{"large": 1},
+		},
+		{
+			// keep_alive unloads the idle model before it's next asked for
+			"expiry", []SimRequest{request(small, 0, 10, "1m"), request(small, 5*time.Minute, 10, "1m")},
+			SimulationOptions{GPUs: []float64{24}},
+			SimulationResult{ColdLoads: 2, Expiries: 1},
+			nil,
+		},
+		{
+			// At the loaded model limit the shortest keep_alive goes first, whatever was loaded first
+			"max loaded", []SimRequest{request(small, 0, 10, "10m"), request(tiny, time.Minute, 10, "2m"), request(large, 90*time.Second, 10, "")},
+			SimulationOptions{GPUs: []float64{48}, MaxLoaded: 2},
+			SimulationResult{ColdLoads: 3, Swaps: 1, Evictions: 1},
+			map[string]int{"tiny": 1},
+		},
+		{
+			// A different context reloads the model rather than loading a second copy
+			"reload", []SimRequest{request(small, 0, 10, ""), request(tiny, time.Minute, 10, "")},
+			SimulationOptions{GPUs: []float64{24}},
+			SimulationResult{ColdLoads: 2},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name == "reload" {
+				test.requests[1].Name = "small"
+				test.want.Reloads = 1
+			}
+			result, err := SimulateScheduler(test.requests, test.opts)
+			if err != nil {
+				t.Fatalf("SimulateScheduler returned error: %v", err)
+			}
+			if result.ColdLoads != test.want.ColdLoads || result.Reloads != test.want.Reloads || result.Swaps != test.want.Swaps ||
+				result.Evictions != test.want.Evictions || result.Expiries != test.want.Expiries ||
+				result.Waits != test.want.Waits || result.WaitTime != test.want.WaitTime {
+				t.Errorf("SimulateScheduler = %d cold loads, %d reloads, %d swaps, %d evictions, %d expiries, %d waits for %s, want %d, %d, %d, %d, %d, %d for %s",
+					result.ColdLoads, result.Reloads, result.Swaps, result.Evictions, result.Expiries, result.Waits, result.WaitTime,
+					test.want.ColdLoads, test.want.Reloads, test.want.Swaps, test.want.Evictions, test.want.Expiries, test.want.Waits, test.want.WaitTime)
+			}
+			for _, stats := range result.Models {
+				if stats.Evictions != test.evictions[stats.Model] {
+					t.Errorf("%s evicted %d times, want %d", stats.Model, stats.Evictions, test.evictions[stats.Model])
+				}
+			}
+		})
+	}
+}
+
+func TestParseKeepAlive(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"10m", 10 * time.Minute},
+		{"300", 5 * time.Minute},
+		{"0", 0},
+		{"-1", -1},
+		{"-5m", -1},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			if got, err := ParseKeepAlive(test.value); err != nil || got != test.want {
+				t.Errorf("ParseKeepAlive(%q) = %v, %v, want %v", test.value, got, err, test.want)
+			}
+		})
+	}
+	if _, err := ParseKeepAlive("soon"); err == nil {
+		t.Error("ParseKeepAlive(\"soon\") returned no error")
+	}
+}
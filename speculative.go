@@ -0,0 +1,211 @@
+// File: quantest/speculative.go
+
+package quantest
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+const (
+	// DefaultDraftMax is llama.cpp's default --draft-max.
+	DefaultDraftMax = 16
+
+	// maxVocabDifference is how far llama.cpp lets a draft's vocab differ from the target's.
+	maxVocabDifference = 128
+
+	// Drafts below ~4 BPW lose acceptance rate, and above Q8_0 gain nothing.
+	minDraftBPW = 4.0
+	maxDraftBPW = 8.5
+)
+
+// EstimateSpeculative estimates the VRAM needed to run a target model with a draft model
+//
+// The draft runs in its own context alongside the target, so it gets its own
+// KV cache at the same context size, compute buffers and runtime overhead. The
+// target additionally keeps logits for verifying draft-max + 1 tokens per step
+// and the draft for sampling draft-max tokens.
+//
+// Parameters:
+//   - target: A ModelConfig struct containing the target model's configuration.
+//   - draft: A ModelConfig struct containing the draft model's configuration.
+//   - opts: A SpeculativeOptions struct containing the quants, context and draft settings.
+//
+// Returns:
+//   - *SpeculativeEstimate: A pointer to a SpeculativeEstimate struct containing both models' usage.
+//   - error: An error if a quant is invalid or a model can't be used as a draft pair.
+//
+// Example:
+//
+//	estimate, err := EstimateSpeculative(target, draft, SpeculativeOptions{
+//		VRAM:        24,
+//		ContextSize: 16384,
+//		TargetQuant: "Q4_K_M",
+//		DraftQuant:  "Q8_0",
+//	})
+func EstimateSpeculative(target, draft ModelConfig, opts SpeculativeOptions) (*SpeculativeEstimate, error) {
+	logging.DebugLogger.Println("Estimating speculative decoding...")
+
+	if target.IsEncoderDecoder || draft.IsEncoderDecoder {
+		return nil, fmt.Errorf("speculative decoding estimates only support decoder-only models")
+	}
+	opts, warnings, err := resolveSpeculativeOptions(target, draft, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	targetUsage, err := speculativeModelUsage(target, opts.TargetQuant, opts.TargetQuantType, opts.ContextSize, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error estimating target model: %w", err)
+	}
+	draftUsage, err := speculativeModelUsage(draft, opts.DraftQuant, opts.DraftQuantType, opts.DraftContextSize, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error estimating draft model: %w", err)
+	}
+
+	// fp32 logits for the verified and drafted tokens
+	draftBuffers := bitsToGB(4 * float64((opts.DraftMax+1)*target.VocabSize+opts.DraftMax*draft.VocabSize))
+
+	total := targetUsage.Total + draftUsage.Total + draftBuffers
+	estimate := &SpeculativeEstimate{
+		Target:        targetUsage,
+		Draft:         draftUsage,
+		DraftBuffers:  draftBuffers,
+		DraftMax:      opts.DraftMax,
+		Total:         math.Round(total*100) / 100,
+		AvailableVRAM: opts.VRAM,
+		Fits:          total <= opts.VRAM,
+		Warnings:      warnings,
+	}
+
+	if difference := target.VocabSize - draft.VocabSize; difference > maxVocabDifference || -difference > maxVocabDifference {
+		estimate.Warnings = append(estimate.Warnings, fmt.Sprintf(
+			"the draft's vocab size (%d) differs from the target's (%d) by more than %d tokens, llama.cpp will reject the pair",
+			draft.VocabSize, target.VocabSize, maxVocabDifference))
+	}
+	if draft.NumParams > 0 && draft.NumParams >= target.NumParams {
+		estimate.Warnings = append(estimate.Warnings, "the draft model is not smaller than the target model")
+	}
+
+	return estimate, nil
+}
+
+// BestSpeculativeQuants finds the best quant combination for a target and draft pair
+//
+// The target's quality comes first: the highest target quant is chosen for
+// which a draft between 4 BPW and Q8_0 still fits, and then the highest draft
+// quant alongside it. Quants fixed in the options are left as they are, and
+// the others are chosen from those recommendations are, in each model's format.
+// Drafts stay with quants llama-quantize makes from any model.
+//
+// Example:
+//
+//	best, err := BestSpeculativeQuants(target, draft, SpeculativeOptions{VRAM: 24, ContextSize: 16384})
+//	fmt.Printf("%s + %s\n", best.Target.Quant, best.Draft.Quant)
+func BestSpeculativeQuants(target, draft ModelConfig, opts SpeculativeOptions) (*SpeculativeEstimate, error) {
+	registry := registryOrDefault(opts.Registry)
+
+	targetQuants := []string{opts.TargetQuant}
+	if opts.TargetQuant == "" {
+		resolved, err := resolveQuant(target, "", opts.TargetQuantType, 0, opts.Registry)
+		if err != nil {
+			return nil, err
+		}
+		opts.TargetQuantType = string(resolved.quant.Format)
+		candidates := resolved.quant.candidates()
+		targetQuants = nil
+		for i := len(candidates) - 1; i >= 0; i-- {
+			targetQuants = append(targetQuants, candidates[i].name)
+		}
+	}
+
+	draftQuants := []string{opts.DraftQuant}
+	if opts.DraftQuant == "" {
+		resolved, err := resolveQuant(draft, "", opts.DraftQuantType, 0, opts.Registry)
+		if err != nil {
+			return nil, err
+		}
+		opts.DraftQuantType = string(resolved.quant.Format)
+		candidates := resolved.quant.candidates()
+		draftQuants = nil
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if bpw := candidates[i].bpw; bpw < minDraftBPW || bpw > maxDraftBPW {
+				continue
+			}
+			if spec, ok := registry.Lookup(candidates[i].name); ok && !standardFamily(spec.Family) {
+				continue
+			}
+			draftQuants = append(draftQuants, candidates[i].name)
+		}
+	}
+
+	for _, targetQuant := range targetQuants {
+		for _, draftQuant := range draftQuants {
+			candidate := opts
+			candidate.TargetQuant, candidate.DraftQuant = targetQuant, draftQuant
+			estimate, err := EstimateSpeculative(target, draft, candidate)
+			if err != nil {
+				return nil, err
+			}
+			if estimate.Fits {
+				return estimate, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no quant combination fits the target and draft models in %.2f GB", opts.VRAM)
+}
+
+// resolveSpeculativeOptions fills in the defaults for a target and draft pair,
+// resolving each model's quant and format
+func resolveSpeculativeOptions(target, draft ModelConfig, opts SpeculativeOptions) (SpeculativeOptions, []string, error) {
+	if opts.VRAM == 0 {
+		opts.VRAM = DefaultVRAM
+	}
+	if opts.ContextSize == 0 {
+		opts.ContextSize = DefaultContextSize
+	}
+	if opts.DraftContextSize == 0 {
+		opts.DraftContextSize = opts.ContextSize
+	}
+	if opts.KVCacheQuant == "" {
+		opts.KVCacheQuant = KVCacheFP16
+	}
+	if opts.DraftMax == 0 {
+		opts.DraftMax = DefaultDraftMax
+	}
+
+	targetQuant, err := resolveQuant(target, opts.TargetQuant, opts.TargetQuantType, 0, opts.Registry)
+	if err != nil {
+		return SpeculativeOptions{}, nil, fmt.Errorf("error resolving target quant: %w", err)
+	}
+	draftQuant, err := resolveQuant(draft, opts.DraftQuant, opts.DraftQuantType, 0, opts.Registry)
+	if err != nil {
+		return SpeculativeOptions{}, nil, fmt.Errorf("error resolving draft quant: %w", err)
+	}
+	opts.TargetQuant, opts.TargetQuantType = targetQuant.level, string(targetQuant.quant.Format)
+	opts.DraftQuant, opts.DraftQuantType = draftQuant.level, string(draftQuant.quant.Format)
+	return opts, append(targetQuant.warnings, draftQuant.warnings...), nil
+}
+
+// speculativeModelUsage estimates one model of a speculative decoding pair
+func speculativeModelUsage(config ModelConfig, quant, quantType string, context int, opts SpeculativeOptions) (SpeculativeModelUsage, error) {
+	resolved, err := resolveQuant(config, quant, quantType, 0, opts.Registry)
+	if err != nil {
+		return SpeculativeModelUsage{}, err
+	}
+
+	bpwValues := resolved.quant.BPWValues(resolved.bpw, opts.KVCacheQuant)
+	usage := calculateUsage(config, bpwValues, context, true, opts.Params)
+	modelUsage := SpeculativeModelUsage{
+		Quant:    resolved.level,
+		Weights:  usage.weights.Layers + usage.weights.Output,
+		KVCache:  usage.kvCache,
+		Compute:  usage.activations + usage.logits,
+		Overhead: bitsToGB(float64(CUDASize)),
+	}
+	modelUsage.Total = modelUsage.Weights + modelUsage.KVCache + modelUsage.Compute + modelUsage.Overhead
+	return modelUsage, nil
+}
@@ -0,0 +1,112 @@
+// File: quantest/speculative_test.go
+
+package quantest
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// llama1B is Llama 3.2 1B, a draft model for llama8B
+var llama1B = ModelConfig{
+	NumParams:             1.24,
+	MaxPositionEmbeddings: 131072,
+	NumHiddenLayers:       16,
+	HiddenSize:            2048,
+	NumKeyValueHeads:      8,
+	NumAttentionHeads:     32,
+	IntermediateSize:      8192,
+	VocabSize:             128256,
+	TieWordEmbeddings:     true,
+}
+
+func TestEstimateSpeculative(t *testing.T) {
+	estimate, err := EstimateSpeculative(llama8B, llama1B, SpeculativeOptions{VRAM: 24, ContextSize: 8192, TargetQuant: "q4_k_m", DraftQuant: "Q8_0"})
+	if err != nil {
+		t.Fatalf("EstimateSpeculative returned error: %v", err)
+	}
+	if estimate.Target.Quant != "Q4_K_M" || estimate.Draft.Quant != "Q8_0" || estimate.DraftMax != DefaultDraftMax {
+		t.Errorf("EstimateSpeculative = %s + %s drafting %d, want Q4_K_M + Q8_0 drafting %d",
+			estimate.Target.Quant, estimate.Draft.Quant, estimate.DraftMax, DefaultDraftMax)
+	}
+
+	// fp32 logits for 17 verified and 16 drafted tokens over the shared vocab
+	wantBuffers := 4 * 33 * 128256.0 / (1 << 30)
+	if math.Abs(estimate.DraftBuffers-wantBuffers) > 1e-12 {
+		t.Errorf("DraftBuffers = %v, want %v", estimate.DraftBuffers, wantBuffers)
+	}
+	if want := math.Round((estimate.Target.Total+estimate.Draft.Total+wantBuffers)*100) / 100; estimate.Total != want {
+		t.Errorf("Total = %v, want %v", estimate.Total, want)
+	}
+	if !estimate.Fits || len(estimate.Warnings) > 0 {
+		t.Errorf("EstimateSpeculative fits %v with warnings %v, want a fitting pair without warnings", estimate.Fits, estimate.Warnings)
+	}
+}
+
+func TestEstimateSpeculativeWarnings(t *testing.T) {
+	draft := llama1B
+	draft.VocabSize = 151936
+	estimate, err := EstimateSpeculative(llama8B, draft, SpeculativeOptions{TargetQuant: "Q4_K_M", DraftQuant: "Q8_0"})
+	if err != nil {
+		t.Fatalf("EstimateSpeculative returned error: %v", err)
+	}
+	if len(estimate.Warnings) != 1 || !strings.Contains(estimate.Warnings[0], "vocab size") {
+		t.Errorf("EstimateSpeculative warnings = %v, want a vocab size warning", estimate.Warnings)
+	}
+
+	if _, err := EstimateSpeculative(llama8B, ModelConfig{IsEncoderDecoder: true}, SpeculativeOptions{}); err == nil {
+		t.Error("EstimateSpeculative with an encoder-decoder draft returned no error")
+	}
+}
+
+func TestBestSpeculativeQuants(t *testing.T) {
+	candidates := QuantType{Format: QuantFormatGGUF}.candidates()
+	index := func(name string) int {
+		return slices.IndexFunc(candidates, func(c quantCandidate) bool { return c.name == name })
+	}
+
+	for _, vram := range []float64{8, 12, 16, 24} {
+		opts := SpeculativeOptions{VRAM: vram, ContextSize: 8192}
+		best, err := BestSpeculativeQuants(llama8B, llama1B, opts)
+		if err != nil {
+			t.Fatalf("BestSpeculativeQuants(%v GB) returned error: %v", vram, err)
+		}
+		if !best.Fits {
+			t.Errorf("BestSpeculativeQuants(%v GB) = %s + %s, which doesn't fit", vram, best.Target.Quant, best.Draft.Quant)
+		}
+
+		draft := candidates[index(best.Draft.Quant)]
+		spec, _ := DefaultRegistry().Lookup(draft.name)
+		if draft.bpw < minDraftBPW || draft.bpw > maxDraftBPW || !standardFamily(spec.Family) {
+			t.Errorf("BestSpeculativeQuants(%v GB) drafts with %s at %v BPW, want a standard quant from 4 to 8.5 BPW", vram, draft.name, draft.bpw)
+		}
+
+		// The next target quant up doesn't fit even with the smallest draft
+		if next := index(best.Target.Quant) + 1; next < len(candidates) {
+			opts.TargetQuant, opts.DraftQuant = candidates[next].name, "IQ4_XS"
+			estimate, err := EstimateSpeculative(llama8B, llama1B, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if estimate.Fits {
+				t.Errorf("BestSpeculativeQuants(%v GB) chose %s, but %s fits with IQ4_XS", vram, best.Target.Quant, candidates[next].name)
+			}
+		}
+	}
+}
+
+func TestBestSpeculativeQuantsFixed(t *testing.T) {
+	best, err := BestSpeculativeQuants(llama8B, llama1B, SpeculativeOptions{VRAM: 16, ContextSize: 8192, DraftQuant: "f16"})
+	if err != nil {
+		t.Fatalf("BestSpeculativeQuants returned error: %v", err)
+	}
+	if best.Draft.Quant != "F16" {
+		t.Errorf("BestSpeculativeQuants draft = %s, want the fixed F16", best.Draft.Quant)
+	}
+
+	if _, err := BestSpeculativeQuants(llama8B, llama1B, SpeculativeOptions{VRAM: 2, ContextSize: 8192}); err == nil {
+		t.Error("BestSpeculativeQuants(2 GB) returned no error")
+	}
+}
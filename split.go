@@ -0,0 +1,146 @@
+// File: quantest/split.go
+
+package quantest
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+// PlanTensorSplit distributes a model's layers across GPUs the way llama.cpp does
+//
+// Layers are assigned in order by the cumulative proportions of the tensor
+// split, which defaults to each GPU's capacity. Every GPU carries its own
+// runtime overhead and compute buffer, and the output head lands on the
+// device that would hold the layer after the last one.
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - bpwValues: A BPWValues struct containing the bits per weight values.
+//   - context: An integer representing the context size.
+//   - params: A RuntimeParams struct containing the batch sizes and parallel slots.
+//   - gpus: The capacity of each GPU in GB.
+//   - tensorSplit: Optional proportions of the model to place on each GPU.
+//
+// Returns:
+//   - []DeviceUsage: The estimated usage of each GPU.
+//   - error: An error if the split is invalid.
+//
+// Example:
+//
+//	devices, err := PlanTensorSplit(config, GetBPWValues(4.85, KVCacheQ8_0), 32768, RuntimeParams{}, []float64{24, 24, 12}, nil)
+func PlanTensorSplit(config ModelConfig, bpwValues BPWValues, context int, params RuntimeParams, gpus, tensorSplit []float64) ([]DeviceUsage, error) {
+	logging.DebugLogger.Println("Planning tensor split...")
+
+	if len(gpus) == 0 {
+		return nil, fmt.Errorf("no GPUs provided")
+	}
+	if config.IsEncoderDecoder {
+		return nil, fmt.Errorf("tensor split planning is not supported for encoder-decoder models")
+	}
+	if len(tensorSplit) == 0 {
+		tensorSplit = gpus
+	}
+	if len(tensorSplit) != len(gpus) {
+		return nil, fmt.Errorf("tensor split has %d values but %d GPUs were provided", len(tensorSplit), len(gpus))
+	}
+
+	// Cumulative proportions, as llama.cpp normalises --tensor-split
+	splits := make([]float64, len(tensorSplit))
+	var sum float64
+	for i, proportion := range tensorSplit {
+		if proportion < 0 {
+			return nil, fmt.Errorf("tensor split values must not be negative")
+		}
+		sum += proportion
+		splits[i] = sum
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("tensor split values must not all be zero")
+	}
+	for i := range splits {
+		splits[i] /= sum
+	}
+
+	usage := calculateUsage(config, bpwValues, context, true, params)
+	numLayers := len(usage.layerWeights)
+
+	// The output head counts as one more layer when offloading everything
+	deviceFor := func(layer int) int {
+		ratio := float64(layer) / float64(numLayers+1)
+		device := sort.Search(len(splits), func(i int) bool { return splits[i] > ratio })
+		return min(device, len(splits)-1)
+	}
+
+	devices := make([]DeviceUsage, len(gpus))
+	for i, capacity := range gpus {
+		devices[i] = DeviceUsage{Index: i, Capacity: capacity, FirstLayer: -1}
+	}
+
+	for layer := 0; layer < numLayers; layer++ {
+		device := &devices[deviceFor(layer)]
+		if device.FirstLayer < 0 {
+			device.FirstLayer = layer
+		}
+		device.Layers++
+		device.Weights += usage.layerWeights[layer]
+		device.KVCache += usage.layerKVCache[layer]
+	}
+
+	output := &devices[deviceFor(numLayers)]
+	output.Output = true
+	output.Weights += usage.weights.Output
+	output.Compute += usage.logits
+
+	for i := range devices {
+		device := &devices[i]
+		// Devices left without layers aren't used at all
+		if device.Layers > 0 || device.Output {
+			device.Overhead = bitsToGB(float64(CUDASize))
+			device.Compute += usage.activations
+		}
+		device.Total = device.Overhead + device.Weights + device.KVCache + device.Compute
+		device.Fits = device.Total <= device.Capacity
+	}
+
+	return devices, nil
+}
+
+// addSplitAdapters spreads LoRA adapters' VRAM over the devices by their share
+// of the layers and rechecks each device's fit
+func addSplitAdapters(devices []DeviceUsage, vram float64) {
+	var layers int
+	for _, device := range devices {
+		layers += device.Layers
+	}
+	if layers == 0 {
+		return
+	}
+	for i := range devices {
+		device := &devices[i]
+		device.Adapters = vram * float64(device.Layers) / float64(layers)
+		device.Total += device.Adapters
+		device.Fits = device.Total <= device.Capacity
+	}
+}
+
+// splitFits reports whether every device's share fits in its capacity
+func splitFits(devices []DeviceUsage) bool {
+	for _, device := range devices {
+		if !device.Fits {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTotal returns the combined usage of all devices
+func splitTotal(devices []DeviceUsage) float64 {
+	var total float64
+	for _, device := range devices {
+		total += device.Total
+	}
+	return total
+}
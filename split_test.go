@@ -0,0 +1,85 @@
+// File: quantest/split_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPlanTensorSplit(t *testing.T) {
+	bpwValues := GetBPWValues(4.85, KVCacheFP16)
+	usage := calculateUsage(llama8B, bpwValues, 8192, true, RuntimeParams{})
+	overhead := bitsToGB(float64(CUDASize))
+
+	// sumLayers adds up the weights and KV cache of layers first to last
+	sumLayers := func(first, last int) (weights, kvCache float64) {
+		for layer := first; layer <= last; layer++ {
+			weights += usage.layerWeights[layer]
+			kvCache += usage.layerKVCache[layer]
+		}
+		return weights, kvCache
+	}
+
+	tests := []struct {
+		name        string
+		gpus        []float64
+		tensorSplit []float64
+		// firstLayers and layers per device, with the output head on the last used device
+		firstLayers []int
+		layers      []int
+		output      int
+	}{
+		// 3:1 puts layers below 0.75 x 33 = 24.75 on the first GPU, the output head counting as layer 33
+		{"3:1", []float64{24, 8}, []float64{3, 1}, []int{0, 25}, []int{25, 7}, 1},
+		// Capacities split 24:12 as 2:1, so layers below 22 land on the first GPU
+		{"capacities", []float64{24, 12}, nil, []int{0, 22}, []int{22, 10}, 1},
+		// A zero proportion leaves the middle GPU unused
+		{"1:0:1", []float64{24, 24, 24}, []float64{1, 0, 1}, []int{0, -1, 17}, []int{17, 0, 15}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			devices, err := PlanTensorSplit(llama8B, bpwValues, 8192, RuntimeParams{}, test.gpus, test.tensorSplit)
+			if err != nil {
+				t.Fatalf("PlanTensorSplit returned error: %v", err)
+			}
+			for i, device := range devices {
+				if device.FirstLayer != test.firstLayers[i] || device.Layers != test.layers[i] || device.Output != (i == test.output) {
+					t.Errorf("GPU %d = first layer %d, %d layers, output %v, want %d, %d, %v",
+						i, device.FirstLayer, device.Layers, device.Output, test.firstLayers[i], test.layers[i], i == test.output)
+					continue
+				}
+
+				var wantWeights, wantKVCache, wantCompute, wantOverhead float64
+				if device.Layers > 0 {
+					wantWeights, wantKVCache = sumLayers(device.FirstLayer, device.FirstLayer+device.Layers-1)
+				}
+				if device.Layers > 0 || device.Output {
+					wantCompute, wantOverhead = usage.activations, overhead
+				}
+				if device.Output {
+					wantWeights += usage.weights.Output
+					wantCompute += usage.logits
+				}
+				wantTotal := wantWeights + wantKVCache + wantCompute + wantOverhead
+				if math.Abs(device.Weights-wantWeights) > 1e-9 || math.Abs(device.KVCache-wantKVCache) > 1e-9 ||
+					math.Abs(device.Compute-wantCompute) > 1e-9 || math.Abs(device.Total-wantTotal) > 1e-9 {
+					t.Errorf("GPU %d = %+v, want %.3f GB weights, %.3f GB KV cache, %.3f GB compute, %.3f GB total",
+						i, device, wantWeights, wantKVCache, wantCompute, wantTotal)
+				}
+				if device.Fits != (wantTotal <= test.gpus[i]) {
+					t.Errorf("GPU %d fits = %v with %.2f of %.2f GB", i, device.Fits, wantTotal, test.gpus[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPlanTensorSplitInvalid(t *testing.T) {
+	bpwValues := GetBPWValues(4.85, KVCacheFP16)
+	for _, tensorSplit := range [][]float64{{1}, {1, -1}, {0, 0}} {
+		if _, err := PlanTensorSplit(llama8B, bpwValues, 8192, RuntimeParams{}, []float64{24, 24}, tensorSplit); err == nil {
+			t.Errorf("PlanTensorSplit with tensor split %v returned no error", tensorSplit)
+		}
+	}
+}
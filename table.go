@@ -6,7 +6,6 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"sort"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/fatih/color"
@@ -30,6 +29,17 @@ import (
 //
 //	table, _ := GenerateQuantTable("llama3.1", 24.0, nil)
 func GenerateQuantTable(config ModelConfig, fitsVRAM float64) (QuantResultTable, error) {
+	return GenerateQuantTableWithRegistry(config, fitsVRAM, nil)
+}
+
+// GenerateQuantTableWithRegistry generates a quantisation table of the quant types in a registry,
+// e.g. one with user-defined quants, defaulting to DefaultRegistry when nil
+//
+// Example:
+//
+//	registry, _ := DefaultRegistry().With(quants...)
+//	table, _ := GenerateQuantTableWithRegistry(config, 24.0, registry)
+func GenerateQuantTableWithRegistry(config ModelConfig, fitsVRAM float64, registry *Registry) (QuantResultTable, error) {
 	if fitsVRAM == 0 {
 		var err error
 		fitsVRAM, err = GetAvailableMemory()
@@ -44,27 +54,30 @@ func GenerateQuantTable(config ModelConfig, fitsVRAM float64) (QuantResultTable,
 	contextSizes := []int{2048, 8192, 16384, 32768, 49152, 65536}
 
 	if !config.IsOllama {
-		_, err := GetHFModelConfig(config.ModelName)
+		_, err := GetModelConfig(config.ModelName)
 		if err != nil {
 			return QuantResultTable{}, err
 		}
 	}
-	for quantType, bpw := range GGUFMapping {
+	for _, spec := range registryOrDefault(registry).Quants() {
 		var result QuantResult
-		result.QuantType = quantType
-		result.BPW = bpw
+		result.QuantType = spec.Name
+		result.BPW = spec.BPW
+		result.Spec = spec
 		result.Contexts = make(map[int]ContextVRAM)
+		bpw := spec.BPW
+		quant := QuantType{Format: QuantFormatGGUF, Recipe: spec.Name, Registry: registry}
 
 		for _, context := range contextSizes {
-			vramFP16, err := CalculateVRAM(config, bpw, context, KVCacheFP16)
+			vramFP16, err := CalculateVRAMWithQuantType(config, bpw, context, KVCacheFP16, quant, RuntimeParams{})
 			if err != nil {
 				return QuantResultTable{}, err
 			}
-			vramQ8_0, err := CalculateVRAM(config, bpw, context, KVCacheQ8_0)
+			vramQ8_0, err := CalculateVRAMWithQuantType(config, bpw, context, KVCacheQ8_0, quant, RuntimeParams{})
 			if err != nil {
 				return QuantResultTable{}, err
 			}
-			vramQ4_0, err := CalculateVRAM(config, bpw, context, KVCacheQ4_0)
+			vramQ4_0, err := CalculateVRAMWithQuantType(config, bpw, context, KVCacheQ4_0, quant, RuntimeParams{})
 			if err != nil {
 				return QuantResultTable{}, err
 			}
@@ -77,11 +90,6 @@ func GenerateQuantTable(config ModelConfig, fitsVRAM float64) (QuantResultTable,
 		table.Results = append(table.Results, result)
 	}
 
-	// Sort the results from lowest BPW to highest
-	sort.Slice(table.Results, func(i, j int) bool {
-		return table.Results[i].BPW < table.Results[j].BPW
-	})
-
 	return table, nil
 }
 
@@ -139,7 +147,7 @@ func PrintFormattedTable(table QuantResultTable) string {
 	// Prepare data rows
 	for _, result := range table.Results {
 		row := []string{
-			result.QuantType,
+			quantLabel(result),
 			fmt.Sprintf("%.2f", result.BPW),
 		}
 
@@ -170,3 +178,22 @@ func PrintFormattedTable(table QuantResultTable) string {
 
 	return lipgloss.NewStyle().Foreground(lipgloss.Color("#ffffff")).Render(fmt.Sprintf("📊 VRAM Estimation for Model: %s\n\n%s", table.ModelID, buf.String()))
 }
+
+// quantLabel returns the quant's name for the table, marked when it only runs
+// well on one of CPU or GPU, needs an importance matrix or is a dynamic quant
+func quantLabel(result QuantResult) string {
+	label := result.QuantType
+	switch {
+	case result.Spec.CPU && !result.Spec.GPU:
+		label += " (CPU)"
+	case result.Spec.GPU && !result.Spec.CPU:
+		label += " (GPU)"
+	}
+	if result.Spec.Imatrix == ImatrixRequired {
+		label += " (imatrix)"
+	}
+	if result.Spec.Family == QuantFamilyDynamic {
+		label += " (dynamic)"
+	}
+	return label
+}
@@ -0,0 +1,347 @@
+// File: quantest/training.go
+
+package quantest
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/sammcj/gollama/logging"
+)
+
+const (
+	// DefaultLoRARank is the adapter rank used when none is given.
+	DefaultLoRARank = 16
+	// DefaultTrainingSequenceLength is the sequence length used when none is given.
+	DefaultTrainingSequenceLength = 2048
+
+	// nf4BPW is bitsandbytes' NF4 with double quantised block scales.
+	nf4BPW = 4.127
+)
+
+// DefaultLoRATargets are PEFT's default target modules for Llama style models.
+var DefaultLoRATargets = []string{"q_proj", "v_proj"}
+
+// loraModules are the module names that can be targeted, "all-linear" expands to all of them.
+var loraModules = []string{"q_proj", "k_proj", "v_proj", "o_proj", "gate_proj", "up_proj", "down_proj", "linear_attn", "linear_mlp"}
+
+// ParseOptimizer parses an optimizer name, accepting the HF Trainer's optim names
+//
+// Example:
+//
+//	optimizer, err := ParseOptimizer("paged_adamw_8bit")
+func ParseOptimizer(name string) (Optimizer, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "adamw", "adam", "adamw_torch", "adamw_torch_fused", "adamw_hf":
+		return OptimizerAdamW, nil
+	case "adamw-8bit", "adamw_8bit", "adamw_bnb_8bit", "paged_adamw_8bit", "adam8bit":
+		return OptimizerAdamW8bit, nil
+	case "adafactor":
+		return OptimizerAdafactor, nil
+	case "sgd":
+		return OptimizerSGD, nil
+	}
+	return "", fmt.Errorf("unknown optimizer %q, expected adamw, adamw-8bit, adafactor or sgd", name)
+}
+
+// EstimateTrainingMemory estimates the per-GPU memory needed to fine-tune a model
+//
+// The weights are held at the training dtype, or quantised for a QLoRA base
+// model, with gradients and optimizer states for the trainable parameters
+// only. Activations follow Korthikanti et al. for a Llama style block, without
+// dropout, and shrink to each layer's input plus one recomputed layer with
+// gradient checkpointing. ZeRO stages shard the optimizer states, gradients
+// and weights across GPUs, activations are never sharded.
+//
+// Parameters:
+//   - config: A ModelConfig struct containing the model configuration.
+//   - opts: A TrainingOptions struct containing the method, optimizer, batch and sharding settings.
+//
+// Returns:
+//   - *TrainingEstimate: A pointer to a TrainingEstimate struct containing the per-GPU memory breakdown.
+//   - error: An error if the options are invalid.
+//
+// Example:
+//
+//	estimate, err := EstimateTrainingMemory(config, TrainingOptions{
+//		Method:                TrainingQLoRA,
+//		LoRARank:              16,
+//		LoRATargets:           []string{"all-linear"},
+//		SequenceLength:        4096,
+//		GradientCheckpointing: true,
+//	})
+func EstimateTrainingMemory(config ModelConfig, opts TrainingOptions) (*TrainingEstimate, error) {
+	logging.DebugLogger.Println("Estimating training memory...")
+
+	opts, err := resolveTrainingOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	totalParams := config.NumParams * 1e9
+	if totalParams == 0 {
+		totalParams = config.embeddingParams() + config.layerParams()
+		if !config.TieWordEmbeddings {
+			totalParams += config.outputParams()
+		}
+	}
+
+	// Bytes per parameter for the weights and activations at the training dtype
+	weightBytes := 2.0
+	if opts.Precision == PrecisionFP32 {
+		weightBytes = 4
+	}
+
+	var weights, trainable, trainableBytes, masterBytes, factored float64
+	switch opts.Method {
+	case TrainingFull:
+		trainable = totalParams
+		trainableBytes = weightBytes
+		weights = totalParams * weightBytes
+		if opts.Precision == PrecisionMixed {
+			masterBytes = 4
+		}
+
+		for _, layer := range config.LayerConfigs() {
+			for _, module := range config.linearModules(layer) {
+				factored += module.in + module.out
+			}
+		}
+		factored += float64(config.VocabSize + config.HiddenSize)
+		if !config.TieWordEmbeddings {
+			factored += float64(config.VocabSize + config.HiddenSize)
+		}
+	default:
+		trainable, factored, err = config.loraParams(opts.LoRARank, opts.LoRATargets)
+		if err != nil {
+			return nil, err
+		}
+		// PEFT keeps adapters in fp32 unless training purely in bf16
+		trainableBytes = 4
+		if opts.Precision == PrecisionBF16 {
+			trainableBytes = 2
+		}
+
+		weights = totalParams * weightBytes
+		if opts.Method == TrainingQLoRA {
+			// bitsandbytes leaves the embedding and output head unquantised
+			unquantised := config.embeddingParams()
+			if !config.TieWordEmbeddings {
+				unquantised += config.outputParams()
+			}
+			bpw := nf4BPW
+			if opts.QuantBits == 8 {
+				bpw = 8
+			}
+			weights = math.Max(totalParams-unquantised, 0)*bpw/8 + unquantised*weightBytes
+		}
+		weights += trainable * trainableBytes
+	}
+
+	gradients := trainable * trainableBytes
+
+	// Optimizer states are kept at the master weights' dtype when there are any
+	stateBytes := trainableBytes
+	if masterBytes > 0 {
+		stateBytes = masterBytes
+	}
+	optimizerStates := trainable * masterBytes
+	switch opts.Optimizer {
+	case OptimizerAdamW:
+		optimizerStates += trainable * 2 * stateBytes
+	case OptimizerAdamW8bit:
+		optimizerStates += trainable * 2
+	case OptimizerAdafactor:
+		// Factored second moments only need a row and a column per matrix
+		optimizerStates += factored * stateBytes
+	case OptimizerSGD:
+		optimizerStates += trainable * stateBytes
+	}
+
+	if opts.NumGPUs > 1 {
+		gpus := float64(opts.NumGPUs)
+		if opts.ZeROStage >= 1 {
+			optimizerStates /= gpus
+		}
+		if opts.ZeROStage >= 2 {
+			gradients /= gpus
+		}
+		if opts.ZeROStage >= 3 {
+			weights /= gpus
+		}
+	}
+
+	activations := config.trainingActivations(opts, weightBytes)
+	tokens := float64(opts.MicroBatchSize * opts.SequenceLength)
+	logits := tokens * float64(config.VocabSize) * (weightBytes + 8)
+
+	estimate := &TrainingEstimate{
+		Options:         opts,
+		TotalParams:     totalParams,
+		TrainableParams: trainable,
+		Weights:         bitsToGB(weights),
+		Gradients:       bitsToGB(gradients),
+		OptimizerStates: bitsToGB(optimizerStates),
+		Activations:     bitsToGB(activations),
+		Logits:          bitsToGB(logits),
+		Overhead:        bitsToGB(float64(CUDASize)),
+	}
+	perGPU := estimate.Weights + estimate.Gradients + estimate.OptimizerStates + estimate.Activations + estimate.Logits + estimate.Overhead
+	estimate.PerGPU = math.Round(perGPU*100) / 100
+
+	return estimate, nil
+}
+
+// resolveTrainingOptions validates the options and fills in defaults
+func resolveTrainingOptions(opts TrainingOptions) (TrainingOptions, error) {
+	switch opts.Method {
+	case "":
+		opts.Method = TrainingFull
+	case TrainingFull, TrainingLoRA, TrainingQLoRA:
+	default:
+		return opts, fmt.Errorf("unknown training method %q, expected full, lora or qlora", opts.Method)
+	}
+
+	optimizer, err := ParseOptimizer(string(opts.Optimizer))
+	if err != nil {
+		return opts, err
+	}
+	opts.Optimizer = optimizer
+
+	switch opts.Precision {
+	case "":
+		opts.Precision = PrecisionMixed
+	case PrecisionMixed, PrecisionBF16, PrecisionFP32:
+	default:
+		return opts, fmt.Errorf("unknown precision %q, expected mixed, bf16 or fp32", opts.Precision)
+	}
+
+	if opts.MicroBatchSize == 0 {
+		opts.MicroBatchSize = 1
+	}
+	if opts.SequenceLength == 0 {
+		opts.SequenceLength = DefaultTrainingSequenceLength
+	}
+	if opts.NumGPUs == 0 {
+		opts.NumGPUs = 1
+	}
+	if opts.ZeROStage < 0 || opts.ZeROStage > 3 {
+		return opts, fmt.Errorf("invalid ZeRO stage %d, expected 0 to 3", opts.ZeROStage)
+	}
+
+	if opts.Method != TrainingFull {
+		if opts.LoRARank == 0 {
+			opts.LoRARank = DefaultLoRARank
+		}
+		if len(opts.LoRATargets) == 0 {
+			opts.LoRATargets = DefaultLoRATargets
+		}
+	}
+	if opts.Method == TrainingQLoRA {
+		switch opts.QuantBits {
+		case 0:
+			opts.QuantBits = 4
+		case 4, 8:
+		default:
+			return opts, fmt.Errorf("invalid QLoRA quantisation of %d bits, expected 4 or 8", opts.QuantBits)
+		}
+	}
+
+	return opts, nil
+}
+
+// loraParams returns the number of adapter parameters for the given rank and
+// target modules, along with the rows and columns Adafactor would factor them into
+func (c ModelConfig) loraParams(rank int, targets []string) (params, factored float64, err error) {
+	targeted := make(map[string]bool)
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		switch {
+		case target == "all-linear":
+			for _, module := range loraModules {
+				targeted[module] = true
+			}
+		case slices.Contains(loraModules, target):
+			targeted[target] = true
+		default:
+			return 0, 0, fmt.Errorf("unknown LoRA target module %q, expected all-linear or one of %s", target, strings.Join(loraModules, ", "))
+		}
+	}
+
+	r := float64(rank)
+	for _, layer := range c.LayerConfigs() {
+		for _, module := range c.linearModules(layer) {
+			if targeted[module.name] {
+				// A is rank x in and B is out x rank
+				params += r * (module.in + module.out)
+				factored += 2*r + module.in + module.out
+			}
+		}
+	}
+	return params, factored, nil
+}
+
+// trainingActivations returns the bytes of activations kept for the backward pass
+func (c ModelConfig) trainingActivations(opts TrainingOptions, bytesPerValue float64) float64 {
+	batch := float64(opts.MicroBatchSize)
+	sequence := float64(opts.SequenceLength)
+	tokens := batch * sequence
+	hidden := float64(c.HiddenSize)
+	keyDim, valueDim := c.KeyHeadDim(), c.ValueHeadDim()
+
+	targeted := make(map[string]bool)
+	if opts.Method != TrainingFull {
+		for _, target := range opts.LoRATargets {
+			targeted[strings.TrimSpace(target)] = true
+		}
+	}
+
+	var total, largest float64
+	for _, layer := range c.LayerConfigs() {
+		heads, kvHeads := float64(layer.NumAttentionHeads), float64(layer.NumKeyValueHeads)
+
+		// The attention input, Q, K, V and the output projection's input
+		attention := tokens * (hidden + heads*keyDim + kvHeads*keyDim + kvHeads*valueDim + heads*valueDim) * bytesPerValue
+		if layer.LinearAttention {
+			attention = tokens * hidden * bytesPerValue
+		} else if opts.EagerAttention {
+			// The softmax output in fp32 and again at the training dtype
+			attention += heads * sequence * sequence * batch * (4 + bytesPerValue)
+		} else {
+			// Flash attention only keeps the softmax log-sum-exp
+			attention += heads * tokens * 4
+		}
+
+		// The MLP input, the gate and up outputs and the down projection's input
+		mlp := tokens * (hidden + 3*float64(layer.IntermediateSize)) * bytesPerValue
+		if layer.LinearFFN {
+			mlp = tokens * hidden * bytesPerValue
+		}
+
+		norms := tokens * 2 * hidden * bytesPerValue
+
+		// Each adapter also keeps its rank sized intermediate
+		var adapters float64
+		for _, module := range c.linearModules(layer) {
+			if targeted["all-linear"] || targeted[module.name] {
+				adapters += tokens * float64(opts.LoRARank) * bytesPerValue
+			}
+		}
+
+		layerTotal := attention + mlp + norms + adapters
+		largest = math.Max(largest, layerTotal)
+		if opts.GradientCheckpointing {
+			total += tokens * hidden * bytesPerValue
+		} else {
+			total += layerTotal
+		}
+	}
+
+	if opts.GradientCheckpointing {
+		// One layer at a time is recomputed in full during the backward pass
+		total += largest
+	}
+	return total
+}
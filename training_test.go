@@ -0,0 +1,115 @@
+// File: quantest/training_test.go
+
+package quantest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateTrainingMemory(t *testing.T) {
+	const gib = 1 << 30
+	params := llama8B.NumParams * 1e9
+	// The untied embedding and output head, which QLoRA leaves at 16 bits
+	unquantised := 2 * 128256 * 4096.0
+	// Rank 16 on q_proj (4096 x 4096) and v_proj (4096 x 1024) in each of 32 layers
+	defaultLoRA := 32 * 16 * (4096 + 4096 + 4096 + 1024.0)
+	// Rank 16 on every projection, 1.31M per layer
+	allLinear := 32 * 16 * (2*(4096+4096) + 2*(4096+1024) + 3*(4096+14336.0))
+
+	tests := []struct {
+		name          string
+		opts          TrainingOptions
+		wantTrainable float64
+		// Bytes, before converting to GB
+		wantWeights, wantGradients, wantOptimizer float64
+	}{
+		{
+			// bf16 weights and gradients, fp32 master weights and AdamW's two fp32 moments
+			"full", TrainingOptions{},
+			params, params * 2, params * 2, params * 12,
+		},
+		{
+			// Only the fp32 adapters have gradients and optimizer states
+			"lora", TrainingOptions{Method: TrainingLoRA},
+			defaultLoRA, params*2 + defaultLoRA*4, defaultLoRA * 4, defaultLoRA * 8,
+		},
+		{
+			"qlora", TrainingOptions{Method: TrainingQLoRA, LoRATargets: []string{"all-linear"}},
+			allLinear, (params-unquantised)*nf4BPW/8 + unquantised*2 + allLinear*4, allLinear * 4, allLinear * 8,
+		},
+		{
+			"qlora 8-bit optimizer", TrainingOptions{Method: TrainingQLoRA, LoRATargets: []string{"all-linear"}, Optimizer: OptimizerAdamW8bit, QuantBits: 8},
+			allLinear, params - unquantised + unquantised*2 + allLinear*4, allLinear * 4, allLinear * 2,
+		},
+		{
+			// ZeRO-3 shards the weights, gradients and optimizer states four ways
+			"full zero-3", TrainingOptions{NumGPUs: 4, ZeROStage: 3},
+			params, params * 2 / 4, params * 2 / 4, params * 12 / 4,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			estimate, err := EstimateTrainingMemory(llama8B, test.opts)
+			if err != nil {
+				t.Fatalf("EstimateTrainingMemory returned error: %v", err)
+			}
+			if estimate.TrainableParams != test.wantTrainable {
+				t.Errorf("TrainableParams = %v, want %v", estimate.TrainableParams, test.wantTrainable)
+			}
+			for _, got := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"Weights", estimate.Weights, test.wantWeights / gib},
+				{"Gradients", estimate.Gradients, test.wantGradients / gib},
+				{"OptimizerStates", estimate.OptimizerStates, test.wantOptimizer / gib},
+			} {
+				if math.Abs(got.got-got.want) > 1e-9 {
+					t.Errorf("%s = %v GB, want %v GB", got.name, got.got, got.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEstimateTrainingMemoryCheckpointing(t *testing.T) {
+	opts := TrainingOptions{Method: TrainingLoRA, SequenceLength: 4096}
+	full, err := EstimateTrainingMemory(llama8B, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.GradientCheckpointing = true
+	checkpointed, err := EstimateTrainingMemory(llama8B, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each of the 32 layers keeps only its 4096 x 4096 bf16 input, plus one layer recomputed in full
+	layer := full.Activations / 32
+	want := 32*4096*4096*2.0/(1<<30) + layer
+	if math.Abs(checkpointed.Activations-want) > 1e-9 {
+		t.Errorf("checkpointed Activations = %v GB, want %v GB", checkpointed.Activations, want)
+	}
+}
+
+func TestEstimateTrainingMemoryInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TrainingOptions
+	}{
+		{"method", TrainingOptions{Method: "dora"}},
+		{"optimizer", TrainingOptions{Optimizer: "lion"}},
+		{"precision", TrainingOptions{Precision: "fp8"}},
+		{"zero stage", TrainingOptions{ZeROStage: 4}},
+		{"lora target", TrainingOptions{Method: TrainingLoRA, LoRATargets: []string{"lm_head"}}},
+		{"qlora bits", TrainingOptions{Method: TrainingQLoRA, QuantBits: 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := EstimateTrainingMemory(llama8B, test.opts); err == nil {
+				t.Errorf("EstimateTrainingMemory(%+v) returned no error", test.opts)
+			}
+		})
+	}
+}
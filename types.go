@@ -2,28 +2,404 @@
 
 package quantest
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // ModelConfig represents the configuration of a model.
 type ModelConfig struct {
-	ModelName             string  `json:"-"`
-	NumParams             float64 `json:"-"`
-	MaxPositionEmbeddings int     `json:"max_position_embeddings"`
-	NumHiddenLayers       int     `json:"num_hidden_layers"`
-	HiddenSize            int     `json:"hidden_size"`
-	NumKeyValueHeads      int     `json:"num_key_value_heads"`
-	NumAttentionHeads     int     `json:"num_attention_heads"`
-	IntermediateSize      int     `json:"intermediate_size"`
-	VocabSize             int     `json:"vocab_size"`
-	IsOllama              bool    `json:"-"`
-  QuantLevel            string  `json:"quant_level"`
+	ModelName             string         `json:"-"`
+	NumParams             float64        `json:"-"`
+	MaxPositionEmbeddings int            `json:"max_position_embeddings"`
+	NumHiddenLayers       int            `json:"num_hidden_layers"`
+	HiddenSize            int            `json:"hidden_size"`
+	NumKeyValueHeads      int            `json:"num_key_value_heads"`
+	NumAttentionHeads     int            `json:"num_attention_heads"`
+	IntermediateSize      int            `json:"intermediate_size"`
+	VocabSize             int            `json:"vocab_size"`
+	HeadDim               int            `json:"head_dim"`
+	KeyLength             int            `json:"-"`
+	ValueLength           int            `json:"-"`
+	TieWordEmbeddings     bool           `json:"tie_word_embeddings"`
+	TokenEmbeddingParams  float64        `json:"-"`
+	OutputParams          float64        `json:"-"`
+	RopeScaling           *RopeScaling   `json:"rope_scaling"`
+	ModelType             string         `json:"model_type"`
+	SlidingWindow         int            `json:"sliding_window"`
+	Layers                []LayerConfig  `json:"-"`
+	IsEncoderDecoder      bool           `json:"is_encoder_decoder"`
+	Encoder               *EncoderConfig `json:"-"`
+	IsEmbedding           bool           `json:"-"`
+	Pooling               PoolingType    `json:"-"`
+	IsOllama              bool           `json:"-"`
+	QuantLevel            string         `json:"quant_level"`
+	// Tensors are the GGUF's tensors when Ollama lists them.
+	Tensors []OllamaTensor `json:"-"`
+}
+
+// LayerConfig represents the shape of a single layer in models whose layers differ,
+// e.g. OpenELM, DeciLM derived Nemotron models and sliding window hybrids such as gpt-oss.
+type LayerConfig struct {
+	NumAttentionHeads int
+	NumKeyValueHeads  int
+	IntermediateSize  int
+	// SlidingWindow limits the layer's KV cache to the window, 0 for full attention.
+	SlidingWindow int
+	// LinearAttention and LinearFFN mark blocks replaced by a single linear layer.
+	LinearAttention bool
+	LinearFFN       bool
+}
+
+// EncoderConfig represents the encoder stack of an encoder-decoder model such as
+// T5, Whisper or BART. The top-level ModelConfig fields describe the decoder.
+type EncoderConfig struct {
+	NumLayers         int
+	NumAttentionHeads int
+	IntermediateSize  int
+	// MaxPositions is the longest encoder input, e.g. 1500 audio frames for Whisper.
+	MaxPositions int
+	// InputLength is the encoder input length to estimate for, defaults to MaxPositions.
+	InputLength int
+}
+
+// RopeScaling represents a model's RoPE scaling configuration.
+type RopeScaling struct {
+	Type                          string  `json:"type"`
+	RopeType                      string  `json:"rope_type"`
+	Factor                        float64 `json:"factor"`
+	OriginalMaxPositionEmbeddings int     `json:"original_max_position_embeddings"`
+	// enabled marks scaling set with WithScaledContext rather than shipped with the model.
+	enabled bool
 }
 
 // BPWValues represents the bits per weight values for a given quantisation.
 type BPWValues struct {
-	BPW        float64
-	LMHeadBPW  float64
-	KVCacheBPW float64
+	BPW          float64
+	LMHeadBPW    float64
+	EmbeddingBPW float64
+	KVCacheBPW   float64
+	// GPUEmbedding keeps the token embedding in VRAM, as vLLM and Transformers do.
+	GPUEmbedding bool
+	// Recipe is the GGUF quant whose per-tensor types size the weights, see
+	// TensorTypes. The flat BPWs are used when it's empty or unknown.
+	Recipe string
+	// Registry is where Recipe is looked up, defaulting to DefaultRegistry.
+	Registry *Registry
+}
+
+// WeightBreakdown represents where a model's weights are placed, in GB.
+//
+// llama.cpp keeps the token embedding in system RAM and offloads the output
+// head to the GPU at its own quant type, so only Layers and Output count
+// towards VRAM. Formats served from the GPU embedding, such as AWQ under vLLM,
+// count the token embedding in Output instead.
+type WeightBreakdown struct {
+	TokenEmbedding float64
+	Output         float64
+	Layers         float64
+}
+
+// DeviceUsage represents the estimated memory use of a single GPU when a model
+// is split across several. All sizes are in GB.
+type DeviceUsage struct {
+	Index      int
+	Capacity   float64
+	FirstLayer int
+	Layers     int
+	Weights    float64
+	KVCache    float64
+	Compute    float64
+	Overhead   float64
+	// Adapters is the device's share of any LoRA adapters, which sit with the layers they adapt.
+	Adapters float64
+	// Output is set on the device holding the output head, whose weights and logits are included in Weights and Compute.
+	Output bool
+	Total  float64
+	Fits   bool
+}
+
+// OffloadPlan represents a partial offload of a model's layers to the GPU, with the
+// remainder running from system RAM. Layer counts include the output head as
+// the final layer, matching Ollama's num_gpu and llama.cpp's -ngl. Sizes are in GB.
+type OffloadPlan struct {
+	GPULayers      int
+	TotalLayers    int
+	VRAM           float64
+	RAM            float64
+	FullyOffloaded bool
+}
+
+// ResidentModel represents a model to be kept loaded alongside others, e.g. the
+// embedding model, reranker, chat model and draft model of a RAG stack.
+type ResidentModel struct {
+	Name        string `json:"model"`
+	ContextSize int    `json:"context"`
+	QuantLevel  string `json:"quant"`
+	// QuantType is the quant's format, e.g. gguf or awq, inferred with the quant level when empty.
+	QuantType    string              `json:"quant_type"`
+	KVCacheQuant KVCacheQuantisation `json:"kv_quant"`
+	Parallel     int                 `json:"parallel"`
+	// BatchSize and UBatchSize are the server's n_batch and n_ubatch, see RuntimeParams.
+	BatchSize  int `json:"batch_size"`
+	UBatchSize int `json:"ubatch_size"`
+	// Config is fetched by name when left empty.
+	Config ModelConfig `json:"-"`
+	// Registry holds user-defined quants, nil for the built-in ones.
+	Registry *Registry `json:"-"`
+}
+
+// ResidentEstimate represents a model's share of a co-residency plan.
+type ResidentEstimate struct {
+	Model ResidentModel
+	VRAM  float64
+	// GPUs lists the devices the model is loaded on, more than one when it has to be spread.
+	GPUs   []int
+	Loaded bool
+}
+
+// ResidencySuggestion represents a reduction to one model that helps a set fit.
+type ResidencySuggestion struct {
+	Model  string
+	Change string
+	From   string
+	To     string
+	Saving float64
+}
+
+// ResidencyPlan represents whether a set of models can be resident at the same time.
+type ResidencyPlan struct {
+	Models        []ResidentEstimate
+	GPUs          []float64
+	MaxLoaded     int
+	TotalVRAM     float64
+	AvailableVRAM float64
+	Fits          bool
+	// Suggestions are applied cumulatively, FitsWithSuggestions reports the outcome.
+	Suggestions         []ResidencySuggestion
+	FitsWithSuggestions bool
+}
+
+// SimRequest represents a single request in a scheduler simulation trace.
+type SimRequest struct {
+	ResidentModel
+	Timestamp time.Time `json:"timestamp"`
+	// Duration is how long the request keeps the model busy, in seconds.
+	Duration float64 `json:"duration"`
+	// KeepAlive overrides the server's keep_alive, e.g. "10m", "-1" or "0".
+	KeepAlive string `json:"keep_alive"`
+}
+
+// SimMixEntry represents a model's share of a synthetic request mix.
+type SimMixEntry struct {
+	ResidentModel
+	Weight float64 `json:"weight"`
+}
+
+// SimulationOptions represents the server settings for a scheduler simulation.
+type SimulationOptions struct {
+	GPUs []float64
+	// MaxLoaded is OLLAMA_MAX_LOADED_MODELS, 0 for Ollama's default.
+	MaxLoaded int
+	// KeepAlive is OLLAMA_KEEP_ALIVE, empty for Ollama's default of 5 minutes.
+	KeepAlive string
+	// RequestDuration is used for requests without a duration of their own.
+	RequestDuration time.Duration
+}
+
+// SimModelStats represents one model's activity during a scheduler simulation.
+type SimModelStats struct {
+	Model     string
+	VRAM      float64
+	Requests  int
+	ColdLoads int
+	Reloads   int
+	Evictions int
+}
+
+// SimulationResult represents the outcome of a scheduler simulation.
+type SimulationResult struct {
+	Requests int
+	Span     time.Duration
+	// ColdLoads counts every load, including Reloads caused by a changed context or quant.
+	ColdLoads int
+	Reloads   int
+	// Swaps counts loads that had to unload another model first, Evictions the models unloaded.
+	Swaps     int
+	Evictions int
+	// Expiries counts models unloaded by keep_alive.
+	Expiries int
+	// Waits counts requests queued behind a busy model that had to be unloaded.
+	Waits    int
+	WaitTime time.Duration
+	// Spills counts models loaded alone despite not fitting, partially offloaded to the CPU.
+	Spills       int
+	ColdLoadRate float64
+	PeakVRAM     float64
+	PeakLoaded   int
+	Models       []SimModelStats
+}
+
+// TrainingMethod represents how a model is fine-tuned.
+type TrainingMethod string
+
+const (
+	// TrainingFull trains every weight.
+	TrainingFull TrainingMethod = "full"
+	// TrainingLoRA trains low-rank adapters on a frozen 16-bit base model.
+	TrainingLoRA TrainingMethod = "lora"
+	// TrainingQLoRA trains low-rank adapters on a frozen quantised base model.
+	TrainingQLoRA TrainingMethod = "qlora"
+)
+
+// Optimizer represents the optimizer used for fine-tuning.
+type Optimizer string
+
+const (
+	OptimizerAdamW     Optimizer = "adamw"
+	OptimizerAdamW8bit Optimizer = "adamw-8bit"
+	OptimizerAdafactor Optimizer = "adafactor"
+	OptimizerSGD       Optimizer = "sgd"
+)
+
+// TrainingPrecision represents the dtypes used for the weights, gradients and optimizer states.
+type TrainingPrecision string
+
+const (
+	// PrecisionMixed computes in bf16 with fp32 master weights, or fp32 adapters for LoRA.
+	PrecisionMixed TrainingPrecision = "mixed"
+	// PrecisionBF16 keeps everything in bf16.
+	PrecisionBF16 TrainingPrecision = "bf16"
+	// PrecisionFP32 keeps everything in fp32.
+	PrecisionFP32 TrainingPrecision = "fp32"
+)
+
+// TrainingOptions holds the parameters for a fine-tuning memory estimation.
+type TrainingOptions struct {
+	Method    TrainingMethod
+	Optimizer Optimizer
+	Precision TrainingPrecision
+	// MicroBatchSize is the number of sequences per GPU per step, before gradient accumulation.
+	MicroBatchSize int
+	SequenceLength int
+	// GradientCheckpointing keeps only each layer's input and recomputes the rest during the backward pass.
+	GradientCheckpointing bool
+	// EagerAttention stores the attention scores, which flash attention and SDPA avoid.
+	EagerAttention bool
+
+	LoRARank int
+	// LoRATargets are the modules adapted, e.g. q_proj, v_proj or all-linear.
+	LoRATargets []string
+	// QuantBits is the base model quantisation for QLoRA, 4 (NF4) or 8.
+	QuantBits int
+
+	NumGPUs int
+	// ZeROStage shards the optimizer states (1), gradients (2) and weights (3) across GPUs.
+	ZeROStage int
+}
+
+// TrainingEstimate represents the per-GPU memory needed to fine-tune a model, in GB.
+type TrainingEstimate struct {
+	Options         TrainingOptions
+	TotalParams     float64
+	TrainableParams float64
+	Weights         float64
+	Gradients       float64
+	// OptimizerStates includes any fp32 master weights.
+	OptimizerStates float64
+	Activations     float64
+	// Logits holds the output logits, upcast to fp32 for the loss, and their gradient.
+	Logits   float64
+	Overhead float64
+	PerGPU   float64
+}
+
+// SpeculativeOptions holds the parameters for estimating a target and draft model pair.
+type SpeculativeOptions struct {
+	VRAM         float64
+	ContextSize  int
+	KVCacheQuant KVCacheQuantisation
+	// TargetQuant and DraftQuant fix a model's quant, the best combination search only varies the others.
+	TargetQuant string
+	DraftQuant  string
+	// TargetQuantType and DraftQuantType are the quants' formats, inferred with the quants when empty.
+	TargetQuantType string
+	DraftQuantType  string
+	// DraftMax is the most tokens drafted per step, llama.cpp's --draft-max.
+	DraftMax int
+	// DraftContextSize defaults to the target's context, as llama.cpp's --ctx-size-draft does.
+	DraftContextSize int
+	Params           RuntimeParams
+	// Registry holds user-defined quants, nil for the built-in ones.
+	Registry *Registry
+}
+
+// SpeculativeModelUsage represents one model's share of a speculative decoding estimate, in GB.
+type SpeculativeModelUsage struct {
+	Quant    string
+	Weights  float64
+	KVCache  float64
+	Compute  float64
+	Overhead float64
+	Total    float64
+}
+
+// SpeculativeEstimate represents the VRAM needed to run a target model with a draft model.
+type SpeculativeEstimate struct {
+	Target SpeculativeModelUsage
+	Draft  SpeculativeModelUsage
+	// DraftBuffers holds the logits for verifying and sampling a full draft.
+	DraftBuffers  float64
+	DraftMax      int
+	Total         float64
+	AvailableVRAM float64
+	Fits          bool
+	Warnings      []string
+}
+
+// AdapterServing represents how a server keeps LoRA adapters on the GPU.
+type AdapterServing string
+
+const (
+	// AdapterServingLlamaCpp keeps every adapter loaded, as llama-server does with --lora.
+	AdapterServingLlamaCpp AdapterServing = "llama.cpp"
+	// AdapterServingVLLM preallocates --max-loras slots at --max-lora-rank and caches the rest in RAM.
+	AdapterServingVLLM AdapterServing = "vllm"
+)
+
+// LoRAAdapter represents a LoRA adapter served alongside a base model.
+type LoRAAdapter struct {
+	Name string
+	// Path is a PEFT adapter directory or a llama.cpp GGUF adapter, otherwise Rank and Targets size it.
+	Path    string
+	Rank    int
+	Targets []string
+	// ModulesToSave are modules trained in full and saved with the adapter, e.g. embed_tokens.
+	ModulesToSave []string
+	// Params and Size are filled in when the adapter is resolved, Size in GB.
+	Params float64
+	Size   float64
+}
+
+// AdapterOptions holds the LoRA adapters to serve and how they're served.
+type AdapterOptions struct {
+	Adapters []LoRAAdapter
+	Serving  AdapterServing
+	// MaxLoRAs, MaxLoRARank and MaxCPULoRAs mirror vLLM's options of the same names.
+	MaxLoRAs    int
+	MaxLoRARank int
+	MaxCPULoRAs int
+}
+
+// AdapterEstimate represents the memory used by LoRA adapters, in GB.
+type AdapterEstimate struct {
+	Adapters []LoRAAdapter
+	Serving  AdapterServing
+	// Slots is the number of adapters resident on the GPU at once.
+	Slots    int
+	VRAM     float64
+	RAM      float64
+	Warnings []string
 }
 
 // ContextVRAM represents the VRAM usage for a given context quantisation.
@@ -33,9 +409,90 @@ type ContextVRAM struct {
 	VRAMQ4_0 float64
 }
 
+// ImatrixUse represents whether making a quant needs an importance matrix.
+type ImatrixUse string
+
+// ImatrixUse constants
+const (
+	ImatrixNone        ImatrixUse = ""
+	ImatrixRecommended ImatrixUse = "recommended"
+	ImatrixRequired    ImatrixUse = "required"
+)
+
+// QuantFamily represents the kind of quantisation a quant type belongs to.
+type QuantFamily string
+
+// QuantFamily constants
+const (
+	QuantFamilyFloat       QuantFamily = "float"
+	QuantFamilyMicroscaled QuantFamily = "microscaled"
+	QuantFamilyLegacy      QuantFamily = "legacy"
+	QuantFamilyKQuant      QuantFamily = "k-quant"
+	QuantFamilyIQuant      QuantFamily = "i-quant"
+	QuantFamilyTernary     QuantFamily = "ternary"
+	QuantFamilyRepacked    QuantFamily = "repacked"
+	QuantFamilyDynamic     QuantFamily = "dynamic"
+)
+
+// QuantSpec describes a GGUF quant type, see Registry.
+type QuantSpec struct {
+	Name   string      `json:"name"`
+	Family QuantFamily `json:"family"`
+	// BPW defaults to the recipe's base quant's BPW for quants with a recipe.
+	BPW float64 `json:"bpw"`
+	// BlockSize is the number of weights sharing a scale, 1 for unquantised and per tensor scaled types.
+	BlockSize int `json:"block_size"`
+	// Imatrix is whether llama-quantize needs an importance matrix, it refuses
+	// to make the required ones without.
+	Imatrix ImatrixUse `json:"imatrix"`
+	// CPU and GPU report whether llama.cpp has efficient kernels for the quant on each.
+	CPU bool `json:"cpu"`
+	GPU bool `json:"gpu"`
+	// Quality ranks quants from worst to best, breaking ties between quants of the same BPW.
+	Quality int `json:"quality"`
+	// Aliases are other names the quant goes by, e.g. llama-quantize's Q4_K for Q4_K_M.
+	Aliases []string `json:"aliases"`
+	Note    string   `json:"note"`
+	// Recipe sizes the quant per tensor as llama-quantize makes it with overrides.
+	Recipe *QuantRecipe `json:"recipe"`
+	// KVCache is the KV cache quantisation the quant is always run with, e.g.
+	// by a serving stack that pairs them, in place of the requested one.
+	KVCache KVCacheQuantisation `json:"kv_cache"`
+}
+
+// QuantRecipe represents a GGUF quant made by llama-quantize from a built in
+// type with tensor type overrides.
+type QuantRecipe struct {
+	// Base is the llama-quantize type whose rules place the other tensors, e.g. Q4_K_M.
+	Base string `json:"base"`
+	// TokenEmbeddingType and OutputType are llama-quantize's --token-embedding-type and --output-tensor-type.
+	TokenEmbeddingType string `json:"token_embedding_type"`
+	OutputType         string `json:"output_tensor_type"`
+	// TensorTypes are --tensor-type overrides, a tensor name regex and ggml type
+	// such as attn_v=q8_0, the first match wins.
+	TensorTypes []string `json:"tensor_types"`
+}
+
+// Registry holds a set of quant types, ordered from the lowest BPW to the
+// highest. It can't be changed once made, see NewRegistry.
+type Registry struct {
+	quants []QuantSpec
+	names  map[string]int
+	// compact maps names without separators, e.g. Q4KM, to quant types
+	compact map[string]int
+}
+
+// UnknownQuantError is returned for a quant name that matches no quant type,
+// with the closest ones as Candidates.
+type UnknownQuantError struct {
+	Name       string
+	Candidates []string
+}
+
 type QuantResult struct {
 	QuantType string
 	BPW       float64
+	Spec      QuantSpec
 	Contexts  map[int]ContextVRAM
 }
 
@@ -53,36 +510,196 @@ type VRAMEstimation struct {
 	ContextSize     int
 	KVCacheQuant    KVCacheQuantisation
 	AvailableVRAM   float64
+	AvailableRAM    float64
 	QuantLevel      string
+	QuantFormat     QuantFormat
+	QuantSource     QuantSource
 	EstimatedVRAM   float64
+	EstimatedRAM    float64
+	Fit             FitStatus
+	Weights         WeightBreakdown
+	Devices         []DeviceUsage
+	Offload         OffloadPlan
 	FitsAvailable   bool
 	MaxContextSize  int
+	MaxEmbedBatch   int
+	Adapters        *AdapterEstimate
 	MaximumQuant    string
 	Recommendations map[int]string
+	Warnings        []string
 	ollamaModelInfo *OllamaModelInfo
 }
 
+// QuantSource is where a model's quant level came from.
+type QuantSource string
+
+const (
+	QuantSourceSpecified  QuantSource = "specified"
+	QuantSourceMetadata   QuantSource = "model metadata"
+	QuantSourceTag        QuantSource = "Ollama tag"
+	QuantSourceFilename   QuantSource = "GGUF filename"
+	QuantSourceRepository QuantSource = "repository name"
+	QuantSourceDefault    QuantSource = "default"
+)
+
+// InferredQuant represents a model's quant level as worked out from its metadata or name, see InferQuant.
+type InferredQuant struct {
+	QuantLevel string
+	// Format is the quant's format when the name gives one, e.g. exl2 for -exl2-4.0bpw.
+	Format QuantFormat
+	Source QuantSource
+}
+
+// RuntimeParams represents the inference server's batching and parallelism settings.
+type RuntimeParams struct {
+	// BatchSize is the logical batch size (n_batch) and UBatchSize the physical
+	// micro-batch (n_ubatch). Zero sizes the buffers for the whole context at once.
+	BatchSize  int
+	UBatchSize int
+	// Parallel is the number of sequences served at once (OLLAMA_NUM_PARALLEL, llama-server -np),
+	// each of which gets its own context's worth of KV cache.
+	Parallel int
+	// EmbedBatch is the number of sequences an embedding or reranker model runs per forward pass.
+	EmbedBatch int
+}
+
+// Workload represents what a model is run for.
+type Workload string
+
+const (
+	// WorkloadGenerate decodes tokens with a persistent KV cache.
+	WorkloadGenerate Workload = "generate"
+	// WorkloadEmbed runs batches of sequences through the model once to embed them.
+	WorkloadEmbed Workload = "embed"
+	// WorkloadRerank scores batches of query and document pairs.
+	WorkloadRerank Workload = "rerank"
+)
+
+// PoolingType represents how an embedding model reduces its token outputs, as llama.cpp names them.
+type PoolingType string
+
+const (
+	PoolingNone PoolingType = "none"
+	PoolingMean PoolingType = "mean"
+	PoolingCLS  PoolingType = "cls"
+	PoolingLast PoolingType = "last"
+	PoolingRank PoolingType = "rank"
+)
+
+// FitStatus represents where a configuration can run given the VRAM and RAM budgets.
+type FitStatus string
+
+const (
+	// FitGPU means the model runs entirely from VRAM.
+	FitGPU FitStatus = "gpu"
+	// FitCPUSpill means some layers have to run from system RAM.
+	FitCPUSpill FitStatus = "cpu-spill"
+	// FitNone means the model doesn't fit in VRAM and RAM combined.
+	FitNone FitStatus = "none"
+)
+
+// EstimateOptions holds the parameters for a VRAM estimation.
+type EstimateOptions struct {
+	VRAM float64
+	// RAM is the system RAM budget in GB, detected when zero.
+	RAM         float64
+	ContextSize int
+	// QuantLevel is inferred from the model when empty, see InferQuant.
+	QuantLevel   string
+	KVCacheQuant string
+	// QuantType is the quantisation format, gguf, exl2, exl3, awq, gptq, bnb or
+	// mlx, detected from AWQ, GPTQ, bitsandbytes and MLX quant levels or the
+	// model's name, otherwise gguf.
+	QuantType string
+	// HeadBits is the output head's bits for ExLlama formats, see QuantType.
+	HeadBits int
+	// Registry holds the GGUF quant types, e.g. with user-defined ones, defaulting to DefaultRegistry.
+	Registry *Registry
+
+	// UnifiedMemory is an Apple Silicon Mac's unified memory in GB. When set,
+	// VRAM is the share the GPU can wire, see AppleGPUMemory, and RAM the rest.
+	UnifiedMemory float64
+	// WiredLimitMB is the iogpu.wired_limit_mb sysctl, overriding the GPU's share.
+	WiredLimitMB int
+
+	// ScaledContext allows contexts beyond max_position_embeddings using the model's RoPE scaling.
+	ScaledContext bool
+	// RopeScaling and RopeFactor apply a RoPE scaling the model's config doesn't declare, e.g. YaRN for Qwen.
+	RopeScaling string
+	RopeFactor  float64
+
+	// GPUs lists the capacity of each GPU in GB, splitting the model across them
+	// proportionally or by TensorSplit, as llama.cpp's --tensor-split does.
+	GPUs        []float64
+	TensorSplit []float64
+
+	// Batch sizes and parallel slots, see RuntimeParams.
+	BatchSize  int
+	UBatchSize int
+	Parallel   int
+
+	// GPULayers reports the offload for a fixed number of GPU layers rather than the most that fit.
+	GPULayers int
+
+	// InputLength and OutputLength size encoder-decoder models, OutputLength defaults to ContextSize.
+	InputLength  int
+	OutputLength int
+
+	// Workload overrides whether the model is estimated for generation or as an
+	// embedding or reranker model, detected from the model when empty.
+	Workload Workload
+	// EmbedBatch is the number of sequences embedded per forward pass, see RuntimeParams.
+	EmbedBatch int
+
+	// Adapters are LoRA adapters served alongside the model.
+	Adapters AdapterOptions
+}
+
+// OllamaModelDetails represents the details Ollama's show API reports for a model.
+type OllamaModelDetails struct {
+	ParentModel       string   `json:"parent_model"`
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
 // OllamaModelInfo represents the model information returned by Ollama.
 type OllamaModelInfo struct {
-	Details struct {
-		ParentModel       string   `json:"parent_model"`
-		Format            string   `json:"format"`
-		Family            string   `json:"family"`
-		Families          []string `json:"families"`
-		ParameterSize     string   `json:"parameter_size"`
-		QuantizationLevel string   `json:"quantization_level"`
-	} `json:"details"`
+	Details   OllamaModelDetails `json:"details"`
 	ModelInfo struct {
-		Architecture         string `json:"general.architecture"`
-		ParameterCount       int64  `json:"general.parameter_count"`
-		ContextLength        int    `json:"llama.context_length"`
-		AttentionHeadCount   int    `json:"llama.attention.head_count"`
-		AttentionHeadCountKV int    `json:"llama.attention.head_count_kv"`
-		EmbeddingLength      int    `json:"llama.embedding_length"`
-		FeedForwardLength    int    `json:"llama.feed_forward_length"`
-		RopeDimensionCount   int    `json:"llama.rope.dimension_count"`
-		VocabSize            int    `json:"llama.vocab_size"`
+		Architecture               string  `json:"general.architecture"`
+		ParameterCount             int64   `json:"general.parameter_count"`
+		ContextLength              int     `json:"llama.context_length"`
+		AttentionHeadCount         int     `json:"llama.attention.head_count"`
+		AttentionHeadCountKV       int     `json:"llama.attention.head_count_kv"`
+		EmbeddingLength            int     `json:"llama.embedding_length"`
+		FeedForwardLength          int     `json:"llama.feed_forward_length"`
+		BlockCount                 int     `json:"llama.block_count"`
+		AttentionKeyLength         int     `json:"llama.attention.key_length"`
+		AttentionValueLength       int     `json:"llama.attention.value_length"`
+		RopeDimensionCount         int     `json:"llama.rope.dimension_count"`
+		VocabSize                  int     `json:"llama.vocab_size"`
+		SlidingWindow              int     `json:"llama.attention.sliding_window"`
+		LayerHeadCount             []int   `json:"-"`
+		LayerHeadCountKV           []int   `json:"-"`
+		LayerFeedForward           []int   `json:"-"`
+		RopeScalingType            string  `json:"llama.rope.scaling.type"`
+		RopeScalingFactor          float64 `json:"llama.rope.scaling.factor"`
+		RopeScalingOriginalContext int     `json:"llama.rope.scaling.original_context_length"`
+		PoolingType                int     `json:"llama.pooling_type"`
+		CausalAttention            *bool   `json:"-"`
 	} `json:"model_info"`
+	Capabilities []string       `json:"capabilities"`
+	Tensors      []OllamaTensor `json:"tensors"`
+}
+
+// OllamaTensor represents a tensor entry returned by Ollama.
+type OllamaTensor struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Shape []uint64 `json:"shape"`
 }
 
 // KVCacheQuantisation represents the KV cache quantisation options.
@@ -93,8 +710,50 @@ const (
 	KVCacheFP16 KVCacheQuantisation = "fp16"
 	KVCacheQ8_0 KVCacheQuantisation = "q8_0"
 	KVCacheQ4_0 KVCacheQuantisation = "q4_0"
+
+	// ExLlama's quantised cache modes
+	KVCacheQ8 KVCacheQuantisation = "q8"
+	KVCacheQ6 KVCacheQuantisation = "q6"
+	KVCacheQ4 KVCacheQuantisation = "q4"
 )
 
+// QuantFormat represents a quantisation format.
+type QuantFormat string
+
+// QuantFormat constants
+const (
+	QuantFormatGGUF QuantFormat = "gguf"
+	QuantFormatEXL2 QuantFormat = "exl2"
+	QuantFormatEXL3 QuantFormat = "exl3"
+	QuantFormatAWQ  QuantFormat = "awq"
+	QuantFormatGPTQ QuantFormat = "gptq"
+	QuantFormatBNB  QuantFormat = "bnb"
+	QuantFormatMLX  QuantFormat = "mlx"
+)
+
+// QuantType describes the quantisation format a model is run with.
+type QuantType struct {
+	Format QuantFormat
+	// HeadBits is the output head's bits for ExLlama formats, as set by
+	// convert.py's -hb, defaulting to 6.
+	HeadBits int
+	// HeadBPW is the output head's BPW for MLX, where mixed recipes keep it
+	// above the layers' BPW, defaulting to the layers' BPW.
+	HeadBPW float64
+	// Recipe is the GGUF quant to size per tensor, e.g. Q4_K_M.
+	Recipe string
+	// Registry is where Recipe and recommendations come from, defaulting to DefaultRegistry.
+	Registry *Registry
+}
+
+// MLXQuant represents an MLX affine quantisation, see ParseMLXQuant.
+type MLXQuant struct {
+	Bits int
+	// HighBits is the higher bits of a mixed recipe, or 0 for a uniform quant.
+	HighBits  int
+	GroupSize int
+}
+
 // Default values for VRAM, context size and quantisation level if not provided.
 const (
 	DefaultVRAM        = 24.0
@@ -108,37 +767,11 @@ var colourMap = []string{
 	"#00ff00", // green
 }
 
-// GGUFMapping maps GGUF quantisation types to their corresponding bits per weight
-var GGUFMapping = map[string]float64{
-	"Q8_0":    8.5,
-	"Q6_K":    6.59,
-	"Q5_K_L":  5.75,
-	"Q5_K_M":  5.69,
-	"Q5_K_S":  5.54,
-	"Q5_0":    5.54,
-	"Q4_K_L":  4.9,
-	"Q4_K_M":  4.85,
-	"Q4_K_S":  4.58,
-	"Q4_0":    4.55,
-	"IQ4_NL":  4.5,
-	"Q3_K_L":  4.27,
-	"IQ4_XS":  4.25,
-	"Q3_K_M":  3.91,
-	"IQ3_M":   3.7,
-	"IQ3_S":   3.5,
-	"Q3_K_S":  3.5,
-	"Q2_K":    3.35,
-	"IQ3_XS":  3.3,
-	"IQ3_XXS": 3.06,
-	"IQ2_M":   2.7,
-	"IQ2_S":   2.5,
-	"IQ2_XS":  2.31,
-	"IQ2_XXS": 2.06,
-	"IQ1_S":   1.56,
-}
-
-// EXL2Options contains the EXL2 quantisation options
-var EXL2Options []float64
+// EXL2Options contains the EXL2 quantisation options, any BPW from 2 to 8 can be measured.
+var EXL2Options = bpwSteps(2.0, 8.0, 0.05)
+
+// EXL3Options contains the EXL3 quantisation options, EXL3 goes down to 1 BPW.
+var EXL3Options = bpwSteps(1.0, 8.0, 0.05)
 
 var (
 	modelConfigCache = make(map[string]ModelConfig)
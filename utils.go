@@ -77,36 +77,37 @@ func levenshteinDistance(s1, s2 string) int {
 	return d[m][n]
 }
 
-// parseBPWOrQuant takes a string and returns a float64 BPW value
+// ParseBPWOrQuant takes a BPW or quant name and returns its BPW
+//
+// BPWs may be suffixed bpw as EXL2 and EXL3 quants are, e.g. 4.65bpw. GGUF
+// quant names are resolved forgivingly, see Registry.Resolve, and unknown ones
+// return an *UnknownQuantError listing the closest.
+//
+// Example:
+//
+//	bpw, err := ParseBPWOrQuant("q4km") // 4.85
 func ParseBPWOrQuant(input string) (float64, error) {
-	// First, try to parse as a float64 (direct BPW value)
-	bpw, err := strconv.ParseFloat(input, 64)
+	// First, try to parse as a float64 (direct BPW value), optionally suffixed bpw as EXL2 and EXL3 quants are
+	number := strings.TrimRight(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(input)), "bpw"), " -_")
+	bpw, err := strconv.ParseFloat(number, 64)
 	if err == nil {
 		return bpw, nil
 	}
 
-	// If parsing as float fails, check if it's a valid quantisation type
-	input = strings.ToUpper(input) // Convert to uppercase for case-insensitive matching
-	if bpw, ok := GGUFMapping[input]; ok {
+	// AWQ, GPTQ, bitsandbytes and MLX names carry their bits and group size
+	if _, bpw, err := ParseWeightQuant(input); err == nil {
 		return bpw, nil
 	}
-
-	// If not found, try to find a close match
-	var closestMatch string
-	var minDistance int = len(input)
-	for key := range GGUFMapping {
-		distance := levenshteinDistance(input, key)
-		if distance < minDistance {
-			minDistance = distance
-			closestMatch = key
-		}
+	if quant, err := ParseMLXQuant(input); err == nil {
+		return quant.BPW(ModelConfig{}), nil
 	}
 
-	if closestMatch != "" {
-		return 0, fmt.Errorf("invalid quantisation type: %s. Did you mean %s?", input, closestMatch)
+	// If parsing as float fails, check if it's a valid quantisation type in any of its spellings
+	quant, err := defaultRegistry.Resolve(input)
+	if err != nil {
+		return 0, err
 	}
-
-	return 0, fmt.Errorf("invalid quantisation or BPW value: %s", input)
+	return quant.BPW, nil
 }
 
 func getColouredVRAM(vram float64, vramStr string, fitsVRAM float64) string {
@@ -135,8 +136,8 @@ func getColouredVRAM(vram float64, vramStr string, fitsVRAM float64) string {
 
 // ParseBPW parses the BPW value
 func ParseBPW(bpw string) float64 {
-	if val, ok := GGUFMapping[bpw]; ok {
-		return val
+	if quant, ok := LookupQuant(bpw); ok {
+		return quant.BPW
 	}
 	return 0
 }
@@ -151,7 +152,10 @@ func GetBPWValues(bpw float64, kvCacheQuant KVCacheQuantisation) BPWValues {
 	logging.DebugLogger.Println("Calculating BPW values...")
 	var lmHeadBPW, kvCacheBPW float64
 
-	if bpw > 6.0 {
+	if bpw > 8.5 {
+		// Unquantised models keep the output head at the model's dtype
+		lmHeadBPW = bpw
+	} else if bpw > 6.0 {
 		lmHeadBPW = 8.0
 	} else {
 		lmHeadBPW = 6.0
@@ -160,18 +164,21 @@ func GetBPWValues(bpw float64, kvCacheQuant KVCacheQuantisation) BPWValues {
 	switch kvCacheQuant {
 	case KVCacheFP16:
 		kvCacheBPW = 16
-	case KVCacheQ8_0:
+	case KVCacheQ8_0, KVCacheQ8:
 		kvCacheBPW = 8
-	case KVCacheQ4_0:
+	case KVCacheQ6:
+		kvCacheBPW = 6
+	case KVCacheQ4_0, KVCacheQ4:
 		kvCacheBPW = 4
 	default:
 		kvCacheBPW = 16 // Default to fp16 if not specified
 	}
 
 	return BPWValues{
-		BPW:        bpw,
-		LMHeadBPW:  lmHeadBPW,
-		KVCacheBPW: kvCacheBPW,
+		BPW:          bpw,
+		LMHeadBPW:    lmHeadBPW,
+		EmbeddingBPW: bpw,
+		KVCacheBPW:   kvCacheBPW,
 	}
 }
 